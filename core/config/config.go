@@ -2,10 +2,13 @@ package config
 
 import (
 	"encoding/json"
+	"github.com/hunterhug/fafacms/core/util/limit"
 	"github.com/hunterhug/fafacms/core/util/mail"
+	"github.com/hunterhug/fafacms/core/util/oauth"
 	"github.com/hunterhug/fafacms/core/util/oss"
 	"github.com/hunterhug/fafacms/core/util/rdb"
 	"github.com/hunterhug/fafacms/core/util/session"
+	"github.com/hunterhug/fafacms/core/util/storage"
 	"github.com/alexedwards/scs"
 )
 
@@ -13,14 +16,30 @@ var (
 	FafaConfig     *Config
 	FafaRdb        *rdb.MyDb
 	FafaSessionMgr *scs.Manager
+
+	// Session的存储，撤销其他设备的登录时直接删除
+	FafaSessionStore scs.Store
+
+	// 限流和登录锁定的计数，和Session用同一种存储
+	FafaLimiter *limit.Limiter
+
+	// 文件存储后端，按文件的 StoreType 取
+	FafaStorage *storage.Registry
 )
 
 type Config struct {
+	Domain        string // 网站的访问地址，如 http://127.0.0.1:8080，生成订阅和站点地图时使用
 	DefaultConfig MyConfig
 	OssConfig     oss.Key
+	S3Config      storage.S3Config `json:"S3"`
 	DbConfig      rdb.MyDbConfig
 	SessionConfig session.MyRedisConf
-	MailConfig    mail.Sender `json:"Email"`
+	MailConfig    mail.Sender      `json:"Email"`
+	OAuthConfig   []oauth.Provider `json:"OAuth"` // 第三方登录，可以配置多个
+	AuditConfig   AuditConfig      `json:"Audit"`
+	UploadConfig  UploadConfig     `json:"Upload"`
+	ImageConfig   ImageConfig      `json:"Image"`
+	FileGCConfig  FileGCConfig     `json:"FileGC"`
 }
 
 type MyConfig struct {
@@ -28,8 +47,51 @@ type MyConfig struct {
 	LogPath       string
 	StoragePath   string
 	LogDebug      bool
-	StorageOss    bool
+	StorageOss    bool   // 旧配置，Storage 为空时为 true 表示用 oss
+	Storage       string // 新上传的文件存到哪里：local，oss，s3
 	CloseRegister bool
+	TrustProxy    bool     // 部署在反向代理后面时为 true，才从 X-Forwarded-For 取客户端IP，否则可以被伪造
+	Robots        []string // robots.txt 的内容，每行一个，为空时使用默认规则
+}
+
+// 审计日志，请求结束后放进队列，后台批量写库
+type AuditConfig struct {
+	Enable        bool
+	QueueSize     int // 队列长度，写库跟不上时丢弃，默认10000
+	BatchSize     int // 一次最多插入的条数，默认200
+	FlushSecond   int // 最多隔多久写一次库，默认3秒
+	RetentionDays int // 保留的天数，为0表示不清理
+}
+
+// 文件上传，先流式写到临时目录，大文件可以分片上传
+type UploadConfig struct {
+	MaxSize    map[string]int64 // 按上传类型限制大小，单位字节，如 {"media": 1073741824}，没有配置的用默认
+	TempPath   string           // 临时目录，为空时为 StoragePath 加 _tmp
+	ChunkSize  int64            // 分片的大小，默认5M
+	ExpireHour int              // 分片上传多久没有完成就清理，默认24小时
+	QuotaSize  int64            // 默认每个用户的存储配额，单位字节，用户和所在组都没有设置时使用，0表示不限
+	QuotaCount int64            // 默认每个用户的文件数配额，0表示不限
+}
+
+// 上传图片的处理，原图会去掉 EXIF 等元数据
+type ImageConfig struct {
+	MaxPixels int64        // 图片最多多少像素，防止解压炸弹，默认25000000
+	Thumbs    []ImageThumb // 缩略图的尺寸，为空时只有宽100的 x
+	WebP      bool         // 每个缩略图再生成一份 webp
+}
+
+// 名字为 x 的缩略图就是以前 storage_x 下的同名文件，其他的在文件名后面加上 _名字
+type ImageThumb struct {
+	Name   string
+	Width  int
+	Height int // 为0表示按宽等比例缩放，否则居中裁剪成这个尺寸
+}
+
+// 清理隐藏了并且没有被引用的文件，记录和存储里的原图、缩略图都会删掉
+type FileGCConfig struct {
+	Enable       bool
+	GraceHour    int // 隐藏后多久才清理，默认72小时，期间可以恢复
+	IntervalHour int // 多久清理一次，默认24小时
 }
 
 func JsonOutConfig(config Config) (string, error) {
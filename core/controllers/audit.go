@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// 接口返回了恢复码这类只能看一次的东西时设置，审计日志不记录返回
+	auditSkipOutKey = "auditSkipOut"
+	auditSkipOutMsg = "skip"
+)
+
+// 审计日志中要隐藏的字段
+var auditRedactKeys = map[string]bool{
+	"password":      true,
+	"repassword":    true,
+	"pass_wd":       true,
+	"code":          true,
+	"activate_code": true,
+	"reset_code":    true,
+	"secret":        true,
+	"token":         true,
+	"state":         true,
+	"uri":           true,
+}
+
+// 为nil表示不写审计日志
+var auditQueue chan *model.Log
+
+// 开启审计日志，后台批量写库和定时清理
+func InitAudit(conf config.AuditConfig) {
+	if !conf.Enable {
+		return
+	}
+
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 10000
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 200
+	}
+	if conf.FlushSecond <= 0 {
+		conf.FlushSecond = 3
+	}
+
+	auditQueue = make(chan *model.Log, conf.QueueSize)
+	go auditWorker(auditQueue, conf.BatchSize, time.Duration(conf.FlushSecond)*time.Second)
+
+	if conf.RetentionDays > 0 {
+		go auditPruner(conf.RetentionDays)
+	}
+}
+
+// 构造审计记录，输入输出中的敏感字段会被隐藏
+func newAuditLog(c *gin.Context, req interface{}, obj *Resp) *model.Log {
+	record := new(model.Log)
+	record.Ip = c.ClientIP()
+	record.Url = cutString(c.Request.URL.Path, 255)
+	record.LogTime = time.Now().Unix()
+	record.Ua = cutString(c.Request.UserAgent(), 500)
+	record.UserId = c.GetInt("uid")
+	if !obj.Flag && obj.Error != nil {
+		errStrSplit := strings.Split(obj.Error.Error(), "|")
+		if len(errStrSplit) >= 2 {
+			record.ErrorId = errStrSplit[0]
+			record.ErrorMessage = strings.Join(errStrSplit[1:], "|")
+		}
+	}
+	record.Flag = obj.Flag
+
+	if req != nil {
+		in, _ := json.Marshal(req)
+		if len(in) > 0 {
+			record.In = string(util.RedactJSON(in, auditRedactKeys))
+		}
+	}
+
+	if c.GetBool(auditSkipOutKey) {
+		record.Out = auditSkipOutMsg
+	} else {
+		out, _ := json.Marshal(obj)
+		if len(out) > 0 {
+			record.Out = string(util.RedactJSON(out, auditRedactKeys))
+		}
+	}
+
+	record.Cid = util.GetGUID()
+	return record
+}
+
+// 放进队列，队列满了丢弃，不能拖慢请求
+func audit(record *model.Log) {
+	if auditQueue == nil {
+		return
+	}
+
+	select {
+	case auditQueue <- record:
+	default:
+		flog.Log.Errorf("audit queue full, drop log cid:%s", record.Cid)
+	}
+}
+
+// 攒够一批或者到时间就写库
+func auditWorker(queue chan *model.Log, batchSize int, interval time.Duration) {
+	batch := make([]model.Log, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := model.InsertLogs(batch)
+		if err != nil {
+			flog.Log.Errorf("insert log record:%s", err.Error())
+		}
+		batch = batch[:0]
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case record := <-queue:
+			batch = append(batch, *record)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// 每小时清理一次过期的审计日志
+func auditPruner(days int) {
+	for {
+		num, err := model.DeleteLogBefore(time.Now().AddDate(0, 0, -days).Unix())
+		if err != nil {
+			flog.Log.Errorf("prune log record:%s", err.Error())
+		} else if num > 0 {
+			flog.Log.Noticef("Prune %d log records before %d days", num, days)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// 按字节截断，不切断UTF8字符
+func cutString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -7,13 +7,23 @@ import (
 	"github.com/hunterhug/fafacms/core/flog"
 	"github.com/hunterhug/fafacms/core/model"
 	util2 "github.com/hunterhug/fafacms/core/util"
-	"github.com/hunterhug/parrot/util"
-	"strconv"
 	"strings"
+	"time"
 )
 
 var AuthDebug = false
 
+// 需要管理权限的路由，启动时由路由表设置，资源表里找不到时按此拒绝
+var adminRoutes = map[string]bool{}
+
+func SetAdminRoutes(urls []string) {
+	routes := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		routes[url] = true
+	}
+	adminRoutes = routes
+}
+
 // auth filter
 // 授权过滤器
 var AuthFilter = func(c *gin.Context) {
@@ -25,12 +35,57 @@ var AuthFilter = func(c *gin.Context) {
 		c.AbortWithStatusJSON(403, resp)
 	}()
 
-	// get session
-	u, err := GetUserSession(c)
-	if err != nil {
-		flog.Log.Errorf("filter err:%s", err.Error())
-		resp.Error = Error(GetUserSessionError, err.Error())
-		return
+	// 带了令牌的按令牌认证，不看 Session 和 cookie
+	var token *model.AccessToken
+	var u *model.User
+	if bearer := bearerToken(c); bearer != "" {
+		var err error
+		token, err = checkAccessToken(bearer)
+		if err != nil {
+			flog.Log.Errorf("filter err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if token == nil {
+			flog.Log.Errorf("filter err:%s", "access token wrong")
+			resp.Error = Error(AccessTokenWrong, "")
+			return
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, tokenPathPrefix) {
+			flog.Log.Errorf("filter err:%s", "access token can not manage token")
+			resp.Error = Error(AccessTokenNotAllow, "")
+			return
+		}
+
+		u = new(model.User)
+		u.Id = token.UserId
+		err = u.Get()
+		if err != nil {
+			flog.Log.Errorf("filter err:%s", err.Error())
+			resp.Error = Error(UserNotFound, err.Error())
+			return
+		}
+
+		// 和 Session 中的一样，核心信息不能暴露出去
+		tokenUser := *u
+		tokenUser.Password = ""
+		tokenUser.ActivateCodeExpired = 0
+		tokenUser.ActivateCode = ""
+		tokenUser.TotpSecret = ""
+		tokenUser.TotpRecovery = ""
+		c.Set(tokenUserKey, &tokenUser)
+	} else {
+		// 只通过了密码还没有通过两步验证的，不能访问
+		if p, _ := getTotpPending(c); p != nil {
+			flog.Log.Errorf("filter err:%s", "totp pending")
+			resp.Error = Error(TotpNeed, "")
+			return
+		}
+
+		// get session
+		u, _ = GetUserSession(c)
 	}
 
 	if u == nil {
@@ -61,11 +116,6 @@ var AuthFilter = func(c *gin.Context) {
 		return
 	}
 
-	// root user can ignore auth
-	if u.Id == -1 {
-		return
-	}
-
 	//  get groupId by user
 	nowUser := new(model.User)
 	nowUser.Id = u.Id
@@ -96,30 +146,71 @@ var AuthFilter = func(c *gin.Context) {
 		return
 	}
 
+	// 组要求开启两步验证，没开启只能先去开启
+	if nowUser.TotpEnable != 1 && !strings.HasPrefix(c.Request.URL.Path, totpPathPrefix) {
+		forced, err := isTotpForced(nowUser)
+		if err != nil {
+			flog.Log.Errorf("filter err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if forced {
+			flog.Log.Errorf("filter err:%s", "group force totp")
+			resp.Error = Error(TotpForce, "")
+			return
+		}
+	}
+
+	// 令牌限定了范围时，只能访问范围内的资源
+	if token != nil {
+		ok, err := tokenInScope(token, c.Request.URL.Path)
+		if err != nil {
+			flog.Log.Errorf("filter err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if !ok {
+			flog.Log.Errorf("filter err:%s", "access token out of scope")
+			resp.Error = Error(AccessTokenScopeDeny, "")
+			return
+		}
+	}
+
 	// resource is exist
 	r := new(model.Resource)
 	url := c.Request.URL.Path
-	r.Url, _ = util2.Sha256([]byte(url))
-	r.Admin = true
+	r.Url = url
 
-	// resource not found can skip auth
-	if err := r.Get(); err != nil {
-		flog.Log.Debugf("resource found url:%s, auth err:%s", url, err.Error())
+	exist, err = r.GetByUrl()
+	if err != nil {
+		flog.Log.Errorf("filter err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
 		return
 	}
 
-	// if group has this resource
-	gr := new(model.GroupResource)
-	gr.GroupId = nowUser.GroupId
-	gr.ResourceId = r.Id
-	exist, err = config.FafaRdb.Client.Exist(gr)
+	// 普通路由没有登记可以跳过，管理路由没有登记要拒绝
+	if !exist {
+		if adminRoutes[url] {
+			flog.Log.Errorf("filter err:admin resource not found url:%s", url)
+			resp.Error = Error(UserAuthPermit, "")
+			return
+		}
+
+		flog.Log.Debugf("resource not found url:%s, skip auth", url)
+		return
+	}
+
+	// 用户所有的组（包括继承的）对该资源的规则，拒绝优先
+	ok, err := model.CheckPermission(nowUser.Id, r)
 	if err != nil {
 		flog.Log.Errorf("filter err:%s", err.Error())
 		resp.Error = Error(DBError, err.Error())
 		return
 	}
 
-	if !exist {
+	if !ok {
 		// not found
 		flog.Log.Errorf("filter err:%s", "resource not allow")
 		resp.Error = Error(UserAuthPermit, "")
@@ -136,36 +227,137 @@ func CheckCookie(c *gin.Context) (success bool, user *model.User) {
 
 	// cookie string split
 	arr := strings.Split(cookieString, "|")
-	if len(arr) < 2 {
+	if len(arr) != 2 || arr[0] == "" || arr[1] == "" {
+		return
+	}
+
+	// selector and validator get
+	t := new(model.LoginToken)
+	t.Types = model.LoginTokenTypeRemember
+	t.Selector = arr[0]
+	exist, err := t.GetBySelector()
+	if err != nil {
+		flog.Log.Errorf("CheckCookie err:%s", err.Error())
 		return
 	}
 
-	// userId and md5(ip+password) get
-	var userId int64
-	str, password := arr[0], arr[1]
-	userId, err = strconv.ParseInt(str, 10, 0)
-	if err != nil || userId == 0 {
+	if !exist {
+		return
+	}
+
+	// 校验串不对，可能 cookie 被盗用过，令牌直接作废
+	// 刚轮换过时，同时发出的其他请求带的是旧的，可以通过
+	validatorHash, _ := util2.Sha256([]byte(arr[1]))
+	ok, rotate := t.CheckValidator(validatorHash, time.Now().Unix())
+	if !ok {
+		flog.Log.Errorf("CheckCookie err:%s", "validator wrong")
+		t.DeleteBySelector()
 		return
 	}
 
-	// get user password
 	user = &model.User{}
-	user.Id = int(userId)
+	user.Id = t.UserId
 	err = user.Get()
-	if err != nil {
-		return
+	if err != nil || user.Status != 1 {
+		return false, nil
 	}
 
-	// if the same
-	if user.Status == 1 && password == util.Md5(c.ClientIP()+"|"+user.Password) {
+	// 新的 cookie 已经发给第一个请求了
+	if !rotate {
 		success = true
+		return
+	}
+
+	// 每次使用后轮换校验串
+	validator, err := util2.RandomHex(32)
+	if err != nil {
+		flog.Log.Errorf("CheckCookie err:%s", err.Error())
+		return false, nil
 	}
 
+	validatorHash, _ = util2.Sha256([]byte(validator))
+	t.Ip = c.ClientIP()
+	t.UserAgent = c.Request.UserAgent()
+	t.ExpireTime = time.Now().Add(rememberExpire).Unix()
+	rotated, err := t.Rotate(validatorHash)
+	if err != nil {
+		flog.Log.Errorf("CheckCookie err:%s", err.Error())
+		return false, nil
+	}
+
+	if rotated {
+		setRememberCookie(c, t.Selector+"|"+validator)
+	}
+	success = true
 	return
 }
 
+// 记住登录多久
+const rememberExpire = 7 * 24 * time.Hour
+
+// Session多久过期，和 scs 默认的一致
+const sessionExpire = 24 * time.Hour
+
+func setRememberCookie(c *gin.Context, value string) {
+	c.SetCookie("auth", value, int(rememberExpire.Seconds()), "/", "", false, true)
+}
+
+// 记住登录，生成随机的 selector 和 validator，库中只保存 validator 的哈希
+func SetRememberToken(c *gin.Context, userId int) error {
+	selector, err := util2.RandomHex(12)
+	if err != nil {
+		return err
+	}
+
+	validator, err := util2.RandomHex(32)
+	if err != nil {
+		return err
+	}
+
+	t := new(model.LoginToken)
+	t.UserId = userId
+	t.Types = model.LoginTokenTypeRemember
+	t.Selector = selector
+	t.Validator, _ = util2.Sha256([]byte(validator))
+	t.Ip = c.ClientIP()
+	t.UserAgent = c.Request.UserAgent()
+	t.ExpireTime = time.Now().Add(rememberExpire).Unix()
+	err = t.InsertOne()
+	if err != nil {
+		return err
+	}
+
+	setRememberCookie(c, selector+"|"+validator)
+	return nil
+}
+
+// 删除当前的记住登录令牌和 cookie
+func DeleteRememberToken(c *gin.Context) error {
+	c.SetCookie("auth", "", -1, "/", "", false, true)
+
+	cookieString, err := c.Cookie("auth")
+	if err != nil {
+		return nil
+	}
+
+	arr := strings.Split(cookieString, "|")
+	if len(arr) != 2 || arr[0] == "" {
+		return nil
+	}
+
+	t := new(model.LoginToken)
+	t.Types = model.LoginTokenTypeRemember
+	t.Selector = arr[0]
+	return t.DeleteBySelector()
+}
+
 // 获取用户信息，存于Session中的
 func GetUserSession(c *gin.Context) (*model.User, error) {
+	// 令牌认证的请求没有 Session
+	if v, ok := c.Get(tokenUserKey); ok {
+		return v.(*model.User), nil
+	}
+
 	u := new(model.User)
 	s := config.FafaSessionMgr.Load(c.Request)
 
@@ -182,19 +374,70 @@ func GetUserSession(c *gin.Context) (*model.User, error) {
 	return u, err
 }
 
+// 登录时调用，换一个新的 Session 令牌，并记录登录设备
 func SetUserSession(c *gin.Context, user *model.User) error {
 	s := config.FafaSessionMgr.Load(c.Request)
+	err := s.RenewToken(c.Writer)
+	if err != nil {
+		return err
+	}
+
+	// 已经完整登录，不再是待两步验证的状态
+	err = s.Remove(c.Writer, "totp_pending")
+	if err != nil {
+		return err
+	}
 
 	// 核心信息不能暴露出去
 	user.Password = ""
 	user.ActivateCodeExpired = 0
 	user.ActivateCode = ""
-	err := s.PutObject(c.Writer, "user", user)
-	return err
+	user.TotpSecret = ""
+	user.TotpRecovery = ""
+	err = s.PutObject(c.Writer, "user", user)
+	if err != nil {
+		return err
+	}
+
+	t := new(model.LoginToken)
+	t.UserId = user.Id
+	t.Types = model.LoginTokenTypeSession
+	t.Selector = s.Token()
+	t.Ip = c.ClientIP()
+	t.UserAgent = c.Request.UserAgent()
+	t.ExpireTime = time.Now().Add(sessionExpire).Unix()
+	return t.InsertOne()
 }
 
 func DeleteUserSession(c *gin.Context) error {
 	s := config.FafaSessionMgr.Load(c.Request)
+
+	t := new(model.LoginToken)
+	t.Types = model.LoginTokenTypeSession
+	t.Selector = s.Token()
+	if t.Selector != "" {
+		err := t.DeleteBySelector()
+		if err != nil {
+			return err
+		}
+	}
+
 	err := s.Destroy(c.Writer)
 	return err
 }
+
+// 撤销用户的登录设备，ids为空表示全部
+func RevokeUserLogin(userId int, ids []int) error {
+	tokens, err := model.DeleteLoginTokens(userId, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		err = config.FafaSessionStore.Delete(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ const (
 	UserAuthPermit                    = 100006
 	ParasError                        = 100010
 	ParseJsonError                    = 100011
+	PasswordHashError                 = 100012
 	LoginWrong                        = 100020
 	CloseRegisterError                = 100021
 	UserNameAlreadyBeUsed             = 100022
@@ -32,10 +33,33 @@ const (
 	GroupNotFound                     = 100041
 	GroupHasResourceHookIn            = 100042
 	GroupHasUserHookIn                = 100043
+	GroupHasChildren                  = 100044
+	GroupParentWrong                  = 100045
 	ResourceCountNumNotRight          = 100050
+	SetupTokenWrong                   = 100060
+	TotpNeed                          = 100070
+	TotpCodeWrong                     = 100071
+	TotpAlreadyEnable                 = 100072
+	TotpNotEnroll                     = 100073
+	TotpForce                         = 100074
+	TotpPendingExpired                = 100075
+	RateLimitError                    = 100080
+	LoginLocked                       = 100081
+	OAuthProviderNotFound             = 100090
+	OAuthStateWrong                   = 100091
+	OAuthExchangeError                = 100092
+	OAuthEmailNotVerified             = 100093
+	OAuthAlreadyBind                  = 100094
+	OAuthProviderAlreadyBind          = 100095
 	UploadFileError                   = 100100
 	UploadFileTypeNotPermit           = 100101
 	UploadFileTooMaxLimit             = 100102
+	UploadNotFound                    = 100103
+	UploadPartWrong                   = 100104
+	UploadNotComplete                 = 100105
+	UploadFileContentWrong            = 100106
+	UploadQuotaExceeded               = 100107
+	FileReferenced                    = 100108
 	ContentNodeSeoAlreadyBeUsed       = 101000
 	ContentNodeNotFound               = 101001
 	ContentParentNodeNotFound         = 101002
@@ -49,6 +73,17 @@ const (
 	ContentInRubbish                  = 110004
 	ContentsAreInDifferentNode        = 110005
 	ContentHistoryNotFound            = 110006
+	CommentNotFound                   = 120000
+	CommentClose                      = 120001
+	VoteRepeat                        = 130000
+	VoteNotFound                      = 130001
+	FollowSelf                        = 140000
+	FollowRepeat                      = 140001
+	FollowNotFound                    = 140002
+	TagNotFound                       = 150000
+	AccessTokenWrong                  = 160000
+	AccessTokenScopeDeny              = 160001
+	AccessTokenNotAllow               = 160002
 	DBError                           = 200001
 	EmailSendError                    = 300000
 
@@ -74,6 +109,7 @@ var ErrorMap = map[int]string{
 	LoginWrong:                        "username or password wrong",
 	CloseRegisterError:                "register close",
 	ParseJsonError:                    "json parse err",
+	PasswordHashError:                 "password hash err",
 	UserNameAlreadyBeUsed:             "user name already be used",
 	EmailAlreadyBeUsed:                "email already be used",
 	ActivateCodeWrong:                 "activate code wrong",
@@ -88,10 +124,36 @@ var ErrorMap = map[int]string{
 	GroupNotFound:                     "group not found",
 	GroupHasResourceHookIn:            "group has resource hook in",
 	GroupHasUserHookIn:                "group has user hook in",
+	GroupHasChildren:                  "group has children inherit it",
+	GroupParentWrong:                  "group parent wrong",
 	ResourceCountNumNotRight:          "resource count not right",
+	SetupTokenWrong:                   "setup token wrong or already setup",
+	TotpNeed:                          "two factor code need",
+	TotpCodeWrong:                     "two factor code wrong",
+	TotpAlreadyEnable:                 "two factor already enable",
+	TotpNotEnroll:                     "two factor not enroll or enable",
+	TotpForce:                         "group force two factor, please enable it first",
+	TotpPendingExpired:                "two factor expired, please login again",
+	RateLimitError:                    "too many requests, please try later",
+	LoginLocked:                       "login fail too many times, user locked",
+	OAuthProviderNotFound:             "oauth provider not found",
+	OAuthStateWrong:                   "oauth state wrong or expired, please try again",
+	OAuthExchangeError:                "oauth provider request err",
+	OAuthEmailNotVerified:             "oauth email empty or not verified",
+	OAuthAlreadyBind:                  "oauth account already bind by other user",
+	OAuthProviderAlreadyBind:          "oauth provider already bind, unbind first",
+	AccessTokenWrong:                  "access token wrong or expired",
+	AccessTokenScopeDeny:              "access token scope not allow",
+	AccessTokenNotAllow:               "access token can not manage tokens, please login",
 	UploadFileError:                   "upload file err",
 	UploadFileTypeNotPermit:           "upload file type not permit",
 	UploadFileTooMaxLimit:             "upload file too max limit",
+	UploadNotFound:                    "upload not found or expired",
+	UploadPartWrong:                   "upload part wrong",
+	UploadNotComplete:                 "upload parts not complete",
+	UploadFileContentWrong:            "upload file content not match type",
+	UploadQuotaExceeded:               "upload quota exceeded",
+	FileReferenced:                    "file is referenced, can not delete",
 	ContentNodeSeoAlreadyBeUsed:       "content node seo already be used",
 	ContentNodeNotFound:               "content node not found",
 	ContentParentNodeNotFound:         "parent content node not found",
@@ -104,6 +166,15 @@ var ErrorMap = map[int]string{
 	ContentSeoAlreadyBeUsed:           "content seo already be used",
 	ContentInRubbish:                  "content in rubbish",
 	ContentsAreInDifferentNode:        "contents are in different node",
+	ContentHistoryNotFound:            "content history not found",
+	CommentNotFound:                   "comment not found",
+	CommentClose:                      "comment close",
+	VoteRepeat:                        "vote repeat",
+	VoteNotFound:                      "vote not found",
+	FollowSelf:                        "can not follow self",
+	FollowRepeat:                      "follow repeat",
+	FollowNotFound:                    "follow not found",
+	TagNotFound:                       "tag not found",
 	DbNotFound:                        "db not found",
 	DbRepeat:                          "db repeat data",
 	DbHookIn:                          "db hook in",
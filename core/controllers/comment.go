@@ -1,40 +1,972 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
 )
 
+// 获取公开的内容，内容必须已经发布且正常
+func getPublicContent(contentId int, password string) (*model.Content, *ErrorResp) {
+	content := new(model.Content)
+	content.Id = contentId
+	exist, err := content.Get()
+	if err != nil {
+		return nil, Error(DBError, err.Error())
+	}
+
+	if !exist {
+		return nil, Error(ContentNotFound, "")
+	}
+
+	if content.Status == 2 {
+		return nil, Error(ContentBanPermit, "")
+	}
+
+	if content.Status != 0 || content.Version == 0 {
+		return nil, Error(ContentNotFound, "")
+	}
+
+	if content.Password != "" && content.Password != password {
+		return nil, Error(ContentPasswordWrong, "")
+	}
+
+	return content, nil
+}
+
+// 新增评论，或者回复评论
+type CreateCommentRequest struct {
+	ContentId int    `json:"content_id" validate:"required"`
+	CommentId int    `json:"comment_id"`                           // 回复某条评论时填写
+	Describe  string `json:"describe" validate:"required,lt=1000"` // 评论内容
+	Password  string `json:"password"`                             // 内容有密码时需要
+}
+
 func CreateComment(c *gin.Context) {
 	resp := new(Resp)
+	req := new(CreateCommentRequest)
 	defer func() {
-		JSONL(c, 200, nil, resp)
+		JSONL(c, 200, req, resp)
 	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("CreateComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CreateComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	content, errResp := getPublicContent(req.ContentId, req.Password)
+	if errResp != nil {
+		flog.Log.Errorf("CreateComment err: %s", errResp.Error())
+		resp.Error = errResp
+		return
+	}
+
+	// 0表示关闭评论
+	if content.CloseComment == 0 {
+		flog.Log.Errorf("CreateComment err: %s", "comment close")
+		resp.Error = Error(CommentClose, "")
+		return
+	}
+
+	comment := new(model.Comment)
+	comment.UserId = uu.Id
+	comment.ObjectId = content.Id
+	comment.ObjectUserId = content.UserId
+	comment.Describe = req.Describe
+
+	// 回复某条评论，被回复的评论必须是正常的
+	if req.CommentId != 0 {
+		parent := new(model.Comment)
+		parent.Id = req.CommentId
+		exist, err := parent.Get()
+		if err != nil {
+			flog.Log.Errorf("CreateComment err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if !exist || parent.ObjectId != content.Id || parent.Status != 1 {
+			flog.Log.Errorf("CreateComment err: %s", "comment not found")
+			resp.Error = Error(CommentNotFound, "")
+			return
+		}
+
+		comment.CommentId = parent.Id
+		comment.CommentUserId = parent.UserId
+
+		// 堆楼，回复挂在最顶层评论下
+		comment.RootCommentId = parent.RootCommentId
+		if comment.RootCommentId == 0 {
+			comment.RootCommentId = parent.Id
+		}
+	}
+
+	// 1需要审核，2直接显示，内容所有者自己的评论不需要审核
+	if content.CloseComment == 2 || content.UserId == uu.Id {
+		comment.Status = 1
+	} else {
+		comment.Status = 0
+	}
+
+	err = comment.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("CreateComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	sendCommentMessage(comment, content.Title)
+
+	resp.Data = comment
+	resp.Flag = true
+}
+
+// 修改自己的评论
+type UpdateCommentRequest struct {
+	Id       int    `json:"id" validate:"required"`
+	Describe string `json:"describe" validate:"required,lt=1000"`
 }
 
 func UpdateComment(c *gin.Context) {
 	resp := new(Resp)
+	req := new(UpdateCommentRequest)
 	defer func() {
-		JSONL(c, 200, nil, resp)
+		JSONL(c, 200, req, resp)
 	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UpdateComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UpdateComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	comment := new(model.Comment)
+	comment.Id = req.Id
+	comment.UserId = uu.Id
+	exist, err := comment.Get()
+	if err != nil {
+		flog.Log.Errorf("UpdateComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist || comment.Status == 2 {
+		flog.Log.Errorf("UpdateComment err: %s", "comment not found")
+		resp.Error = Error(CommentNotFound, "")
+		return
+	}
+
+	if comment.Describe == req.Describe {
+		resp.Flag = true
+		return
+	}
+
+	content := new(model.Content)
+	content.Id = comment.ObjectId
+	exist, err = content.Get()
+	if err != nil {
+		flog.Log.Errorf("UpdateComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("UpdateComment err: %s", "content not found")
+		resp.Error = Error(ContentNotFound, "")
+		return
+	}
+
+	if content.CloseComment == 0 {
+		flog.Log.Errorf("UpdateComment err: %s", "comment close")
+		resp.Error = Error(CommentClose, "")
+		return
+	}
+
+	// 需要审核的内容，改过的评论要重新审核
+	if content.CloseComment == 1 && content.UserId != uu.Id {
+		comment.Status = 0
+	}
+
+	comment.Describe = req.Describe
+	err = comment.UpdateDescribe()
+	if err != nil {
+		flog.Log.Errorf("UpdateComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = comment
+	resp.Flag = true
+}
+
+// 删除评论，评论者或者内容所有者可以删除，回复会一起被删除
+type DeleteCommentRequest struct {
+	Id int `json:"id" validate:"required"`
 }
 
 func DeleteComment(c *gin.Context) {
 	resp := new(Resp)
+	req := new(DeleteCommentRequest)
 	defer func() {
-		JSONL(c, 200, nil, resp)
+		JSONL(c, 200, req, resp)
 	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("DeleteComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("DeleteComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	comment := new(model.Comment)
+	comment.Id = req.Id
+	exist, err := comment.Get()
+	if err != nil {
+		flog.Log.Errorf("DeleteComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist || (comment.UserId != uu.Id && comment.ObjectUserId != uu.Id) {
+		flog.Log.Errorf("DeleteComment err: %s", "comment not found")
+		resp.Error = Error(CommentNotFound, "")
+		return
+	}
+
+	if comment.Status == 2 {
+		resp.Flag = true
+		return
+	}
+
+	err = comment.Delete()
+	if err != nil {
+		flog.Log.Errorf("DeleteComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
+
+// 获取评论，自己写的或者自己内容下的评论
+type TakeCommentRequest struct {
+	Id int `json:"id" validate:"required"`
 }
 
 func TakeComment(c *gin.Context) {
 	resp := new(Resp)
+	req := new(TakeCommentRequest)
 	defer func() {
-		JSONL(c, 200, nil, resp)
+		JSONL(c, 200, req, resp)
 	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("TakeComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("TakeComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	comment := new(model.Comment)
+	exist, err := config.FafaRdb.Client.Where("id=?", req.Id).And("user_id=? or object_user_id=?", uu.Id, uu.Id).Get(comment)
+	if err != nil {
+		flog.Log.Errorf("TakeComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("TakeComment err: %s", "comment not found")
+		resp.Error = Error(CommentNotFound, "")
+		return
+	}
+
+	resp.Data = comment
+	resp.Flag = true
+}
+
+type ListCommentRequest struct {
+	Id              int      `json:"id"`
+	ContentId       int      `json:"content_id"`
+	CommentId       int      `json:"comment_id"`
+	RootCommentId   int      `json:"root_comment_id"`
+	UserId          int      `json:"user_id"`
+	ObjectUserId    int      `json:"object_user_id"`
+	Type            int      `json:"type" validate:"oneof=-1 0 1"` // 自己列出时，0表示自己内容下的评论，1表示自己写的评论，-1全部
+	Status          int      `json:"status" validate:"oneof=-1 0 1 2 3"`
+	CreateTimeBegin int64    `json:"create_time_begin"`
+	CreateTimeEnd   int64    `json:"create_time_end"`
+	Sort            []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type ListCommentResponse struct {
+	Comments []model.Comment `json:"comments"`
+	PageHelp
 }
 
 func ListComment(c *gin.Context) {
 	resp := new(Resp)
-	defer func() {
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
 		JSONL(c, 200, nil, resp)
+		return
+	}
+
+	uid := uu.Id
+	ListCommentHelper(c, uid)
+}
+
+func ListCommentAdmin(c *gin.Context) {
+	ListCommentHelper(c, 0)
+}
+
+func ListCommentHelper(c *gin.Context, userId int) {
+	resp := new(Resp)
+
+	respResult := new(ListCommentResponse)
+	req := new(ListCommentRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
 	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	// new query list session
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	// comment list where prepare
+	session.Table(new(model.Comment)).Where("1=1")
+
+	// query prepare
+	if req.Id != 0 {
+		session.And("id=?", req.Id)
+	}
+
+	if userId != 0 {
+		if req.Type == 0 {
+			session.And("object_user_id=?", userId)
+		} else if req.Type == 1 {
+			session.And("user_id=?", userId)
+		} else {
+			session.And("user_id=? or object_user_id=?", userId, userId)
+		}
+	} else {
+		if req.UserId != 0 {
+			session.And("user_id=?", req.UserId)
+		}
+		if req.ObjectUserId != 0 {
+			session.And("object_user_id=?", req.ObjectUserId)
+		}
+	}
+
+	if req.ContentId != 0 {
+		session.And("object_id=?", req.ContentId)
+	}
+
+	if req.CommentId != 0 {
+		session.And("comment_id=?", req.CommentId)
+	}
+
+	if req.RootCommentId != 0 {
+		session.And("root_comment_id=?", req.RootCommentId)
+	}
+
+	if req.Status != -1 {
+		session.And("status=?", req.Status)
+	}
+
+	if req.CreateTimeBegin > 0 {
+		session.And("create_time>=?", req.CreateTimeBegin)
+	}
+
+	if req.CreateTimeEnd > 0 {
+		session.And("create_time<?", req.CreateTimeEnd)
+	}
+
+	// count num
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("ListComment err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// if count>0 start list
+	cs := make([]model.Comment, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		// sql build
+		p.build(session, req.Sort, model.CommentSortName)
+		// do query
+		err = session.Find(&cs)
+		if err != nil {
+			flog.Log.Errorf("ListComment err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	// result
+	respResult.Comments = cs
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 列出等待自己审核的评论，跨所有内容
+type ListReviewCommentRequest struct {
+	ContentId       int      `json:"content_id"`
+	UserId          int      `json:"user_id"`
+	CreateTimeBegin int64    `json:"create_time_begin"`
+	CreateTimeEnd   int64    `json:"create_time_end"`
+	Sort            []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+func ListReviewComment(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(ListCommentResponse)
+	req := new(ListReviewCommentRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListReviewComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListReviewComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Comment)).Where("object_user_id=?", uu.Id).And("status=?", 0)
+
+	if req.ContentId != 0 {
+		session.And("object_id=?", req.ContentId)
+	}
+
+	if req.UserId != 0 {
+		session.And("user_id=?", req.UserId)
+	}
+
+	if req.CreateTimeBegin > 0 {
+		session.And("create_time>=?", req.CreateTimeBegin)
+	}
+
+	if req.CreateTimeEnd > 0 {
+		session.And("create_time<?", req.CreateTimeEnd)
+	}
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("ListReviewComment err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	cs := make([]model.Comment, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.CommentSortName)
+		err = session.Find(&cs)
+		if err != nil {
+			flog.Log.Errorf("ListReviewComment err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	respResult.Comments = cs
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 批量审核评论，1通过，3拒绝
+type ReviewCommentRequest struct {
+	Ids    []int `json:"ids" validate:"required,dive,required"`
+	Status int   `json:"status" validate:"oneof=1 3"`
+}
+
+func ReviewComment(c *gin.Context) {
+	resp := new(Resp)
+	req := new(ReviewCommentRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ReviewComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ReviewComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	// 审核通过的回复需要通知被回复的人，先找出来
+	replies := make([]model.Comment, 0)
+	if req.Status == 1 {
+		err = config.FafaRdb.Client.In("id", req.Ids).And("object_user_id=?", uu.Id).And("status=?", 0).And("comment_id!=?", 0).Find(&replies)
+		if err != nil {
+			flog.Log.Errorf("ReviewComment err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	// 不是自己内容下的，或者已经审核过的，会被忽略
+	comment := new(model.Comment)
+	comment.ObjectUserId = uu.Id
+	comment.Status = req.Status
+	num, err := comment.Review(req.Ids)
+	if err != nil {
+		flog.Log.Errorf("ReviewComment err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if len(replies) > 0 {
+		contentIds := make([]int, 0, len(replies))
+		for _, v := range replies {
+			contentIds = append(contentIds, v.ObjectId)
+		}
+
+		contents := make(map[int]model.Content)
+		err = config.FafaRdb.Client.Cols("id", "title").In("id", contentIds).Find(&contents)
+		if err != nil {
+			flog.Log.Errorf("ReviewComment err: %s", err.Error())
+		}
+
+		// 内容所有者在评论等待审核时已经通知过了，只需要通知被回复的人
+		for _, v := range replies {
+			sendMessage(v.UserId, v.CommentUserId, model.MessageTypeReply, v.ObjectId, v.Id, fmt.Sprintf("new reply in: %s", contents[v.ObjectId].Title))
+		}
+	}
+
+	resp.Data = num
+	resp.Flag = true
+}
+
+// 每篇内容下等待审核的评论数量
+type CountReviewCommentRequest struct {
+	Sort []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type CountReviewCommentX struct {
+	ContentId    int    `json:"content_id"`
+	ContentTitle string `json:"content_title"`
+	Num          int64  `json:"num"`
+}
+
+type CountReviewCommentResponse struct {
+	Contents []CountReviewCommentX `json:"contents"`
+	PageHelp
+}
+
+var countReviewCommentSortName = []string{"-num", "=object_id"}
+
+func CountReviewComment(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(CountReviewCommentResponse)
+	req := new(CountReviewCommentRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("CountReviewComment err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CountReviewComment err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Comment)).Where("object_user_id=?", uu.Id).And("status=?", 0)
+
+	// 有多少篇内容有待审核评论
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Select("count(DISTINCT object_id)").Count()
+	if err != nil {
+		flog.Log.Errorf("CountReviewComment err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	type countX struct {
+		ObjectId int
+		Num      int64
+	}
+
+	nums := make([]countX, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, countReviewCommentSortName)
+		err = session.Select("object_id, count(id) as num").GroupBy("object_id").Find(&nums)
+		if err != nil {
+			flog.Log.Errorf("CountReviewComment err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	titles := make(map[int]string)
+	if len(nums) > 0 {
+		contentIds := make([]int, 0, len(nums))
+		for _, v := range nums {
+			contentIds = append(contentIds, v.ObjectId)
+		}
+
+		cs := make([]model.Content, 0)
+		err = config.FafaRdb.Client.Cols("id", "title", "pre_title").In("id", contentIds).Find(&cs)
+		if err != nil {
+			flog.Log.Errorf("CountReviewComment err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		for _, v := range cs {
+			titles[v.Id] = v.Title
+			if v.Title == "" {
+				titles[v.Id] = v.PreTitle
+			}
+		}
+	}
+
+	back := make([]CountReviewCommentX, 0, len(nums))
+	for _, v := range nums {
+		back = append(back, CountReviewCommentX{ContentId: v.ObjectId, ContentTitle: titles[v.ObjectId], Num: v.Num})
+	}
+
+	respResult.Contents = back
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 前端展示的评论
+type CommentX struct {
+	Id              int        `json:"id"`
+	UserId          int        `json:"user_id"`
+	UserName        string     `json:"user_name"`
+	NickName        string     `json:"nick_name"`
+	HeadPhoto       string     `json:"head_photo"`
+	CommentId       int        `json:"comment_id,omitempty"`
+	CommentUserId   int        `json:"comment_user_id,omitempty"`
+	CommentUserName string     `json:"comment_user_name,omitempty"`
+	Describe        string     `json:"describe"`
+	CreateTime      string     `json:"create_time"`
+	CreateTimeInt   int64      `json:"create_time_int"`
+	Good            int64      `json:"good"`
+	Bad             int64      `json:"bad"`
+	Son             []CommentX `json:"son,omitempty"`
+	SonNum          int64      `json:"son_num,omitempty"` // 楼层下回复的总数，son 只带最新的几条
+}
+
+// 每层楼最多带多少条回复，其他的按 root_comment_id 分页列出
+const commentSonNum = 5
+
+type CommentsRequest struct {
+	ContentId int      `json:"content_id" validate:"required"`
+	Password  string   `json:"password"`
+	Sort      []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type CommentsResponse struct {
+	Comments []CommentX `json:"comments"`
+	PageHelp
+}
+
+// 列出内容下的评论，按楼层分页，楼层下带上最新的几条回复和回复总数
+func Comments(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(CommentsResponse)
+	req := new(CommentsRequest)
+	defer func() {
+		JSON(c, 200, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Comments err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	content, errResp := getPublicContent(req.ContentId, req.Password)
+	if errResp != nil {
+		flog.Log.Errorf("Comments err: %s", errResp.Error())
+		resp.Error = errResp
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	// 只列出正常的顶层评论
+	session.Table(new(model.Comment)).Where("object_id=?", content.Id).And("status=?", 1).And("root_comment_id=?", 0)
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("Comments err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	floors := make([]model.Comment, 0)
+	sons := make([]model.Comment, 0)
+	sonNum := make(map[int]int64)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.CommentSortName)
+		err = session.Find(&floors)
+		if err != nil {
+			flog.Log.Errorf("Comments err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		rootIds := make([]int, 0, len(floors))
+		for _, v := range floors {
+			rootIds = append(rootIds, v.Id)
+		}
+
+		counts := make([]commentSonCount, 0)
+		err = config.FafaRdb.Client.Table(new(model.Comment)).Select("root_comment_id, count(id) as num").
+			In("root_comment_id", rootIds).And("status=?", 1).GroupBy("root_comment_id").Find(&counts)
+		if err != nil {
+			flog.Log.Errorf("Comments err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		for _, v := range counts {
+			sonNum[v.RootCommentId] = v.Num
+		}
+
+		// 热门的楼层回复可能很多，每层只取最新的几条
+		for _, id := range rootIds {
+			if sonNum[id] == 0 {
+				continue
+			}
+
+			temp := make([]model.Comment, 0)
+			err = config.FafaRdb.Client.Where("root_comment_id=?", id).And("status=?", 1).Desc("create_time", "id").Limit(commentSonNum).Find(&temp)
+			if err != nil {
+				flog.Log.Errorf("Comments err:%s", err.Error())
+				resp.Error = Error(DBError, err.Error())
+				return
+			}
+
+			for i := len(temp) - 1; i >= 0; i-- {
+				sons = append(sons, temp[i])
+			}
+		}
+	}
+
+	// 评论者的信息
+	userIds := make([]int, 0)
+	for _, v := range floors {
+		userIds = append(userIds, v.UserId)
+	}
+	for _, v := range sons {
+		userIds = append(userIds, v.UserId, v.CommentUserId)
+	}
+
+	users := make(map[int]model.User)
+	if len(userIds) > 0 {
+		us := make([]model.User, 0)
+		err = config.FafaRdb.Client.Cols("id", "name", "nick_name", "head_photo").In("id", userIds).Find(&us)
+		if err != nil {
+			flog.Log.Errorf("Comments err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+		for _, v := range us {
+			users[v.Id] = v
+		}
+	}
+
+	back := make([]CommentX, 0, len(floors))
+	for _, v := range floors {
+		f := commentX(v, users)
+		f.SonNum = sonNum[v.Id]
+		for _, vv := range sons {
+			if vv.RootCommentId == v.Id {
+				f.Son = append(f.Son, commentX(vv, users))
+			}
+		}
+		back = append(back, f)
+	}
+
+	respResult.Comments = back
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+type commentSonCount struct {
+	RootCommentId int
+	Num           int64
+}
+
+func commentX(v model.Comment, users map[int]model.User) CommentX {
+	x := CommentX{}
+	x.Id = v.Id
+	x.UserId = v.UserId
+	x.UserName = users[v.UserId].Name
+	x.NickName = users[v.UserId].NickName
+	x.HeadPhoto = users[v.UserId].HeadPhoto
+	x.CommentId = v.CommentId
+	x.CommentUserId = v.CommentUserId
+	if v.CommentUserId != 0 {
+		x.CommentUserName = users[v.CommentUserId].Name
+	}
+	x.Describe = v.Describe
+	x.CreateTime = GetSecond2DateTimes(v.CreateTime)
+	x.CreateTimeInt = v.CreateTime
+	x.Good = v.Good
+	x.Bad = v.Bad
+	return x
 }
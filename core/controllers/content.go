@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"github.com/hunterhug/fafacms/core/config"
@@ -11,15 +12,16 @@ import (
 
 // 创建内容
 type CreateContentRequest struct {
-	Seo          string `json:"seo" validate:"omitempty,alphanumunicode,gt=3,lt=30"` // 内容应该有个好听的标志
-	Title        string `json:"title" validate:"required,lt=100"`                    // 必须有标题吧
-	Status       int    `json:"status" validate:"oneof=0 1"`                         // 隐藏内容，1就是隐藏
-	Top          int    `json:"top" validate:"oneof=0 1"`                            // 置顶，1就是置顶
-	Describe     string `json:"describe" validate:"omitempty"`                       // 正文
-	ImagePath    string `json:"image_path" validate:"omitempty,lt=100"`              // 内容背景图
-	NodeId       int    `json:"node_id"`                                             // 内容所属节点，可以没有节点
-	Password     string `json:"password"`                                            // 如果非空表示需要密码
-	CloseComment int    `json:"close_comment" validate:"oneof=0 1 2"`                // 评论设置，0关闭评论，1打开评论需要审核，2打开评论不需要审核
+	Seo          string   `json:"seo" validate:"omitempty,alphanumunicode,gt=3,lt=30"` // 内容应该有个好听的标志
+	Title        string   `json:"title" validate:"required,lt=100"`                    // 必须有标题吧
+	Status       int      `json:"status" validate:"oneof=0 1"`                         // 隐藏内容，1就是隐藏
+	Top          int      `json:"top" validate:"oneof=0 1"`                            // 置顶，1就是置顶
+	Describe     string   `json:"describe" validate:"omitempty"`                       // 正文
+	ImagePath    string   `json:"image_path" validate:"omitempty,lt=100"`              // 内容背景图
+	NodeId       int      `json:"node_id"`                                             // 内容所属节点，可以没有节点
+	Password     string   `json:"password"`                                            // 如果非空表示需要密码
+	CloseComment int      `json:"close_comment" validate:"oneof=0 1 2"`                // 评论设置，0关闭评论，1打开评论需要审核，2打开评论不需要审核
+	Tags         []string `json:"tags" validate:"lt=11,dive,required,lt=30"`           // 标签，最多十个
 }
 
 func CreateContent(c *gin.Context) {
@@ -124,6 +126,16 @@ func CreateContent(c *gin.Context) {
 		return
 	}
 
+	if len(req.Tags) > 0 {
+		err = model.SetContentTags(content.Id, uu.Id, req.Tags)
+		if err != nil {
+			flog.Log.Errorf("CreateContent err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+		content.Tags = model.CleanTagNames(req.Tags)
+	}
+
 	resp.Data = content
 	resp.Flag = true
 }
@@ -326,6 +338,7 @@ func UpdateStatusOfContentAdmin(c *gin.Context) {
 
 	content := new(model.Content)
 	content.Id = req.Id
+	content.UserId = contentBefore.UserId
 	if req.Status != contentBefore.Status {
 		content.Status = req.Status
 		_, err = content.UpdateStatus()
@@ -334,6 +347,16 @@ func UpdateStatusOfContentAdmin(c *gin.Context) {
 			resp.Error = Error(DBError, err.Error())
 			return
 		}
+
+		// 被管理员封禁要通知作者
+		if req.Status == 2 {
+			uu, _ := GetUserSession(c)
+			sendUserId := 0
+			if uu != nil {
+				sendUserId = uu.Id
+			}
+			sendMessage(sendUserId, contentBefore.UserId, model.MessageTypeContentBan, contentBefore.Id, 0, fmt.Sprintf("content be ban: %s", contentBefore.Title))
+		}
 	}
 	resp.Flag = true
 }
@@ -627,9 +650,10 @@ func UpdatePasswordOfContent(c *gin.Context) {
 
 // 更新内容标题和具体内容
 type UpdateInfoOfContentRequest struct {
-	Id       int    `json:"id" validate:"required"`
-	Title    string `json:"title" validate:"required,lt=100"`
-	Describe string `json:"describe" validate:"omitempty"`
+	Id       int      `json:"id" validate:"required"`
+	Title    string   `json:"title" validate:"required,lt=100"`
+	Describe string   `json:"describe" validate:"omitempty"`
+	Tags     []string `json:"tags" validate:"lt=11,dive,required,lt=30"` // 不传表示不修改标签，传空数组表示清空标签
 }
 
 func UpdateInfoOfContent(c *gin.Context) {
@@ -691,6 +715,15 @@ func UpdateInfoOfContent(c *gin.Context) {
 			return
 		}
 	}
+
+	if req.Tags != nil {
+		err = model.SetContentTags(req.Id, uu.Id, req.Tags)
+		if err != nil {
+			flog.Log.Errorf("UpdateInfoOfContent err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
 	resp.Flag = true
 }
 
@@ -1317,6 +1350,14 @@ func TakeContentHelper(c *gin.Context, userId int) {
 		return
 	}
 
+	tags, err := model.GetContentsTags([]int{content.Id})
+	if err != nil {
+		flog.Log.Errorf("TakeContent err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	content.Tags = tags[content.Id]
 	resp.Data = content
 	resp.Flag = true
 }
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util/markdown"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 订阅中的内容数量
+const feedItemNum = 20
+
+const siteName = "FaFa CMS"
+
+// 前端页面地址约定：
+// 用户主页 /u/用户名，节点 /u/用户名/节点SEO，内容 /u/用户名/c/内容SEO或ID
+func siteUrl() string {
+	return strings.TrimRight(config.FafaConfig.Domain, "/")
+}
+
+func userUrl(userName string) string {
+	return fmt.Sprintf("%s/u/%s", siteUrl(), url.PathEscape(userName))
+}
+
+func nodeUrl(userName string, nodeSeo string) string {
+	return fmt.Sprintf("%s/%s", userUrl(userName), url.PathEscape(nodeSeo))
+}
+
+func contentUrl(c *model.Content) string {
+	if c.Seo != "" {
+		return fmt.Sprintf("%s/c/%s", userUrl(c.UserName), url.PathEscape(c.Seo))
+	}
+	return fmt.Sprintf("%s/c/%d", userUrl(c.UserName), c.Id)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Guid        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	Id        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+// 全站 RSS
+func FeedRss(c *gin.Context) {
+	feedHelper(c, false, false)
+}
+
+// 全站 Atom
+func FeedAtom(c *gin.Context) {
+	feedHelper(c, false, true)
+}
+
+// 用户或节点 RSS，需要 user_name，node_seo 可选
+func UserFeedRss(c *gin.Context) {
+	feedHelper(c, true, false)
+}
+
+// 用户或节点 Atom，需要 user_name，node_seo 可选
+func UserFeedAtom(c *gin.Context) {
+	feedHelper(c, true, true)
+}
+
+func feedHelper(c *gin.Context, isUser bool, isAtom bool) {
+	title := siteName
+	link := siteUrl()
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	// 只订阅已经发布的正常内容，有密码的不要
+	session.Table(new(model.Content)).Where("status=?", 0).And("version>?", 0).And("password=?", "")
+
+	if isUser {
+		userName := c.Query("user_name")
+		if userName == "" {
+			c.String(http.StatusBadRequest, "user_name empty")
+			return
+		}
+
+		user := new(model.User)
+		exist, err := config.FafaRdb.Client.Where("name=?", userName).And("status=?", 1).Get(user)
+		if err != nil {
+			flog.Log.Errorf("FeedXml err: %s", err.Error())
+			c.String(http.StatusInternalServerError, "")
+			return
+		}
+
+		if !exist {
+			c.String(http.StatusNotFound, "user not found")
+			return
+		}
+
+		title = fmt.Sprintf("%s - %s", user.NickName, siteName)
+		link = userUrl(user.Name)
+		session.And("user_id=?", user.Id)
+
+		nodeSeo := c.Query("node_seo")
+		if nodeSeo != "" {
+			node := new(model.ContentNode)
+			exist, err := config.FafaRdb.Client.Where("user_id=?", user.Id).And("seo=?", nodeSeo).And("status=?", 0).Get(node)
+			if err != nil {
+				flog.Log.Errorf("FeedXml err: %s", err.Error())
+				c.String(http.StatusInternalServerError, "")
+				return
+			}
+
+			if !exist {
+				c.String(http.StatusNotFound, "node not found")
+				return
+			}
+
+			title = fmt.Sprintf("%s - %s - %s", node.Name, user.NickName, siteName)
+			link = nodeUrl(user.Name, node.Seo)
+			session.And("node_id=?", node.Id)
+		}
+	}
+
+	cs := make([]model.Content, 0)
+	err := session.Omit("pre_describe").Desc("publish_time").Limit(feedItemNum).Find(&cs)
+	if err != nil {
+		flog.Log.Errorf("FeedXml err: %s", err.Error())
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+
+	// 最近一次发布的时间就是订阅的修改时间
+	var lastModified int64 = 0
+	if len(cs) > 0 {
+		lastModified = cs[0].PublishTime
+	}
+
+	if lastModified > 0 {
+		if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && lastModified <= since.Unix() {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Header("Last-Modified", time.Unix(lastModified, 0).UTC().Format(http.TimeFormat))
+	}
+
+	var out interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if isAtom {
+		contentType = "application/atom+xml; charset=utf-8"
+		feed := atomFeed{
+			Title:   title,
+			Id:      link,
+			Updated: time.Unix(lastModified, 0).UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: link}, {Href: siteUrl() + c.Request.URL.RequestURI(), Rel: "self"}},
+		}
+		for k := range cs {
+			v := &cs[k]
+			u := contentUrl(v)
+			feed.Entries = append(feed.Entries, atomEntry{
+				Title:     v.Title,
+				Id:        u,
+				Link:      atomLink{Href: u},
+				Published: time.Unix(v.CreateTime, 0).UTC().Format(time.RFC3339),
+				Updated:   time.Unix(v.PublishTime, 0).UTC().Format(time.RFC3339),
+				Author:    atomAuthor{Name: v.UserName, Uri: userUrl(v.UserName)},
+				Content:   atomContent{Type: "html", Body: markdown.ToHTML(v.Describe)},
+			})
+		}
+		out = feed
+	} else {
+		feed := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:       title,
+				Link:        link,
+				Description: title,
+			},
+		}
+		if lastModified > 0 {
+			feed.Channel.LastBuildDate = time.Unix(lastModified, 0).UTC().Format(time.RFC1123Z)
+		}
+		for k := range cs {
+			v := &cs[k]
+			u := contentUrl(v)
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       v.Title,
+				Link:        u,
+				Guid:        u,
+				PubDate:     time.Unix(v.PublishTime, 0).UTC().Format(time.RFC1123Z),
+				Description: markdown.ToHTML(v.Describe),
+			})
+		}
+		out = feed
+	}
+
+	raw, err := xml.Marshal(out)
+	if err != nil {
+		flog.Log.Errorf("FeedXml err: %s", err.Error())
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), raw...))
+}
@@ -4,17 +4,13 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
+	"github.com/go-xorm/xorm"
 	"github.com/hunterhug/fafacms/core/config"
 	. "github.com/hunterhug/fafacms/core/flog"
 	"github.com/hunterhug/fafacms/core/model"
-	"github.com/hunterhug/fafacms/core/util/oss"
-	"github.com/hunterhug/go_image"
-	"github.com/hunterhug/parrot/util"
-	"io/ioutil"
 	"math"
-	"path/filepath"
+	"net/http"
 	"strings"
-	"time"
 	myutil "github.com/hunterhug/fafacms/core/util"
 )
 
@@ -23,26 +19,26 @@ var FileAllow = map[string][]string{
 	"image": {
 		"jpg", "jpeg", "png", "gif"},
 	"flash": {
-		"swf", "flv"},
+		"flv"},
 	"media": {
-		"swf", "flv", "mp3", "wav", "wma", "wmv", "mid", "avi", "mpg", "asf", "rm", "rmvb"},
+		"flv", "mp3", "wav", "wma", "wmv", "mid", "avi", "mpg", "asf", "rm", "rmvb"},
 	"file": {
-		"doc", "docx", "xls", "xlsx", "ppt", "htm", "html", "txt", "zip", "rar", "gz", "bz2", "pdf"},
+		"doc", "docx", "xls", "xlsx", "ppt", "txt", "zip", "rar", "gz", "bz2", "pdf"},
 	"other": {
-		"jpg", "jpeg", "png", "bmp", "gif", "swf", "flv", "mp3",
+		"jpg", "jpeg", "png", "bmp", "gif", "flv", "mp3",
 		"wav", "wma", "wmv", "mid", "avi", "mpg", "asf", "rm", "rmvb",
-		"doc", "docx", "xls", "xlsx", "ppt", "htm", "html", "txt", "zip", "rar", "gz", "bz2"}}
-
-var FileBytes = 1 << 25 // (1<<25)/1000.0/1000.0 33.54 不能超出33M
+		"doc", "docx", "xls", "xlsx", "ppt", "txt", "zip", "rar", "gz", "bz2"}}
 
 type UploadResponse struct {
-	FileName  string `json:"file_name"`
-	Size      int64  `json:"size"`
-	Url       string `json:"url"`
-	Url_X     string `json:"url_x"`
-	IsPicture bool   `json:"is_picture"`
-	Addon     string `json:"addon"`
-	Oss       bool   `json:"oss"`
+	FileName  string            `json:"file_name"`
+	Size      int64             `json:"size"`
+	Url       string            `json:"url"`
+	Url_X     string            `json:"url_x"`
+	Thumbs    map[string]string `json:"thumbs"` // 缩略图的名字到地址，开启了 webp 的还有 名字.webp
+	IsPicture bool              `json:"is_picture"`
+	Addon     string            `json:"addon"`
+	Oss       bool              `json:"oss"`
+	StoreType int               `json:"store_type"`
 }
 
 /*
@@ -52,7 +48,6 @@ type UploadResponse struct {
 */
 func UploadFile(c *gin.Context) {
 	resp := new(Resp)
-	data := UploadResponse{}
 	defer func() {
 		JSONL(c, 200, nil, resp)
 	}()
@@ -64,7 +59,8 @@ func UploadFile(c *gin.Context) {
 		return
 	}
 
-	uName := uu.Name
+	// 请求体不能超过最大的限制，超出的部分不会写到磁盘
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileBytes()+1<<20)
 
 	fileType := c.DefaultPostForm("type", "other")
 	if fileType == "" {
@@ -84,21 +80,13 @@ func UploadFile(c *gin.Context) {
 		return
 	}
 
-	fileAllowArray, ok := FileAllow[fileType]
-	if !ok {
-		Log.Errorf("upload err: type not permit")
-		resp.Error = Error(UploadFileTypeNotPermit, "")
-		return
-	}
-
-	fileSuffix := util.GetFileSuffix(h.Filename)
-	if !util.InArray(fileAllowArray, fileSuffix) {
-		Log.Errorf("upload err: file suffix: %s not permit", fileSuffix)
-		resp.Error = Error(UploadFileTypeNotPermit, fmt.Sprintf("file suffix: %s not permit", fileSuffix))
+	fileSuffix, limit, errResp := checkUploadType(fileType, h.Filename)
+	if errResp != nil {
+		resp.Error = errResp
 		return
 	}
 
-	if h.Size > int64(FileBytes) {
+	if h.Size > limit {
 		Log.Errorf("upload err: file size too big: %d", h.Size)
 		resp.Error = Error(UploadFileTooMaxLimit, fmt.Sprintf(" file size too big: %d", h.Size))
 		return
@@ -114,157 +102,28 @@ func UploadFile(c *gin.Context) {
 
 	defer f.Close()
 
-	// 读取二进制
-	raw, err := ioutil.ReadAll(f)
-	if err != nil {
-		Log.Errorf("upload err:%s", err.Error())
-		resp.Error = Error(UploadFileError, err.Error())
-		return
-	}
-
-	// 二进制空那么报错
-	fileSize := len(raw)
-	if fileSize == 0 {
-		Log.Errorf("upload err:%s", "file empty")
-		resp.Error = Error(UploadFileError, "file empty")
-		return
-	}
-
-	// HashCode
-	fileHashCode, err := myutil.Sha256(raw)
-	if err != nil {
-		Log.Errorf("upload err:%s", err.Error())
-		resp.Error = Error(UploadFileError, err.Error())
+	// 流式写到临时文件，同时计算哈希
+	tmp, size, hash, errResp := spoolUpload(f, limit)
+	if errResp != nil {
+		resp.Error = errResp
 		return
 	}
 
-	// MD5需要再加上用户唯一标志，方便不同用户可以上传一样的文件
-	fileHashCode = uName + "_" + fileHashCode
-	fileName := fileHashCode + "." + fileSuffix
+	defer removeTemp(tmp)
 
-	// 判断数据库文件是否存在
-	p := new(model.File)
-	p.HashCode = fileHashCode
-	exist, err := p.Get()
-	if err != nil {
-		resp.Error = Error(DBError, err.Error())
+	data, errResp := storeUpload(uu, uploadMeta{
+		Type:     fileType,
+		Tag:      tag,
+		Describe: describe,
+		RealName: h.Filename,
+		Suffix:   fileSuffix,
+	}, tmp, size, hash)
+	if errResp != nil {
+		resp.Error = errResp
 		return
 	}
 
-	// 文件不存在
-	helpPath := fmt.Sprintf("storage/%s/%s", uName, fileType)
-	if !exist {
-		fileDir := filepath.Join(config.FafaConfig.DefaultConfig.StoragePath, uName, fileType)
-		fileAbName := filepath.Join(fileDir, fileName)
-
-		// 本地存储模式
-		if config.FafaConfig.DefaultConfig.StorageOss != true {
-			// 磁盘模式
-			err := util.MakeDir(fileDir)
-			if err != nil {
-				Log.Errorf("upload err:%s", err.Error())
-				resp.Error = Error(UploadFileError, err.Error())
-				return
-			}
-
-			err = util.SaveToFile(fileAbName, raw)
-			if err != nil {
-				Log.Errorf("upload err:%s", err.Error())
-				resp.Error = Error(UploadFileError, err.Error())
-				return
-			}
-
-			p.Url = fmt.Sprintf("/%s/%s", helpPath, fileName)
-		} else {
-			// 阿里OSS模式
-			p.StoreType = 1
-			p.Url = fmt.Sprintf("%s.%s/%s/%s", config.FafaConfig.OssConfig.BucketName, config.FafaConfig.OssConfig.Endpoint, helpPath, fileName)
-			err = oss.SaveFile(config.FafaConfig.OssConfig, p.Url, raw)
-			if err != nil {
-				Log.Errorf("upload err:%s", err.Error())
-				resp.Error = Error(UploadFileError, err.Error())
-				return
-			}
-		}
-
-		p.UrlHashCode, _ = myutil.Sha256([]byte(p.Url))
-
-		// 如果是图片进行裁剪
-		if util.InArray(scaleType, fileSuffix) {
-			p.IsPicture = 1
-
-			// 本地存储模式，裁剪图静态路径为  /storage_x
-			if config.FafaConfig.DefaultConfig.StorageOss != true {
-				fileScaleDir := filepath.Join(config.FafaConfig.DefaultConfig.StoragePath+"_x", uName, fileType)
-				fileScaleAbName := filepath.Join(fileScaleDir, fileName)
-
-				// 裁剪
-				err = util.MakeDir(fileScaleDir)
-				if err != nil {
-					Log.Errorf("upload err:%s", err.Error())
-					resp.Error = Error(UploadFileError, err.Error())
-					return
-				}
-				err := go_image.ScaleF2F(fileAbName, fileScaleAbName, 100)
-				if err != nil {
-					Log.Errorf("upload err:%s", err.Error())
-					resp.Error = Error(UploadFileError, err.Error())
-					return
-				}
-			} else {
-				// 阿里OSS模式
-				outRaw, err := go_image.ScaleB2B(raw, 100)
-				if err != nil {
-					Log.Errorf("upload err:%s", err.Error())
-					resp.Error = Error(UploadFileError, err.Error())
-					return
-				}
-
-				err = oss.SaveFile(config.FafaConfig.OssConfig, strings.Replace(helpPath, "storage/", "storage_x/", -1)+"/"+fileName, outRaw)
-				if err != nil {
-					Log.Errorf("upload err:%s", err.Error())
-					resp.Error = Error(UploadFileError, err.Error())
-					return
-				}
-			}
-		}
-
-		p.Type = fileType
-		p.FileName = fileName
-		p.ReallyFileName = h.Filename
-		p.CreateTime = time.Now().Unix()
-		p.Describe = describe
-		p.UserId = uu.Id
-		p.UserName = uName
-		p.Tag = tag
-		p.Size = int64(fileSize)
-		_, err = config.FafaRdb.InsertOne(p)
-		if err != nil {
-			Log.Errorf("upload err:%s", err.Error())
-			resp.Error = Error(DBError, err.Error())
-			return
-		}
-	} else {
-		// 文件存在
-		data.Addon = "file the same in server"
-		if p.Status != 0 {
-			// 如果被隐藏了额，应该改回来
-			p.Status = 0
-			p.UpdateStatus()
-		}
-	}
-
-	// 返回基本信息
-	data.FileName = p.FileName
-	data.IsPicture = p.IsPicture == 1
-	data.Size = p.Size
-	data.Url = p.Url
-	data.Oss = p.StoreType == 1
 	resp.Data = data
-	if data.IsPicture {
-		data.Url_X = strings.Replace(p.Url, "/storage", "/storage_x", -1)
-	}
-
 	resp.Flag = true
 	return
 }
@@ -279,7 +138,7 @@ type ListFileAdminRequest struct {
 	Sort            []string `json:"sort" validate:"dive,lt=100"`
 	HashCode        string   `json:"hash_code"`
 	Url             string   `json:"url"`
-	StoreType       int      `json:"store_type" validate:"oneof=-1 0 1"`
+	StoreType       int      `json:"store_type" validate:"oneof=-1 0 1 2"`
 	Status          int      `json:"status" validate:"oneof=-1 0 1"`
 	Type            string   `json:"type"`
 	Tag             string   `json:"tag"`
@@ -294,36 +153,8 @@ type ListFileAdminResponse struct {
 	PageHelp
 }
 
-func ListFileAdminHelper(c *gin.Context, userId int) {
-	resp := new(Resp)
-
-	respResult := new(ListFileAdminResponse)
-	req := new(ListFileAdminRequest)
-	defer func() {
-		JSONL(c, 200, req, resp)
-	}()
-
-	if errResp := ParseJSON(c, req); errResp != nil {
-		resp.Error = errResp
-		return
-	}
-
-	var validate = validator.New()
-	err := validate.Struct(req)
-	if err != nil {
-		Log.Errorf("ListFileAdmin err: %s", err.Error())
-		resp.Error = Error(ParasError, err.Error())
-		return
-	}
-
-	// new query list session
-	session := config.FafaRdb.Client.NewSession()
-	defer session.Close()
-
-	// group list where prepare
-	session.Table(new(model.File)).Where("1=1")
-
-	// query prepare
+// 列文件和统计占用共用的查询条件，userId不为0时只查该用户的
+func fileAdminWhere(session *xorm.Session, req *ListFileAdminRequest, userId int) {
 	if req.Id != 0 {
 		session.And("id=?", req.Id)
 	}
@@ -370,7 +201,7 @@ func ListFileAdminHelper(c *gin.Context, userId int) {
 	}
 
 	if req.CreateTimeEnd > 0 {
-		session.And("create_time<?", req.CreateTimeBegin)
+		session.And("create_time<?", req.CreateTimeEnd)
 	}
 
 	if req.UpdateTimeBegin > 0 {
@@ -388,6 +219,39 @@ func ListFileAdminHelper(c *gin.Context, userId int) {
 	if req.SizeEnd > 0 {
 		session.And("size<?", req.SizeEnd)
 	}
+}
+
+func ListFileAdminHelper(c *gin.Context, userId int) {
+	resp := new(Resp)
+
+	respResult := new(ListFileAdminResponse)
+	req := new(ListFileAdminRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		Log.Errorf("ListFileAdmin err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	// new query list session
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	// group list where prepare
+	session.Table(new(model.File)).Where("1=1")
+
+	// query prepare
+	fileAdminWhere(session, req, userId)
 
 	// count num
 	countSession := session.Clone()
@@ -477,7 +341,7 @@ func UpdateFileAdminHelper(c *gin.Context, userId int) {
 	f.Describe = req.Describe
 	f.UserId = userId
 
-	// 更改文件，可以将文件设置为隐藏，文件一旦上传，不能删除
+	// 更改文件，可以将文件设置为隐藏，没有被引用的隐藏文件过段时间会被清理
 	ok, err := f.Update(req.Hide)
 	if err != nil {
 		Log.Errorf("UpdateFileAdmin err:%s", err.Error())
@@ -508,3 +372,99 @@ func UpdateFile(c *gin.Context) {
 	uid := uu.Id
 	UpdateFileAdminHelper(c, uid)
 }
+
+type DeleteFileRequest struct {
+	Id int `json:"id" validate:"required"`
+}
+
+// 删除文件，被头像、节点或者内容引用的不能删
+func DeleteFileAdminHelper(c *gin.Context, userId int) {
+	resp := new(Resp)
+	req := new(DeleteFileRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		Log.Errorf("DeleteFileAdmin err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	f := new(model.File)
+	f.Id = req.Id
+	f.UserId = userId
+	ok, err := f.Get()
+	if err != nil {
+		Log.Errorf("DeleteFileAdmin err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		Log.Errorf("DeleteFileAdmin err:%s", "file not found")
+		resp.Error = Error(FileCanNotBeFound, "")
+		return
+	}
+
+	refs, err := model.ListFileRef(f.Id)
+	if err != nil {
+		Log.Errorf("DeleteFileAdmin err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if len(refs) > 0 {
+		used := make([]string, 0, len(refs))
+		for _, r := range refs {
+			used = append(used, fmt.Sprintf("%s:%d", r.RefType, r.RefId))
+		}
+		Log.Errorf("DeleteFileAdmin err: file %d referenced by %v", f.Id, used)
+		resp.Error = Error(FileReferenced, strings.Join(used, ","))
+		return
+	}
+
+	// 删除时还会再判断一次引用，防止刚好被引用了
+	ok, err = f.Delete(false)
+	if err != nil {
+		Log.Errorf("DeleteFileAdmin err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		Log.Errorf("DeleteFileAdmin err: file %d referenced", f.Id)
+		resp.Error = Error(FileReferenced, "")
+		return
+	}
+
+	deleteFileObjects(f)
+	resp.Flag = true
+}
+
+// 删除其他人的文件，管理员权限
+func DeleteFileAdmin(c *gin.Context) {
+	DeleteFileAdminHelper(c, 0)
+}
+
+// 删除自己的文件
+func DeleteFile(c *gin.Context) {
+	resp := new(Resp)
+	uu, err := GetUserSession(c)
+	if err != nil {
+		Log.Errorf("DeleteFile err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		JSONL(c, 200, nil, resp)
+		return
+	}
+
+	uid := uu.Id
+	DeleteFileAdminHelper(c, uid)
+}
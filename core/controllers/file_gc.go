@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"time"
+)
+
+const fileGCBatchNum = 100
+
+// 开启后台清理没有被引用的隐藏文件
+func InitFileGC(conf config.FileGCConfig) {
+	if !conf.Enable {
+		return
+	}
+
+	if conf.GraceHour <= 0 {
+		conf.GraceHour = 72
+	}
+	if conf.IntervalHour <= 0 {
+		conf.IntervalHour = 24
+	}
+
+	go fileCollector(time.Duration(conf.GraceHour)*time.Hour, time.Duration(conf.IntervalHour)*time.Hour)
+}
+
+// 定时清理，每次先重建引用，防止漏记的引用导致误删
+func fileCollector(grace time.Duration, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		num, err := model.RebuildFileRef()
+		if err != nil {
+			flog.Log.Errorf("file gc err:%s", err.Error())
+			continue
+		}
+		flog.Log.Debugf("file gc rebuild %d refs", num)
+
+		num, err = collectFile(time.Now().Add(-grace).Unix())
+		if err != nil {
+			flog.Log.Errorf("file gc err:%s", err.Error())
+		}
+
+		if num > 0 {
+			flog.Log.Noticef("File gc delete %d files", num)
+		}
+	}
+}
+
+// 删掉在 before 之前隐藏的没有被引用的文件，返回删了多少
+func collectFile(before int64) (int, error) {
+	num, lastId := 0, 0
+	for {
+		fs, err := model.ListOrphanFile(before, lastId, fileGCBatchNum)
+		if err != nil {
+			return num, err
+		}
+
+		for i := range fs {
+			f := &fs[i]
+			ok, err := f.Delete(true)
+			if err != nil {
+				return num, err
+			}
+
+			if ok {
+				deleteFileObjects(f)
+				num++
+			}
+		}
+
+		if len(fs) < fileGCBatchNum {
+			return num, nil
+		}
+		lastId = fs[len(fs)-1].Id
+	}
+}
+
+// 删掉存储里的原图和所有缩略图，记录已经删了，失败只能记日志
+func deleteFileObjects(f *model.File) {
+	store, err := config.FafaStorage.Get(f.StoreType)
+	if err != nil {
+		flog.Log.Errorf("delete file %d objects err:%s", f.Id, err.Error())
+		return
+	}
+
+	keys := []string{f.Key()}
+	for _, key := range f.ThumbKeys() {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		err = store.Delete(key)
+		if err != nil {
+			flog.Log.Errorf("delete file %d object %s err:%s", f.Id, key, err.Error())
+		}
+	}
+}
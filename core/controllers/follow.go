@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
+)
+
+// 关注或取消关注某用户
+type FollowRequest struct {
+	UserId int `json:"user_id" validate:"required"`
+}
+
+func CreateFollow(c *gin.Context) {
+	resp := new(Resp)
+	req := new(FollowRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("CreateFollow err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CreateFollow err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	if uu.Id == req.UserId {
+		flog.Log.Errorf("CreateFollow err: %s", "can not follow self")
+		resp.Error = Error(FollowSelf, "")
+		return
+	}
+
+	// 只能关注激活的用户
+	user := new(model.User)
+	exist, err := config.FafaRdb.Client.Where("id=?", req.UserId).And("status=?", 1).Get(user)
+	if err != nil {
+		flog.Log.Errorf("CreateFollow err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("CreateFollow err: %s", "user not found")
+		resp.Error = Error(UserNotFound, "")
+		return
+	}
+
+	f := new(model.Follow)
+	f.UserId = uu.Id
+	f.FollowUserId = req.UserId
+	exist, err = f.Get()
+	if err != nil {
+		flog.Log.Errorf("CreateFollow err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if exist {
+		flog.Log.Errorf("CreateFollow err: %s", "follow repeat")
+		resp.Error = Error(FollowRepeat, "")
+		return
+	}
+
+	err = f.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("CreateFollow err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	sendMessage(uu.Id, req.UserId, model.MessageTypeFollow, uu.Id, 0, fmt.Sprintf("new follower: %s", uu.Name))
+
+	resp.Data = f
+	resp.Flag = true
+}
+
+func DeleteFollow(c *gin.Context) {
+	resp := new(Resp)
+	req := new(FollowRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("DeleteFollow err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("DeleteFollow err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	f := new(model.Follow)
+	f.UserId = uu.Id
+	f.FollowUserId = req.UserId
+	exist, err := f.Get()
+	if err != nil {
+		flog.Log.Errorf("DeleteFollow err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("DeleteFollow err: %s", "follow not found")
+		resp.Error = Error(FollowNotFound, "")
+		return
+	}
+
+	err = f.Delete()
+	if err != nil {
+		flog.Log.Errorf("DeleteFollow err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
+
+// 列出某用户的粉丝或关注的人
+type FollowsRequest struct {
+	UserId   int      `json:"user_id"`
+	UserName string   `json:"user_name"`
+	Sort     []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type FollowX struct {
+	People
+	FollowTime    string `json:"follow_time"`
+	FollowTimeInt int64  `json:"follow_time_int"`
+}
+
+type FollowsResponse struct {
+	Users []FollowX `json:"users"`
+	PageHelp
+}
+
+// 粉丝列表
+func Followers(c *gin.Context) {
+	FollowsHelper(c, true)
+}
+
+// 关注的人列表
+func Following(c *gin.Context) {
+	FollowsHelper(c, false)
+}
+
+func FollowsHelper(c *gin.Context, isFollower bool) {
+	resp := new(Resp)
+
+	respResult := new(FollowsResponse)
+	req := new(FollowsRequest)
+	defer func() {
+		JSON(c, 200, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Follows err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	if req.UserId == 0 && req.UserName == "" {
+		flog.Log.Errorf("Follows err: %s", "where is empty")
+		resp.Error = Error(ParasError, "where is empty")
+		return
+	}
+
+	user := new(model.User)
+	user.Id = req.UserId
+	user.Name = req.UserName
+	exist, err := config.FafaRdb.Client.Where("status=?", 1).Get(user)
+	if err != nil {
+		flog.Log.Errorf("Follows err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("Follows err: %s", "user not found")
+		resp.Error = Error(UserNotFound, "")
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Follow)).Where("1=1")
+
+	// 粉丝是关注了该用户的人，关注的人是该用户关注的人
+	if isFollower {
+		session.And("follow_user_id=?", user.Id)
+	} else {
+		session.And("user_id=?", user.Id)
+	}
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("Follows err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	fs := make([]model.Follow, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.FollowSortName)
+		err = session.Find(&fs)
+		if err != nil {
+			flog.Log.Errorf("Follows err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	userIds := make([]int, 0, len(fs))
+	for _, v := range fs {
+		if isFollower {
+			userIds = append(userIds, v.UserId)
+		} else {
+			userIds = append(userIds, v.FollowUserId)
+		}
+	}
+
+	users := make(map[int]model.User)
+	if len(userIds) > 0 {
+		err = config.FafaRdb.Client.In("id", userIds).And("status=?", 1).Find(&users)
+		if err != nil {
+			flog.Log.Errorf("Follows err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	// 保持关注时间的顺序，未激活或被拉黑的用户不展示
+	back := make([]FollowX, 0, len(fs))
+	for k, v := range fs {
+		u, ok := users[userIds[k]]
+		if !ok {
+			continue
+		}
+
+		x := FollowX{}
+		x.People = user2People(u)
+		x.FollowTime = GetSecond2DateTimes(v.CreateTime)
+		x.FollowTimeInt = v.CreateTime
+		back = append(back, x)
+	}
+
+	respResult.Users = back
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 关注的人发布的内容
+type FeedRequest struct {
+	Sort []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+func Feed(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(ContentsResponse)
+	req := new(FeedRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Feed err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("Feed err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	// 只列出已经发布的正常内容
+	session.Table(new(model.Content)).Where("1=1")
+	session.And("user_id in (select follow_user_id from fafacms_follow where user_id=?)", uu.Id)
+	session.And("status=?", 0).And("version>?", 0)
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("Feed err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	cs := make([]model.Content, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.FeedSortName)
+		err = session.Omit("describe", "pre_describe").Find(&cs)
+		if err != nil {
+			flog.Log.Errorf("Feed err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	bcs := make([]ContentsX, 0, len(cs))
+	for _, c := range cs {
+		bcs = append(bcs, content2ContentsX(c))
+	}
+
+	err = fillContentsTags(bcs)
+	if err != nil {
+		flog.Log.Errorf("Feed err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	respResult.Contents = bcs
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
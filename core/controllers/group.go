@@ -14,6 +14,7 @@ type CreateGroupRequest struct {
 	Name      string `json:"name" validate:"required,gt=5,lt=100"`
 	Describe  string `json:"describe" validate:"lt=100"`
 	ImagePath string `json:"image_path" validate:"lt=100"`
+	ParentId  int    `json:"parent_id" validate:"gte=0"` // 继承某个组的权限
 }
 
 func CreateGroup(c *gin.Context) {
@@ -73,6 +74,24 @@ func CreateGroup(c *gin.Context) {
 
 	}
 
+	if req.ParentId != 0 {
+		parent := new(model.Group)
+		parent.Id = req.ParentId
+		ok, err = parent.GetById()
+		if err != nil {
+			flog.Log.Errorf("CreateGroup err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if !ok {
+			flog.Log.Errorf("CreateGroup err: parent group not found")
+			resp.Error = Error(GroupNotFound, "parent group not found")
+			return
+		}
+		g.ParentId = req.ParentId
+	}
+
 	// insert now
 	g.Describe = req.Describe
 	g.CreateTime = time.Now().Unix()
@@ -82,6 +101,10 @@ func CreateGroup(c *gin.Context) {
 		resp.Error = Error(DBError, err.Error())
 		return
 	}
+
+	if g.ImagePath != "" {
+		model.SetFileRef(model.FileRefGroup, g.Id, g.ImagePath)
+	}
 	resp.Flag = true
 	resp.Data = g
 }
@@ -91,6 +114,8 @@ type UpdateGroupRequest struct {
 	Name      string `json:"name" validate:"lt=100"`
 	Describe  string `json:"describe" validate:"lt=100"`
 	ImagePath string `json:"image_path" validate:"lt=100"`
+	ForceTotp int    `json:"force_totp" validate:"oneof=0 1 2"` // 0不修改，1强制组下用户开启两步验证，2不强制
+	ParentId  int    `json:"parent_id" validate:"gte=-1"`       // 0不修改，-1取消继承，其他为继承的组
 }
 
 func UpdateGroup(c *gin.Context) {
@@ -181,6 +206,40 @@ func UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	if req.ParentId != 0 {
+		g.ParentId = 0
+		if req.ParentId > 0 {
+			errResp := checkGroupParent(g.Id, req.ParentId)
+			if errResp != nil {
+				flog.Log.Errorf("UpdateGroup err:%s", errResp.Error())
+				resp.Error = errResp
+				return
+			}
+			g.ParentId = req.ParentId
+		}
+
+		err = g.UpdateParent()
+		if err != nil {
+			flog.Log.Errorf("UpdateGroup err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	if req.ForceTotp != 0 {
+		g.ForceTotp = 0
+		if req.ForceTotp == 1 {
+			g.ForceTotp = 1
+		}
+
+		err = g.UpdateForceTotp()
+		if err != nil {
+			flog.Log.Errorf("UpdateGroup err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
 	resp.Flag = true
 	resp.Data = g
 }
@@ -243,9 +302,7 @@ func DeleteGroup(c *gin.Context) {
 	}
 
 	// user exist under group
-	u := new(model.User)
-	u.GroupId = temp.Id
-	ok, err = u.Exist()
+	ok, err = config.FafaRdb.Client.Where("group_id=?", temp.Id).Exist(new(model.UserGroup))
 	if err != nil {
 		flog.Log.Errorf("DeleteGroup err:%s", err.Error())
 		resp.Error = Error(DBError, err.Error())
@@ -258,6 +315,19 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	// 有组继承它时不能删除
+	ok, err = config.FafaRdb.Client.Where("parent_id=?", temp.Id).Exist(new(model.Group))
+	if err != nil {
+		flog.Log.Errorf("DeleteGroup err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+	if ok {
+		flog.Log.Errorf("DeleteGroup err:%s", "exist children")
+		resp.Error = Error(GroupHasChildren, "")
+		return
+	}
+
 	// delete group
 	g := new(model.Group)
 	g.Id = temp.Id
@@ -425,6 +495,7 @@ type ListGroupResourceRequest struct {
 
 type ListGroupResourceResponse struct {
 	Resources []int `json:"resources"`
+	Deny      []int `json:"deny"` // 显式拒绝的资源
 }
 
 // 列出组下的资源
@@ -465,11 +536,47 @@ func ListGroupResource(c *gin.Context) {
 	}
 
 	rs := make([]int, 0)
+	deny := make([]int, 0)
 	for _, v := range grs {
+		if v.Effect == model.EffectDeny {
+			deny = append(deny, v.ResourceId)
+			continue
+		}
 		rs = append(rs, v.ResourceId)
 	}
 
 	respResult.Resources = rs
+	respResult.Deny = deny
 	resp.Data = respResult
 	resp.Flag = true
 }
+
+// 父组要存在，且不能是自己或自己的子孙，防止继承成环
+func checkGroupParent(groupId, parentId int) *ErrorResp {
+	if groupId == parentId {
+		return Error(GroupParentWrong, "can not inherit self")
+	}
+
+	parent := new(model.Group)
+	parent.Id = parentId
+	ok, err := parent.GetById()
+	if err != nil {
+		return Error(DBError, err.Error())
+	}
+
+	if !ok {
+		return Error(GroupNotFound, "parent group not found")
+	}
+
+	ancestors, err := model.GroupAncestorIds(parentId)
+	if err != nil {
+		return Error(DBError, err.Error())
+	}
+
+	for _, id := range ancestors {
+		if id == groupId {
+			return Error(GroupParentWrong, "inherit loop")
+		}
+	}
+	return nil
+}
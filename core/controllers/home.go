@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"github.com/hunterhug/fafacms/core/config"
 	"github.com/hunterhug/fafacms/core/flog"
 	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util/markdown"
 	"github.com/hunterhug/parrot/util"
+	"github.com/patrickmn/go-cache"
 	"math"
 	"time"
 )
@@ -42,6 +45,29 @@ type People struct {
 	UpdateTime string `json:"update_time,omitempty"`
 }
 
+// 用户信息转为公开的信息
+func user2People(v model.User) People {
+	p := People{}
+	p.Id = v.Id
+	p.Describe = v.Describe
+	p.CreateTime = GetSecond2DateTimes(v.CreateTime)
+
+	if v.UpdateTime > 0 {
+		p.UpdateTime = GetSecond2DateTimes(v.UpdateTime)
+	}
+
+	p.Email = v.Email
+	p.Github = v.Github
+	p.Name = v.Name
+	p.NickName = v.NickName
+	p.HeadPhoto = v.HeadPhoto
+	p.QQ = v.QQ
+	p.WeChat = v.WeChat
+	p.WeiBo = v.WeiBo
+	p.Gender = v.Gender
+	return p
+}
+
 type PeoplesRequest struct {
 	Sort []string `json:"sort" validate:"dive,lt=100"`
 	PageHelp
@@ -96,25 +122,7 @@ func Peoples(c *gin.Context) {
 
 	peoples := make([]People, 0, len(users))
 	for _, v := range users {
-		p := People{}
-		p.Id = v.Id
-		p.Describe = v.Describe
-		p.CreateTime = GetSecond2DateTimes(v.CreateTime)
-
-		if v.UpdateTime > 0 {
-			p.UpdateTime = GetSecond2DateTimes(v.UpdateTime)
-		}
-
-		p.Email = v.Email
-		p.Github = v.Github
-		p.Name = v.Name
-		p.NickName = v.NickName
-		p.HeadPhoto = v.HeadPhoto
-		p.QQ = v.QQ
-		p.WeChat = v.WeChat
-		p.WeiBo = v.WeiBo
-		p.Gender = v.Gender
-		peoples = append(peoples, p)
+		peoples = append(peoples, user2People(v))
 	}
 	respResult.Users = peoples
 	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
@@ -420,25 +428,7 @@ func UserInfo(c *gin.Context) {
 		return
 	}
 
-	v := user
-	p := People{}
-	p.Id = v.Id
-	p.Describe = v.Describe
-	p.CreateTime = GetSecond2DateTimes(v.CreateTime)
-
-	if v.UpdateTime > 0 {
-		p.UpdateTime = GetSecond2DateTimes(v.UpdateTime)
-	}
-
-	p.Email = v.Email
-	p.Github = v.Github
-	p.Name = v.Name
-	p.NickName = v.NickName
-	p.HeadPhoto = v.HeadPhoto
-	p.QQ = v.QQ
-	p.WeChat = v.WeChat
-	p.WeiBo = v.WeiBo
-	p.Gender = v.Gender
+	p := user2People(*user)
 	resp.Flag = true
 	resp.Data = p
 }
@@ -537,22 +527,74 @@ type ContentsRequest struct {
 }
 
 type ContentsX struct {
-	Id             int    `json:"id" xorm:"bigint pk autoincr"`
-	Seo            string `json:"seo" xorm:"index"`
-	Title          string `json:"title" xorm:"varchar(200) notnull"`
-	UserId         int    `json:"user_id" xorm:"bigint index"` // 内容所属用户
-	UserName       string `json:"user_name" xorm:"index"`
-	NodeId         int    `json:"node_id" xorm:"bigint index"`                                     // 节点ID
-	NodeSeo        string `json:"node_seo" xorm:"index"`                                           // 节点ID SEO
-	Top            int    `json:"top" xorm:"not null comment('0 normal, 1 top') TINYINT(1) index"` // 置顶
-	CreateTime     string `json:"create_time"`
-	PublishTime    string `json:"publish_time,omitempty"`
-	CreateTimeInt  int64  `json:"create_time_int"`
-	PublishTimeInt int64  `json:"publish_time_int"`
-	ImagePath      string `json:"image_path" xorm:"varchar(700)"`
-	Views          int    `json:"views"` // 被点击多少次，弱化
-	IsLock         bool   `json:"is_lock"`
-	Describe       string `json:"describe"`
+	Id             int      `json:"id" xorm:"bigint pk autoincr"`
+	Seo            string   `json:"seo" xorm:"index"`
+	Title          string   `json:"title" xorm:"varchar(200) notnull"`
+	UserId         int      `json:"user_id" xorm:"bigint index"` // 内容所属用户
+	UserName       string   `json:"user_name" xorm:"index"`
+	NodeId         int      `json:"node_id" xorm:"bigint index"`                                     // 节点ID
+	NodeSeo        string   `json:"node_seo" xorm:"index"`                                           // 节点ID SEO
+	Top            int      `json:"top" xorm:"not null comment('0 normal, 1 top') TINYINT(1) index"` // 置顶
+	CreateTime     string   `json:"create_time"`
+	PublishTime    string   `json:"publish_time,omitempty"`
+	CreateTimeInt  int64    `json:"create_time_int"`
+	PublishTimeInt int64    `json:"publish_time_int"`
+	ImagePath      string   `json:"image_path" xorm:"varchar(700)"`
+	Views          int      `json:"views"` // 被点击多少次，弱化
+	IsLock         bool     `json:"is_lock"`
+	Describe       string   `json:"describe"`
+	Good           int64    `json:"good"`
+	Bad            int64    `json:"bad"`
+	Tags           []string `json:"tags,omitempty"`
+	DescribeHtml   string   `json:"describe_html,omitempty"` // 渲染并过滤后的正文
+	Toc            string   `json:"toc,omitempty"`           // 目录
+}
+
+// 列表中的内容，不包括正文
+func content2ContentsX(c model.Content) ContentsX {
+	temp := ContentsX{}
+	temp.UserId = c.UserId
+	temp.Seo = c.Seo
+	temp.NodeSeo = c.NodeSeo
+	temp.UserName = c.UserName
+	temp.Id = c.Id
+	temp.Top = c.Top
+	temp.Title = c.Title
+	temp.NodeId = c.NodeId
+	temp.Views = c.Views
+	temp.CreateTime = GetSecond2DateTimes(c.CreateTime)
+	temp.PublishTime = GetSecond2DateTimes(c.PublishTime)
+	temp.ImagePath = c.ImagePath
+	temp.CreateTimeInt = c.CreateTime
+	temp.PublishTimeInt = c.PublishTime
+	temp.Good = c.Good
+	temp.Bad = c.Bad
+
+	// 加密的内容列表中不给点赞数，和 /votes 一样要输入密码
+	if c.Password != "" {
+		temp.IsLock = true
+		temp.Good = 0
+		temp.Bad = 0
+	}
+	return temp
+}
+
+// 填充列表中内容的标签
+func fillContentsTags(cs []ContentsX) error {
+	ids := make([]int, 0, len(cs))
+	for _, v := range cs {
+		ids = append(ids, v.Id)
+	}
+
+	tags, err := model.GetContentsTags(ids)
+	if err != nil {
+		return err
+	}
+
+	for k := range cs {
+		cs[k].Tags = tags[cs[k].Id]
+	}
+	return nil
 }
 
 type ContentsResponse struct {
@@ -644,25 +686,14 @@ func Contents(c *gin.Context) {
 	// result
 	bcs := make([]ContentsX, 0, len(cs))
 	for _, c := range cs {
-		temp := ContentsX{}
-		temp.UserId = c.UserId
-		temp.Seo = c.Seo
-		temp.NodeSeo = c.NodeSeo
-		temp.UserName = c.UserName
-		temp.Id = c.Id
-		temp.Top = c.Top
-		temp.Title = c.Title
-		temp.NodeId = c.NodeId
-		temp.Views = c.Views
-		temp.CreateTime = GetSecond2DateTimes(c.CreateTime)
-		temp.PublishTime = GetSecond2DateTimes(c.PublishTime)
-		temp.ImagePath = c.ImagePath
-		temp.CreateTimeInt = c.CreateTime
-		temp.PublishTimeInt = c.PublishTime
-		if c.Password != "" {
-			temp.IsLock = true
-		}
-		bcs = append(bcs, temp)
+		bcs = append(bcs, content2ContentsX(c))
+	}
+
+	err = fillContentsTags(bcs)
+	if err != nil {
+		flog.Log.Errorf("Contents err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
 	}
 
 	respResult.Contents = bcs
@@ -678,6 +709,21 @@ type ContentRequest struct {
 	UserName string `json:"user_name"`
 	Seo      string `json:"seo"`
 	Password string `json:"password"`
+	Html     bool   `json:"html"` // 是否返回渲染后的 HTML
+}
+
+// 渲染结果缓存，按内容ID和版本，重新发布后版本变了自然失效
+var renderCache = cache.New(24*time.Hour, time.Hour)
+
+func renderDescribe(c *model.Content) markdown.Result {
+	key := fmt.Sprintf("%d_%d", c.Id, c.Version)
+	if v, ok := renderCache.Get(key); ok {
+		return v.(markdown.Result)
+	}
+
+	r := markdown.Render(c.Describe)
+	renderCache.SetDefault(key, r)
+	return r
 }
 
 func Content(c *gin.Context) {
@@ -758,11 +804,26 @@ func Content(c *gin.Context) {
 	temp.CreateTimeInt = cx.CreateTime
 	temp.PublishTimeInt = cx.UpdateTime
 	temp.ImagePath = cx.ImagePath
+	temp.Good = cx.Good
+	temp.Bad = cx.Bad
 	if cx.Password != "" {
 		temp.IsLock = true
 	}
 
 	temp.Describe = cx.Describe
+	if req.Html {
+		r := renderDescribe(cx)
+		temp.DescribeHtml = r.Html
+		temp.Toc = r.Toc
+	}
+
+	tags, err := model.GetContentsTags([]int{cx.Id})
+	if err != nil {
+		flog.Log.Errorf("TakeContent err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+	temp.Tags = tags[cx.Id]
 
 	cx.UpdateView()
 
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util/picture"
+	"github.com/hunterhug/fafacms/core/util/sniff"
+	"github.com/hunterhug/fafacms/core/util/storage"
+	"github.com/hunterhug/parrot/util"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// 需要解码校验的图片，其中 scaleType 的还会生成缩略图
+var pictureType = []string{"jpg", "jpeg", "png", "gif"}
+
+// 以前允许上传的网页和 flash 可能还在存储里，只能下载，不能在站点下直接打开
+var attachmentType = []string{"htm", "html", "xhtml", "xml", "svg", "swf", "js"}
+
+var (
+	imageMaxPixels int64 = 25000000
+	imageThumbs          = []config.ImageThumb{{Name: "x", Width: 100}}
+	imageWebP      bool
+)
+
+var thumbNameRegexp = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+// 缩略图的尺寸等配置
+func InitImage(conf config.ImageConfig) error {
+	if conf.MaxPixels > 0 {
+		imageMaxPixels = conf.MaxPixels
+	}
+
+	if len(conf.Thumbs) > 0 {
+		names := make(map[string]bool)
+		for _, t := range conf.Thumbs {
+			if !thumbNameRegexp.MatchString(t.Name) || names[t.Name] {
+				return fmt.Errorf("image thumb name %s wrong", t.Name)
+			}
+
+			if t.Width <= 0 || t.Height < 0 {
+				return fmt.Errorf("image thumb %s size wrong", t.Name)
+			}
+			names[t.Name] = true
+		}
+		imageThumbs = conf.Thumbs
+	}
+
+	imageWebP = conf.WebP
+	return nil
+}
+
+// 根据内容判断真实类型，和后缀不一致，或者是网页之类浏览器会执行的内容，不允许上传
+func sniffUpload(tmp *os.File, suffix string) (string, *ErrorResp) {
+	head := make([]byte, sniff.HeadSize)
+	n, err := io.ReadFull(tmp, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return "", Error(UploadFileError, err.Error())
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return "", Error(UploadFileError, err.Error())
+	}
+
+	contentType, err := sniff.Check(suffix, head[:n])
+	if err != nil {
+		flog.Log.Errorf("upload err: %s is %s, %s", suffix, contentType, err.Error())
+		return "", Error(UploadFileContentWrong, fmt.Sprintf("%s is %s, %s", suffix, contentType, err.Error()))
+	}
+	return contentType, nil
+}
+
+// 图片完整解码确认没有问题，去掉元数据后保存，再生成各种尺寸的缩略图，返回保存的大小
+func storePicture(store storage.Storage, p *model.File, tmp *os.File, suffix string, contentType string) (int64, *ErrorResp) {
+	raw, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return 0, Error(UploadFileError, err.Error())
+	}
+
+	img, format, err := picture.Decode(raw, imageMaxPixels)
+	if err != nil {
+		flog.Log.Errorf("upload err: decode image %s", err.Error())
+		return 0, Error(UploadFileContentWrong, err.Error())
+	}
+
+	clean, err := picture.StripMeta(raw, format)
+	if err != nil {
+		flog.Log.Errorf("upload err: strip image %s", err.Error())
+		return 0, Error(UploadFileContentWrong, err.Error())
+	}
+
+	// 去掉 EXIF 后方向也没有了，需要转的只能重新编码
+	var upright *image.RGBA
+	if orientation := picture.Orientation(raw); orientation > 1 {
+		upright = picture.Upright(img, orientation)
+		buf := new(bytes.Buffer)
+		err = picture.Encode(buf, upright, format)
+		if err != nil {
+			flog.Log.Errorf("upload err:%s", err.Error())
+			return 0, Error(UploadFileError, err.Error())
+		}
+		clean = buf.Bytes()
+	}
+
+	err = store.Put(p.StoreKey, bytes.NewReader(clean), int64(len(clean)), contentType)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return 0, Error(UploadFileError, err.Error())
+	}
+
+	if !util.InArray(scaleType, suffix) {
+		return int64(len(clean)), nil
+	}
+
+	p.IsPicture = 1
+	if upright == nil {
+		upright = picture.Upright(img, 1)
+	}
+
+	keys := make(map[string]string)
+	for _, t := range imageThumbs {
+		small, err := picture.Resize(upright, t.Width, t.Height)
+		if err != nil {
+			flog.Log.Errorf("upload err:%s", err.Error())
+			return 0, Error(UploadFileError, err.Error())
+		}
+
+		key := p.ThumbKey(t.Name, "")
+		errResp := putPicture(store, key, small, format, contentType)
+		if errResp != nil {
+			return 0, errResp
+		}
+		keys[t.Name] = key
+
+		if imageWebP {
+			key = p.ThumbKey(t.Name, "webp")
+			errResp = putPicture(store, key, small, "webp", "image/webp")
+			if errResp != nil {
+				return 0, errResp
+			}
+			keys[t.Name+".webp"] = key
+		}
+	}
+
+	p.SetThumbKeys(keys)
+	return int64(len(clean)), nil
+}
+
+func putPicture(store storage.Storage, key string, img image.Image, format string, contentType string) *ErrorResp {
+	buf := new(bytes.Buffer)
+	err := picture.Encode(buf, img, format)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return Error(UploadFileError, err.Error())
+	}
+
+	err = store.Put(key, buf, int64(buf.Len()), contentType)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return Error(UploadFileError, err.Error())
+	}
+	return nil
+}
+
+// 缩略图的名字到地址，用文件自己的存储后端拼
+func fileThumbUrls(p *model.File) map[string]string {
+	urls := make(map[string]string)
+	store, err := config.FafaStorage.Get(p.StoreType)
+	if err != nil {
+		// 存储后端没有配置了，只能按以前的规则拼
+		if p.IsPicture == 1 {
+			urls["x"] = strings.Replace(p.Url, "/storage", "/storage_x", -1)
+		}
+		return urls
+	}
+
+	for name, key := range p.ThumbKeys() {
+		urls[name] = store.URL(key)
+	}
+	return urls
+}
+
+// 本地存储的静态文件，不让浏览器猜类型，会执行的内容只能下载
+func StorageHeader(c *gin.Context) {
+	c.Header("X-Content-Type-Options", "nosniff")
+	if util.InArray(attachmentType, strings.ToLower(util.GetFileSuffix(c.Request.URL.Path))) {
+		c.Header("Content-Disposition", "attachment")
+	}
+	c.Next()
+}
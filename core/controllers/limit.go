@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/util/limit"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// 路由的限流规则，按IP和按账号分别计数，规则为空表示不限
+type LimitRule struct {
+	Ip           limit.Rule
+	Account      limit.Rule
+	AccountField string // 从请求JSON中取账号的字段，为空时用登录的用户
+}
+
+// 登录失败5次后开始锁定，之后每失败一次锁定时间翻倍
+var LoginLockout = limit.Lockout{
+	Free:   5,
+	Base:   time.Minute,
+	Max:    24 * time.Hour,
+	Window: 24 * time.Hour,
+}
+
+// 限流中间件，rules的key为完整路径，如 /login、/v1/comment/create
+func RateLimit(rules map[string]LimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, ok := rules[c.Request.URL.Path]
+		if !ok || config.FafaLimiter == nil {
+			return
+		}
+
+		resp := new(Resp)
+		wait, err := checkRateLimit(c, c.Request.URL.Path, rule)
+		if err != nil {
+			// 存储出问题时不影响正常访问
+			flog.Log.Errorf("RateLimit err: %s", err.Error())
+			return
+		}
+
+		if wait > 0 {
+			flog.Log.Errorf("RateLimit err: %s %s too many", c.ClientIP(), c.Request.URL.Path)
+			c.Header("Retry-After", fmt.Sprintf("%d", retrySeconds(wait)))
+			resp.Error = Error(RateLimitError, fmt.Sprintf("retry after %ds", retrySeconds(wait)))
+			c.AbortWithStatusJSON(429, resp)
+			return
+		}
+	}
+}
+
+// 返回需要等待的时间，为0表示放行
+func checkRateLimit(c *gin.Context, path string, rule LimitRule) (time.Duration, error) {
+	ok, wait, err := config.FafaLimiter.Allow(fmt.Sprintf("ip:%s:%s", path, limitIp(c)), rule.Ip)
+	if err != nil || !ok {
+		return wait, err
+	}
+
+	if !rule.Account.Enable() {
+		return 0, nil
+	}
+
+	account := limitAccount(c, rule.AccountField)
+	if account == "" {
+		return 0, nil
+	}
+
+	ok, wait, err = config.FafaLimiter.Allow(fmt.Sprintf("account:%s:%s", path, account), rule.Account)
+	if err != nil || !ok {
+		return wait, err
+	}
+	return 0, nil
+}
+
+// 取计数用的IP，没有配置信任代理时只用连接的地址，请求头可以伪造
+func limitIp(c *gin.Context) string {
+	if config.FafaConfig != nil && config.FafaConfig.DefaultConfig.TrustProxy {
+		return c.ClientIP()
+	}
+
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+	return ip
+}
+
+// 取计数用的账号，读过的请求体要放回去给后面解析
+func limitAccount(c *gin.Context, field string) string {
+	if field == "" {
+		u, _ := GetUserSession(c)
+		if u == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d", u.Id)
+	}
+
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	raw, _ := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return ""
+	}
+
+	v, _ := m[field].(string)
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+func retrySeconds(wait time.Duration) int64 {
+	return int64(math.Ceil(wait.Seconds()))
+}
+
+// 账号是否被锁定，返回剩余时间
+func loginLocked(name string) (time.Duration, error) {
+	if config.FafaLimiter == nil {
+		return 0, nil
+	}
+	return config.FafaLimiter.Locked(strings.ToLower(name))
+}
+
+// 登录失败计数，返回这次失败后的锁定时间
+func loginFail(name string) time.Duration {
+	if config.FafaLimiter == nil {
+		return 0
+	}
+
+	d, err := config.FafaLimiter.Fail(strings.ToLower(name), LoginLockout)
+	if err != nil {
+		flog.Log.Errorf("loginFail err: %s", err.Error())
+	}
+	return d
+}
+
+// 登录成功清空失败记录
+func loginSuccess(name string) {
+	if config.FafaLimiter == nil {
+		return
+	}
+
+	err := config.FafaLimiter.Reset(strings.ToLower(name))
+	if err != nil {
+		flog.Log.Errorf("loginSuccess err: %s", err.Error())
+	}
+}
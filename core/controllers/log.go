@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
+)
+
+type ListLogRequest struct {
+	UserId       int      `json:"user_id"`
+	Url          string   `json:"url" validate:"omitempty,lt=255"`
+	ErrorId      string   `json:"error_id" validate:"omitempty,lt=50"`
+	Cid          string   `json:"cid" validate:"omitempty,lt=50"`
+	LogTimeBegin int64    `json:"log_time_begin"`
+	LogTimeEnd   int64    `json:"log_time_end"`
+	Sort         []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type ListLogResponse struct {
+	Logs []model.Log `json:"logs"`
+	PageHelp
+}
+
+// 超级管理员查看审计日志
+func ListLog(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(ListLogResponse)
+	req := new(ListLogRequest)
+	defer func() {
+		// 查看日志本身不再记录返回，免得日志越查越大
+		c.Set(auditSkipOutKey, true)
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListLog err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	// new query list session
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Log)).Where("1=1")
+
+	// query prepare
+	if req.UserId != 0 {
+		session.And("user_id=?", req.UserId)
+	}
+
+	if req.Url != "" {
+		session.And("url=?", req.Url)
+	}
+
+	if req.ErrorId != "" {
+		session.And("error_id=?", req.ErrorId)
+	}
+
+	if req.Cid != "" {
+		session.And("cid=?", req.Cid)
+	}
+
+	if req.LogTimeBegin > 0 {
+		session.And("log_time>=?", req.LogTimeBegin)
+	}
+
+	if req.LogTimeEnd > 0 {
+		session.And("log_time<?", req.LogTimeEnd)
+	}
+
+	// count num
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("ListLog err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// if count>0 start list
+	logs := make([]model.Log, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		// sql build
+		p.build(session, req.Sort, model.LogSortName)
+		// do query
+		err = session.Find(&logs)
+		if err != nil {
+			flog.Log.Errorf("ListLog err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	// result
+	respResult.Logs = logs
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/hunterhug/fafacms/core/flog"
 	"github.com/hunterhug/fafacms/core/model"
-	"github.com/hunterhug/parrot/util"
+	util2 "github.com/hunterhug/fafacms/core/util"
+	"time"
 )
 
 type LoginRequest struct {
@@ -55,24 +57,21 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// super root user login
-	if req.UserName == "hunterhug" && req.PassWd == "hunterhug" {
-		u := new(model.User)
-		u.Id = -1
-		err := SetUserSession(c, u)
-		if err != nil {
-			flog.Log.Errorf("login err:%s", err.Error())
-		}
+	// 失败太多次被锁定，锁定期间密码对了也不能登录
+	wait, err := loginLocked(req.UserName)
+	if err != nil {
+		flog.Log.Errorf("login err:%s", err.Error())
+	}
 
-		c.Set("uid", u.Id)
-		resp.Flag = true
+	if wait > 0 {
+		flog.Log.Errorf("login err:%s", "user locked")
+		resp.Error = Error(LoginLocked, fmt.Sprintf("retry after %ds", retrySeconds(wait)))
 		return
 	}
 
 	// common people login
 	uu := new(model.User)
 	uu.Name = req.UserName
-	uu.Password = req.PassWd
 	ok, err := uu.GetRaw()
 	if err != nil {
 		flog.Log.Errorf("login err:%s", err.Error())
@@ -81,11 +80,51 @@ func Login(c *gin.Context) {
 	}
 
 	if !ok {
+		util2.CheckDummyPassword(req.PassWd)
+	}
+
+	if !ok || !util2.CheckPassword(uu.Password, req.PassWd) {
 		flog.Log.Errorf("login err:%s", "user or password wrong")
+		if wait := loginFail(req.UserName); wait > 0 {
+			resp.Error = Error(LoginLocked, fmt.Sprintf("retry after %ds", retrySeconds(wait)))
+			return
+		}
 		resp.Error = Error(LoginWrong, "")
 		return
 	}
 
+	// 旧的明文密码，登录成功后转为哈希
+	if util2.PasswordNeedRehash(uu.Password) {
+		hashed, err := util2.HashPassword(req.PassWd)
+		if err != nil {
+			flog.Log.Errorf("login err:%s", err.Error())
+			resp.Error = Error(PasswordHashError, err.Error())
+			return
+		}
+
+		uu.Password = hashed
+		err = uu.UpdatePasswordHash()
+		if err != nil {
+			flog.Log.Errorf("login err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	// 开启了两步验证，先记下待验证的状态，验证码通过后才真正登录
+	if uu.TotpEnable == 1 {
+		err = setTotpPending(c, &totpPending{UserId: uu.Id, Remember: req.Remember, ExpireTime: time.Now().Add(totpPendingExpire).Unix()})
+		if err != nil {
+			flog.Log.Errorf("login err:%s", err.Error())
+			resp.Error = Error(SetUserSessionError, err.Error())
+			return
+		}
+
+		resp.Error = Error(TotpNeed, "")
+		return
+	}
+
+	loginSuccess(req.UserName)
 	c.Set("uid", uu.Id)
 
 	err = SetUserSession(c, uu)
@@ -96,12 +135,15 @@ func Login(c *gin.Context) {
 	}
 
 	if req.Remember {
-		authKey := util.Md5(c.ClientIP() + "|" + uu.Password)
-		secretKey := util.IS(uu.Id) + "|" + authKey
-		c.SetCookie("auth", secretKey, 3600*24*7, "/", "", false, true)
+		err = SetRememberToken(c, uu.Id)
+		if err != nil {
+			flog.Log.Errorf("login err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
 	} else {
 		// cookie clean
-		c.SetCookie("auth", "", -1, "/", "", false, true)
+		DeleteRememberToken(c)
 	}
 
 	resp.Flag = true
@@ -116,6 +158,10 @@ func Logout(c *gin.Context) {
 	if user != nil {
 		DeleteUserSession(c)
 	}
-	c.SetCookie("auth", "", 0, "", "", false, false)
+
+	err := DeleteRememberToken(c)
+	if err != nil {
+		flog.Log.Errorf("logout err:%s", err.Error())
+	}
 	resp.Flag = true
 }
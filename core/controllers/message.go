@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
+)
+
+// 群发时每批插入的数量
+const messageBatchNum = 500
+
+// 系统自动发送站内信，失败只记录日志，不影响主流程
+func sendMessage(sendUserId, receiveUserId, messageType, objectId, commentId int, describe string) {
+	if receiveUserId == 0 || receiveUserId == sendUserId {
+		return
+	}
+
+	m := new(model.Message)
+	m.SendUserId = sendUserId
+	m.ReceiveUserId = receiveUserId
+	m.MessageType = messageType
+	m.ObjectId = objectId
+	m.CommentId = commentId
+	m.Describe = describe
+	err := m.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("SendMessage err: %s", err.Error())
+	}
+}
+
+// 新评论或回复的站内信
+func sendCommentMessage(comment *model.Comment, title string) {
+	if comment.Status == 0 {
+		// 等待审核，只通知内容所有者
+		sendMessage(comment.UserId, comment.ObjectUserId, model.MessageTypeComment, comment.ObjectId, comment.Id, fmt.Sprintf("new comment wait review in: %s", title))
+		return
+	}
+
+	if comment.CommentId != 0 {
+		sendMessage(comment.UserId, comment.CommentUserId, model.MessageTypeReply, comment.ObjectId, comment.Id, fmt.Sprintf("new reply in: %s", title))
+	}
+
+	// 回复的是内容所有者时，上面已经通知过了
+	if comment.CommentUserId != comment.ObjectUserId {
+		sendMessage(comment.UserId, comment.ObjectUserId, model.MessageTypeComment, comment.ObjectId, comment.Id, fmt.Sprintf("new comment in: %s", title))
+	}
+}
+
+type ListMessageRequest struct {
+	Status      int      `json:"status" validate:"oneof=-1 0 1"`
+	MessageType int      `json:"message_type" validate:"oneof=-1 0 1 2 3 4"`
+	Sort        []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type ListMessageResponse struct {
+	Messages []model.Message `json:"messages"`
+	PageHelp
+}
+
+// 列出自己的站内信
+func ListMessage(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(ListMessageResponse)
+	req := new(ListMessageRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListMessage err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListMessage err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Message)).Where("1=1").And("receive_user_id=?", uu.Id)
+
+	if req.Status != -1 {
+		session.And("status=?", req.Status)
+	}
+
+	if req.MessageType != -1 {
+		session.And("message_type=?", req.MessageType)
+	}
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("ListMessage err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	ms := make([]model.Message, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.MessageSortName)
+		err = session.Find(&ms)
+		if err != nil {
+			flog.Log.Errorf("ListMessage err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	respResult.Messages = ms
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 标记已读
+type ReadMessageRequest struct {
+	Ids []int `json:"ids" validate:"required,dive,required"`
+}
+
+func ReadMessage(c *gin.Context) {
+	resp := new(Resp)
+	req := new(ReadMessageRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ReadMessage err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ReadMessage err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	m := new(model.Message)
+	m.ReceiveUserId = uu.Id
+	num, err := m.Read(req.Ids)
+	if err != nil {
+		flog.Log.Errorf("ReadMessage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = num
+	resp.Flag = true
+}
+
+// 全部标记已读
+func ReadAllMessage(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ReadAllMessage err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	m := new(model.Message)
+	m.ReceiveUserId = uu.Id
+	num, err := m.Read(nil)
+	if err != nil {
+		flog.Log.Errorf("ReadAllMessage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = num
+	resp.Flag = true
+}
+
+type CountMessageX struct {
+	MessageType int   `json:"message_type"`
+	Num         int64 `json:"num"`
+}
+
+type CountMessageResponse struct {
+	Total int64           `json:"total"`
+	Info  []CountMessageX `json:"info"`
+}
+
+// 统计未读站内信，按类型分组
+func CountMessage(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CountMessage err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	info := make([]CountMessageX, 0)
+	err = config.FafaRdb.Client.Table(new(model.Message)).Select("message_type, count(*) as num").Where("receive_user_id=?", uu.Id).And("status=?", 0).GroupBy("message_type").Find(&info)
+	if err != nil {
+		flog.Log.Errorf("CountMessage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	respResult := new(CountMessageResponse)
+	for _, v := range info {
+		respResult.Total = respResult.Total + v.Num
+	}
+	respResult.Info = info
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 管理员群发站内信，不指定用户时发给所有激活的用户
+type SendMessageAdminRequest struct {
+	UserIds  []int  `json:"user_ids" validate:"dive,required"`
+	Describe string `json:"describe" validate:"required"`
+}
+
+func SendMessageAdmin(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SendMessageAdminRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("SendMessageAdmin err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("SendMessageAdmin err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	// 按ID分批找出用户，一批批插入
+	var total int64 = 0
+	lastId := 0
+	for {
+		users := make([]model.User, 0)
+		session := config.FafaRdb.Client.Cols("id").Where("id>?", lastId).And("status=?", 1)
+		if len(req.UserIds) > 0 {
+			session.In("id", req.UserIds)
+		}
+		err = session.Asc("id").Limit(messageBatchNum).Find(&users)
+		if err != nil {
+			flog.Log.Errorf("SendMessageAdmin err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		ms := make([]model.Message, 0, len(users))
+		for _, v := range users {
+			m := model.Message{}
+			m.SendUserId = uu.Id
+			m.ReceiveUserId = v.Id
+			m.MessageType = model.MessageTypeGlobal
+			m.Describe = req.Describe
+			ms = append(ms, m)
+		}
+
+		err = model.InsertMessages(ms)
+		if err != nil {
+			flog.Log.Errorf("SendMessageAdmin err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		total = total + int64(len(ms))
+		lastId = users[len(users)-1].Id
+		if len(users) < messageBatchNum {
+			break
+		}
+	}
+
+	resp.Data = total
+	resp.Flag = true
+}
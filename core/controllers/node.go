@@ -661,6 +661,8 @@ func DeleteNode(c *gin.Context) {
 		resp.Error = Error(DBError, err.Error())
 		return
 	}
+
+	model.RemoveFileRef(model.FileRefNode, n.Id)
 	resp.Flag = true
 }
 
@@ -0,0 +1,579 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util"
+	"github.com/hunterhug/fafacms/core/util/oauth"
+	"time"
+	"unicode"
+)
+
+const (
+	oauthStateExpire   = 10 * time.Minute
+	oauthExchangeLimit = 15 * time.Second
+)
+
+// 配置的第三方登录，key为名字
+var oauthProviders = map[string]*oauth.Provider{}
+
+// 启动时检查第三方登录的配置
+func InitOAuth(providers []oauth.Provider) error {
+	ps := make(map[string]*oauth.Provider, len(providers))
+	for i := range providers {
+		p := &providers[i]
+		err := p.Init()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := ps[p.Name]; ok {
+			return fmt.Errorf("oauth provider %s repeat", p.Name)
+		}
+		ps[p.Name] = p
+	}
+
+	oauthProviders = ps
+	return nil
+}
+
+// 跳转第三方前记在Session中，回调时校验，防止CSRF
+type oauthState struct {
+	State      string
+	Provider   string
+	Remember   bool
+	BindUserId int // 已登录的用户绑定第三方时不为0
+	ExpireTime int64
+}
+
+// 取出后就删掉，只能用一次
+func popOAuthState(c *gin.Context) (*oauthState, error) {
+	st := new(oauthState)
+	s := config.FafaSessionMgr.Load(c.Request)
+	err := s.GetObject("oauth_state", st)
+	if err != nil {
+		return nil, err
+	}
+
+	if st.State == "" {
+		return nil, nil
+	}
+	return st, s.Remove(c.Writer, "oauth_state")
+}
+
+// 生成授权地址并记下状态
+func newOAuthUrl(c *gin.Context, p *oauth.Provider, remember bool, bindUserId int) (string, error) {
+	state, err := util.RandomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	st := &oauthState{
+		State:      state,
+		Provider:   p.Name,
+		Remember:   remember,
+		BindUserId: bindUserId,
+		ExpireTime: time.Now().Add(oauthStateExpire).Unix(),
+	}
+
+	s := config.FafaSessionMgr.Load(c.Request)
+	err = s.PutObject(c.Writer, "oauth_state", st)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), oauthExchangeLimit)
+	defer cancel()
+	return p.AuthCodeURL(ctx, state)
+}
+
+type OAuthProviderX struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// 列出可用的第三方登录
+func OAuthProviders(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSON(c, 200, resp)
+	}()
+
+	back := make([]OAuthProviderX, 0, len(oauthProviders))
+	for _, p := range oauthProviders {
+		back = append(back, OAuthProviderX{Name: p.Name, Type: p.Type})
+	}
+
+	resp.Data = back
+	resp.Flag = true
+}
+
+type OAuthUrlRequest struct {
+	Provider string `json:"provider" validate:"required"`
+	Remember bool   `json:"remember"`
+}
+
+// 获取第三方授权的地址，前端跳转过去
+func OAuthUrl(c *gin.Context) {
+	resp := new(Resp)
+	req := new(OAuthUrlRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("OAuthUrl err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	p, ok := oauthProviders[req.Provider]
+	if !ok {
+		flog.Log.Errorf("OAuthUrl err: %s", "provider not found")
+		resp.Error = Error(OAuthProviderNotFound, "")
+		return
+	}
+
+	url, err := newOAuthUrl(c, p, req.Remember, 0)
+	if err != nil {
+		flog.Log.Errorf("OAuthUrl err: %s", err.Error())
+		resp.Error = Error(OAuthExchangeError, err.Error())
+		return
+	}
+
+	resp.Data = url
+	resp.Flag = true
+}
+
+type OAuthCallbackRequest struct {
+	Provider string `json:"provider" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+	State    string `json:"state" validate:"required"`
+}
+
+// 第三方回调到前端后，前端把 code 和 state 带过来
+// 已绑定的直接登录，邮箱已验证且有相同邮箱的用户自动绑定，都没有时创建新用户
+// 绑定流程中只做绑定，不改变登录状态
+func OAuthCallback(c *gin.Context) {
+	resp := new(Resp)
+	req := new(OAuthCallbackRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	st, _ := popOAuthState(c)
+	if st == nil || st.ExpireTime < time.Now().Unix() || st.Provider != req.Provider || subtle.ConstantTimeCompare([]byte(st.State), []byte(req.State)) != 1 {
+		flog.Log.Errorf("OAuthCallback err: %s", "state wrong")
+		resp.Error = Error(OAuthStateWrong, "")
+		return
+	}
+
+	p, ok := oauthProviders[req.Provider]
+	if !ok {
+		flog.Log.Errorf("OAuthCallback err: %s", "provider not found")
+		resp.Error = Error(OAuthProviderNotFound, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), oauthExchangeLimit)
+	defer cancel()
+	info, err := p.Exchange(ctx, req.Code)
+	if err != nil {
+		flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+		resp.Error = Error(OAuthExchangeError, err.Error())
+		return
+	}
+
+	identity := new(model.UserIdentity)
+	identity.Provider = p.Name
+	identity.ProviderUid = info.Id
+	exist, err := identity.GetByProviderUid()
+	if err != nil {
+		flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if st.BindUserId != 0 {
+		if exist {
+			if identity.UserId != st.BindUserId {
+				flog.Log.Errorf("OAuthCallback err: %s", "bind by other")
+				resp.Error = Error(OAuthAlreadyBind, "")
+				return
+			}
+
+			resp.Data = identity
+			resp.Flag = true
+			return
+		}
+
+		identity.UserId = st.BindUserId
+		identity.Name = info.Name
+		identity.Email = info.Email
+		if errResp := bindOAuthIdentity(identity); errResp != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", errResp.Error())
+			resp.Error = errResp
+			return
+		}
+
+		resp.Data = identity
+		resp.Flag = true
+		return
+	}
+
+	uu := new(model.User)
+	if exist {
+		uu.Id = identity.UserId
+		err = uu.Get()
+		if err != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+			resp.Error = Error(UserNotFound, err.Error())
+			return
+		}
+
+		identity.Name = info.Name
+		identity.Email = info.Email
+		err = identity.UpdateInfo()
+		if err != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	} else {
+		// 第三方的邮箱没验证过，不能拿来认领已有的账号，也不能注册
+		if info.Email == "" || !info.EmailVerified {
+			flog.Log.Errorf("OAuthCallback err: %s", "email not verified")
+			resp.Error = Error(OAuthEmailNotVerified, "")
+			return
+		}
+
+		identity.Name = info.Name
+		identity.Email = info.Email
+
+		uu.Email = info.Email
+		ok, err := uu.GetUserByEmail()
+		if err != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if ok {
+			// 邮箱在第三方验证过，相当于激活，但没激活的账号可能是别人抢注的
+			// 先清掉注册时的密码，踢掉已有的登录，再绑定
+			if uu.PrepareEmailClaim() {
+				err = uu.UpdateEmailClaim()
+				if err != nil {
+					flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+					resp.Error = Error(DBError, err.Error())
+					return
+				}
+
+				err = RevokeUserLogin(uu.Id, nil)
+				if err != nil {
+					flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+					resp.Error = Error(DBError, err.Error())
+					return
+				}
+			}
+
+			identity.UserId = uu.Id
+			if errResp := bindOAuthIdentity(identity); errResp != nil {
+				flog.Log.Errorf("OAuthCallback err: %s", errResp.Error())
+				resp.Error = errResp
+				return
+			}
+		} else {
+			if config.FafaConfig.DefaultConfig.CloseRegister {
+				flog.Log.Errorf("OAuthCallback err: %s", "register close")
+				resp.Error = Error(CloseRegisterError, "")
+				return
+			}
+
+			uu, err = newOAuthUser(p, info)
+			if err != nil {
+				flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+				resp.Error = Error(DBError, err.Error())
+				return
+			}
+
+			err = model.CreateUserWithIdentity(uu, identity)
+			if err != nil {
+				flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+				resp.Error = Error(DBError, err.Error())
+				return
+			}
+
+			flog.Log.Noticef("OAuthCallback create user %s from %s", uu.Name, p.Name)
+		}
+	}
+
+	// 开启了两步验证，和密码登录一样要再验证一次
+	if uu.TotpEnable == 1 {
+		err = setTotpPending(c, &totpPending{UserId: uu.Id, Remember: st.Remember, ExpireTime: time.Now().Add(totpPendingExpire).Unix()})
+		if err != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+			resp.Error = Error(SetUserSessionError, err.Error())
+			return
+		}
+
+		resp.Error = Error(TotpNeed, "")
+		return
+	}
+
+	c.Set("uid", uu.Id)
+	err = SetUserSession(c, uu)
+	if err != nil {
+		flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+		resp.Error = Error(SetUserSessionError, err.Error())
+		return
+	}
+
+	if st.Remember {
+		err = SetRememberToken(c, uu.Id)
+		if err != nil {
+			flog.Log.Errorf("OAuthCallback err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	resp.Flag = true
+}
+
+// 一个用户同一个第三方只能绑定一个账号
+func bindOAuthIdentity(identity *model.UserIdentity) *ErrorResp {
+	exist, err := identity.ExistUserProvider()
+	if err != nil {
+		return Error(DBError, err.Error())
+	}
+
+	if exist {
+		return Error(OAuthProviderAlreadyBind, "")
+	}
+
+	err = identity.InsertOne()
+	if err != nil {
+		return Error(DBError, err.Error())
+	}
+	return nil
+}
+
+// 第三方首次登录时自动注册的用户，已激活，密码随机，可以用忘记密码重新设置
+func newOAuthUser(p *oauth.Provider, info *oauth.UserInfo) (*model.User, error) {
+	u := new(model.User)
+	u.Email = info.Email
+	u.Status = 1
+
+	name, err := newOAuthUserName(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	u.Name = name
+
+	u.NickName = info.NickName
+	if len([]rune(u.NickName)) < 2 || len([]rune(u.NickName)) > 49 {
+		u.NickName = u.Name
+	}
+
+	if p.Type == oauth.TypeGithub && info.Name != "" {
+		u.Github = "https://github.com/" + info.Name
+	}
+
+	password, err := util.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Password, err = util.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// 用第三方的用户名生成唯一名字，只保留文字和数字，重复了加随机后缀
+func newOAuthUserName(raw string) (string, error) {
+	name := make([]rune, 0, len(raw))
+	for _, r := range raw {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			name = append(name, r)
+		}
+		if len(name) >= 40 {
+			break
+		}
+	}
+
+	base := string(name)
+	if len(name) < 2 {
+		base = "user"
+	}
+
+	u := new(model.User)
+	u.Name = base
+	for i := 0; i < 5; i++ {
+		repeat, err := u.IsNameRepeat()
+		if err != nil {
+			return "", err
+		}
+
+		if !repeat {
+			return u.Name, nil
+		}
+
+		suffix, err := util.RandomHex(3)
+		if err != nil {
+			return "", err
+		}
+		u.Name = base + suffix
+	}
+
+	return "", fmt.Errorf("name %s repeat too many times", base)
+}
+
+// 列出自己绑定的第三方
+func ListUserIdentity(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListUserIdentity err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	identities := make([]model.UserIdentity, 0)
+	err = config.FafaRdb.Client.Where("user_id=?", uu.Id).Asc("id").Find(&identities)
+	if err != nil {
+		flog.Log.Errorf("ListUserIdentity err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = identities
+	resp.Flag = true
+}
+
+type BindUserIdentityRequest struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+// 已登录的用户绑定第三方，返回授权地址，回调同样走 /oauth/callback
+func BindUserIdentity(c *gin.Context) {
+	resp := new(Resp)
+	req := new(BindUserIdentityRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("BindUserIdentity err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("BindUserIdentity err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	p, ok := oauthProviders[req.Provider]
+	if !ok {
+		flog.Log.Errorf("BindUserIdentity err: %s", "provider not found")
+		resp.Error = Error(OAuthProviderNotFound, "")
+		return
+	}
+
+	url, err := newOAuthUrl(c, p, false, uu.Id)
+	if err != nil {
+		flog.Log.Errorf("BindUserIdentity err: %s", err.Error())
+		resp.Error = Error(OAuthExchangeError, err.Error())
+		return
+	}
+
+	resp.Data = url
+	resp.Flag = true
+}
+
+type UnbindUserIdentityRequest struct {
+	Id int `json:"id" validate:"required"`
+}
+
+// 解除绑定，之后只能用密码登录
+func UnbindUserIdentity(c *gin.Context) {
+	resp := new(Resp)
+	req := new(UnbindUserIdentityRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UnbindUserIdentity err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UnbindUserIdentity err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	identity := new(model.UserIdentity)
+	identity.Id = req.Id
+	identity.UserId = uu.Id
+	err = identity.Delete()
+	if err != nil {
+		flog.Log.Errorf("UnbindUserIdentity err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
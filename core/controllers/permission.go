@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+)
+
+type ListUserPermissionRequest struct {
+	UserId int `json:"user_id" validate:"required"`
+}
+
+type PermissionGroup struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	From int    `json:"from"` // 从哪个直接所在的组继承来的，等于自己表示直接所在
+}
+
+type PermissionResource struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Url     string `json:"url"`
+	Admin   bool   `json:"admin"`
+	Allow   bool   `json:"allow"`    // 最终是否允许
+	AllowBy []int  `json:"allow_by"` // 哪些组允许
+	DenyBy  []int  `json:"deny_by"`  // 哪些组拒绝
+}
+
+type ListUserPermissionResponse struct {
+	UserId    int                  `json:"user_id"`
+	Groups    []PermissionGroup    `json:"groups"`
+	Resources []PermissionResource `json:"resources"`
+}
+
+// 超级管理员查看用户的实际权限，包括继承来的组，以及每个资源是哪些组允许或拒绝的
+func ListUserPermission(c *gin.Context) {
+	resp := new(Resp)
+	req := new(ListUserPermissionRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	u := new(model.User)
+	u.Id = req.UserId
+	ok, err := u.GetRaw()
+	if err != nil {
+		flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		flog.Log.Errorf("ListUserPermission err: %s", "user not found")
+		resp.Error = Error(UserNotFound, "")
+		return
+	}
+
+	direct, err := model.GetUserGroupIds(u.Id)
+	if err != nil {
+		flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	from, err := model.ExpandGroupIds(direct)
+	if err != nil {
+		flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	groupIds := make([]int, 0, len(from))
+	for id := range from {
+		groupIds = append(groupIds, id)
+	}
+
+	gs := make([]model.Group, 0)
+	grs := make([]model.GroupResource, 0)
+	if len(groupIds) > 0 {
+		err = config.FafaRdb.Client.In("id", groupIds).Asc("id").Find(&gs)
+		if err != nil {
+			flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		err = config.FafaRdb.Client.In("group_id", groupIds).Find(&grs)
+		if err != nil {
+			flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	rs := make([]model.Resource, 0)
+	err = config.FafaRdb.Client.Asc("id").Find(&rs)
+	if err != nil {
+		flog.Log.Errorf("ListUserPermission err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	byResource := make(map[int][]model.GroupResource)
+	for _, v := range grs {
+		byResource[v.ResourceId] = append(byResource[v.ResourceId], v)
+	}
+
+	back := new(ListUserPermissionResponse)
+	back.UserId = u.Id
+	back.Groups = make([]PermissionGroup, 0, len(gs))
+	for _, g := range gs {
+		back.Groups = append(back.Groups, PermissionGroup{Id: g.Id, Name: g.Name, From: from[g.Id]})
+	}
+
+	back.Resources = make([]PermissionResource, 0, len(rs))
+	for _, r := range rs {
+		p := PermissionResource{
+			Id:      r.Id,
+			Name:    r.Name,
+			Url:     r.Url,
+			Admin:   r.Admin,
+			Allow:   model.Decide(r.Admin, byResource[r.Id]),
+			AllowBy: make([]int, 0),
+			DenyBy:  make([]int, 0),
+		}
+		for _, v := range byResource[r.Id] {
+			if v.Effect == model.EffectDeny {
+				p.DenyBy = append(p.DenyBy, v.GroupId)
+			} else {
+				p.AllowBy = append(p.AllowBy, v.GroupId)
+			}
+		}
+		back.Resources = append(back.Resources, p)
+	}
+
+	resp.Data = back
+	resp.Flag = true
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
+)
+
+type FileUsageResponse struct {
+	Used  *model.FileUsage  `json:"used"`
+	Quota *model.Quota      `json:"quota"` // 为0表示不限
+	Types []model.FileUsage `json:"types"`
+	Tags  []model.FileUsage `json:"tags"`
+}
+
+// 自己的占用和配额，按类型和标签分别统计
+func FileUsage(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("FileUsage err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	back := new(FileUsageResponse)
+	back.Used, err = model.GetFileUsage(uu.Id)
+	if err != nil {
+		flog.Log.Errorf("FileUsage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	back.Quota, err = model.GetUserQuota(uu.Id, uploadQuota)
+	if err != nil {
+		flog.Log.Errorf("FileUsage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	back.Types, err = model.ListFileUsage(uu.Id, "type")
+	if err != nil {
+		flog.Log.Errorf("FileUsage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	back.Tags, err = model.ListFileUsage(uu.Id, "tag")
+	if err != nil {
+		flog.Log.Errorf("FileUsage err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = back
+	resp.Flag = true
+}
+
+type FileUsageUser struct {
+	UserId   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+	Size     int64  `json:"size"`
+	Count    int64  `json:"count"`
+}
+
+type ListFileUsageAdminResponse struct {
+	Users []FileUsageUser `json:"users"`
+	PageHelp
+}
+
+// 管理员查看占用最多的用户，默认按大小倒序，条件和列出文件的一样
+func ListFileUsageAdmin(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(ListFileUsageAdminResponse)
+	req := new(ListFileAdminRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("ListFileUsageAdmin err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.File)).Where("1=1")
+	fileAdminWhere(session, req, 0)
+
+	// count num
+	countSession := session.Clone()
+	defer countSession.Close()
+
+	var total int64
+	_, err = countSession.Select("count(distinct user_id)").Get(&total)
+	if err != nil {
+		flog.Log.Errorf("ListFileUsageAdmin err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	users := make([]FileUsageUser, 0)
+	p := &req.PageHelp
+	if total > 0 {
+		session.Select("user_id, max(user_name) as user_name, sum(size) as size, count(id) as count").GroupBy("user_id")
+		p.build(session, req.Sort, model.FileUsageSortName)
+		err = session.Find(&users)
+		if err != nil {
+			flog.Log.Errorf("ListFileUsageAdmin err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	respResult.Users = users
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+type SetQuotaRequest struct {
+	Id         int   `json:"id" validate:"required"`
+	QuotaSize  int64 `json:"quota_size" validate:"gte=-1"`  // 单位字节，0表示没有设置，-1表示不限
+	QuotaCount int64 `json:"quota_count" validate:"gte=-1"` // 文件数，同上
+}
+
+// 超级管理员单独设置用户的配额，优先于所在组的
+func SetUserQuota(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SetQuotaRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("SetUserQuota err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	u := new(model.User)
+	u.Id = req.Id
+	ok, err := u.GetRaw()
+	if err != nil {
+		flog.Log.Errorf("SetUserQuota err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		flog.Log.Errorf("SetUserQuota err: %s", "user not found")
+		resp.Error = Error(UserNotFound, "")
+		return
+	}
+
+	u.QuotaSize = req.QuotaSize
+	u.QuotaCount = req.QuotaCount
+	err = u.UpdateQuota()
+	if err != nil {
+		flog.Log.Errorf("SetUserQuota err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// 返回实际生效的配额
+	q, err := model.GetUserQuota(u.Id, uploadQuota)
+	if err != nil {
+		flog.Log.Errorf("SetUserQuota err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = q
+	resp.Flag = true
+}
+
+// 设置组下用户的配额，用户在多个组时取最宽的
+func SetGroupQuota(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SetQuotaRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("SetGroupQuota err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	g := new(model.Group)
+	g.Id = req.Id
+	ok, err := g.GetById()
+	if err != nil {
+		flog.Log.Errorf("SetGroupQuota err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		flog.Log.Errorf("SetGroupQuota err: %s", "group not found")
+		resp.Error = Error(GroupNotFound, "")
+		return
+	}
+
+	g.QuotaSize = req.QuotaSize
+	g.QuotaCount = req.QuotaCount
+	err = g.UpdateQuota()
+	if err != nil {
+		flog.Log.Errorf("SetGroupQuota err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = g
+	resp.Flag = true
+}
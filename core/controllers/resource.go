@@ -111,6 +111,7 @@ type AssignResourceToGroupRequest struct {
 	GroupId         int   `json:"group_id"`
 	ResourceRelease int   `json:"resource_release"`
 	Resources       []int `json:"resources"`
+	Effect          int   `json:"effect"` // 0允许，1显式拒绝
 }
 
 func AssignResourceToGroup(c *gin.Context) {
@@ -125,6 +126,12 @@ func AssignResourceToGroup(c *gin.Context) {
 		return
 	}
 
+	if req.Effect != model.EffectAllow && req.Effect != model.EffectDeny {
+		flog.Log.Errorf("AssignGroupAndResource err:%s", "effect wrong")
+		resp.Error = Error(ParasError, "effect")
+		return
+	}
+
 	resourceNums := len(req.Resources)
 	if resourceNums == 0 && req.ResourceRelease != 1 {
 		flog.Log.Errorf("AssignGroupAndResource err:%s", "resources empty")
@@ -192,7 +199,7 @@ func AssignResourceToGroup(c *gin.Context) {
 
 	rs := make([]model.GroupResource, 0, resourceNums)
 	for _, r := range req.Resources {
-		rs = append(rs, model.GroupResource{GroupId: req.GroupId, ResourceId: r})
+		rs = append(rs, model.GroupResource{GroupId: req.GroupId, ResourceId: r, Effect: req.Effect})
 	}
 	_, err = session.Insert(rs)
 	if err != nil {
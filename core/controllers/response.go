@@ -4,14 +4,9 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/render"
-	"github.com/hunterhug/fafacms/core/config"
 	. "github.com/hunterhug/fafacms/core/flog"
-	"github.com/hunterhug/fafacms/core/model"
-	"github.com/hunterhug/fafacms/core/util"
 	"io/ioutil"
 	"runtime"
-	"strings"
-	"time"
 )
 
 func ParseJSON(c *gin.Context, req interface{}) *ErrorResp {
@@ -37,92 +32,20 @@ func JSONL(c *gin.Context, code int, req interface{}, obj *Resp) {
 		return
 	}
 
-	// log will record
-	record := new(model.Log)
-	record.Ip = c.ClientIP()
-	record.Url = c.Request.URL.Path
-	record.LogTime = time.Now().Unix()
-	record.Ua = c.Request.UserAgent()
-	record.UserId = c.GetInt("uid")
-	flag := obj.Flag
-	if !flag && obj.Error != nil {
-		errStr := obj.Error.Error()
-		errStrSplit := strings.Split(errStr, "|")
-		if len(errStrSplit) >= 2 {
-			record.ErrorId = errStrSplit[0]
-			record.ErrorMessage = strings.Join(errStrSplit[1:], "|")
-		}
-	}
-	record.Flag = flag
-
-	if req != nil {
-		in, _ := json.Marshal(req)
-		if len(in) > 0 {
-			record.In = string(in)
-		}
-	}
-
-	if obj != nil {
-		out, _ := json.Marshal(obj)
-		if len(out) > 0 {
-			record.Out = string(out)
-		}
-	}
-	cid := util.GetGUID()
-	record.Cid = cid
-
+	// 审计日志异步写库，不拖慢请求
+	record := newAuditLog(c, req, obj)
 	Log.Debugf("FaFa Monitor:%#v", record)
+	audit(record)
 
-	// 审计表不写了，打日志就行，不要拉慢速度
-	//_, err := config.FafaRdb.InsertOne(record)
-	//if err != nil {
-	//	Log.Errorf("insert log record:%s", err.Error())
-	//}
-
-	obj.Cid = cid
+	obj.Cid = record.Cid
 	c.Render(code, render.JSON{Data: obj})
 }
 
 // 不转发，仅仅审计
 func LogAlone(c *gin.Context, req interface{}, obj *Resp) {
-	record := new(model.Log)
-	record.Ip = c.ClientIP()
-	record.Url = c.Request.URL.Path
-	record.LogTime = time.Now().Unix()
-	record.Ua = c.Request.UserAgent()
-	record.UserId = c.GetInt("uid")
-	flag := obj.Flag
-	if !flag && obj.Error != nil {
-		errStr := obj.Error.Error()
-		errStrSplit := strings.Split(errStr, "|")
-		if len(errStrSplit) >= 2 {
-			record.ErrorId = errStrSplit[0]
-			record.ErrorMessage = strings.Join(errStrSplit[1:], "|")
-		}
-	}
-	record.Flag = flag
-
-	if req != nil {
-		in, _ := json.Marshal(req)
-		if len(in) > 0 {
-			record.In = string(in)
-		}
-	}
-
-	if obj != nil {
-		out, _ := json.Marshal(obj)
-		if len(out) > 0 {
-			record.Out = string(out)
-		}
-	}
-	cid := util.GetGUID()
-	record.Cid = cid
+	record := newAuditLog(c, req, obj)
 	Log.Debugf("Monitor:%#v", record)
-	_, err := config.FafaRdb.InsertOne(record)
-	if err != nil {
-		Log.Errorf("insert log record:%s", err.Error())
-	}
-
+	audit(record)
 }
 
 func JSON(c *gin.Context, code int, obj *Resp) {
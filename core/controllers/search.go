@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util/search"
+	"math"
+)
+
+// 全文搜索，标题和正文
+type SearchRequest struct {
+	Keyword         string `json:"keyword" validate:"required,lt=100"`
+	UserId          int    `json:"user_id"`
+	NodeId          int    `json:"node_id"`
+	CreateTimeBegin int64  `json:"create_time_begin"`
+	CreateTimeEnd   int64  `json:"create_time_end"`
+	PageHelp
+}
+
+type SearchContentRequest struct {
+	SearchRequest
+	Status int `json:"status" validate:"oneof=-1 0 1 2 3"`
+}
+
+type SearchX struct {
+	ContentsX
+	Score          float64 `json:"score"`
+	HighlightTitle string  `json:"highlight_title"` // 已转义，命中的词用<em>标出
+	Snippet        string  `json:"snippet"`         // 已转义，命中的词用<em>标出
+}
+
+type SearchResponse struct {
+	Contents []SearchX `json:"contents"`
+	Total    int       `json:"total"`
+	PageHelp
+}
+
+// 公开搜索，只搜索已发布的正常内容
+func Search(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SearchRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Search err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	q := search.Query{
+		Keyword:         req.Keyword,
+		Public:          true,
+		UserId:          req.UserId,
+		NodeId:          req.NodeId,
+		Status:          -1,
+		CreateTimeBegin: req.CreateTimeBegin,
+		CreateTimeEnd:   req.CreateTimeEnd,
+	}
+
+	respResult, errResp := searchHelper(q, &req.PageHelp, true)
+	if errResp != nil {
+		flog.Log.Errorf("Search err: %s", errResp.Error())
+		resp.Error = errResp
+		return
+	}
+
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 搜索自己的内容，包括隐藏的
+func SearchContent(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SearchContentRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("SearchContent err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("SearchContent err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	q := search.Query{
+		Keyword:         req.Keyword,
+		UserId:          uu.Id,
+		NodeId:          req.NodeId,
+		Status:          req.Status,
+		CreateTimeBegin: req.CreateTimeBegin,
+		CreateTimeEnd:   req.CreateTimeEnd,
+	}
+
+	respResult, errResp := searchHelper(q, &req.PageHelp, false)
+	if errResp != nil {
+		flog.Log.Errorf("SearchContent err: %s", errResp.Error())
+		resp.Error = errResp
+		return
+	}
+
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+func searchHelper(q search.Query, p *PageHelp, public bool) (*SearchResponse, *ErrorResp) {
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+
+	if p.Limit <= 0 || p.Limit > 20 {
+		p.Limit = 20
+	}
+
+	q.Offset = (p.Page - 1) * p.Limit
+	q.Limit = p.Limit
+	hits, total := model.ContentSearch.Search(q)
+
+	ids := make([]int, 0, len(hits))
+	for _, v := range hits {
+		ids = append(ids, v.Id)
+	}
+
+	contents := make(map[int]model.Content)
+	if len(ids) > 0 {
+		session := config.FafaRdb.Client.Omit("describe", "pre_describe").In("id", ids)
+
+		// 索引可能稍有延迟，以数据库为准
+		if public {
+			session.And("status=?", 0).And("version>?", 0).And("password=?", "")
+		}
+
+		err := session.Find(&contents)
+		if err != nil {
+			return nil, Error(DBError, err.Error())
+		}
+	}
+
+	back := make([]SearchX, 0, len(hits))
+	for _, v := range hits {
+		content, ok := contents[v.Id]
+		if !ok {
+			continue
+		}
+
+		x := SearchX{}
+		x.ContentsX = content2ContentsX(content)
+		x.Score = v.Score
+		x.HighlightTitle = v.Title
+		x.Snippet = v.Snippet
+		back = append(back, x)
+	}
+
+	respResult := new(SearchResponse)
+	respResult.Contents = back
+	respResult.Total = total
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	return respResult, nil
+}
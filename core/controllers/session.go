@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"strings"
+	"time"
+)
+
+type LoginTokenX struct {
+	model.LoginToken
+	Current bool `json:"current"` // 是否当前设备
+}
+
+// 当前设备的 Session 令牌和记住登录的 selector
+func currentLoginSelector(c *gin.Context) (string, string) {
+	sessionToken := config.FafaSessionMgr.Load(c.Request).Token()
+	rememberSelector := ""
+	if cookieString, err := c.Cookie("auth"); err == nil {
+		rememberSelector = strings.Split(cookieString, "|")[0]
+	}
+	return sessionToken, rememberSelector
+}
+
+func isCurrentLogin(t *model.LoginToken, sessionToken, rememberSelector string) bool {
+	if t.Types == model.LoginTokenTypeSession {
+		return sessionToken != "" && t.Selector == sessionToken
+	}
+	return rememberSelector != "" && t.Selector == rememberSelector
+}
+
+// 列出自己登录的设备，包括 Session 和记住登录的令牌
+func ListUserSessions(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListUserSessions err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	ts := make([]model.LoginToken, 0)
+	err = config.FafaRdb.Client.Where("user_id=?", uu.Id).And("expire_time>?", time.Now().Unix()).Desc("last_use_time").Find(&ts)
+	if err != nil {
+		flog.Log.Errorf("ListUserSessions err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	sessionToken, rememberSelector := currentLoginSelector(c)
+	back := make([]LoginTokenX, 0, len(ts))
+	for k := range ts {
+		back = append(back, LoginTokenX{LoginToken: ts[k], Current: isCurrentLogin(&ts[k], sessionToken, rememberSelector)})
+	}
+
+	resp.Data = back
+	resp.Flag = true
+}
+
+type RevokeUserSessionsRequest struct {
+	Ids    []int `json:"ids" validate:"dive,gt=0"`
+	Others bool  `json:"others"` // 撤销除当前设备外的全部
+}
+
+// 撤销自己登录的设备
+func RevokeUserSessions(c *gin.Context) {
+	resp := new(Resp)
+	req := new(RevokeUserSessionsRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("RevokeUserSessions err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	if !req.Others && len(req.Ids) == 0 {
+		flog.Log.Errorf("RevokeUserSessions err: %s", "ids empty")
+		resp.Error = Error(ParasError, "ids empty")
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("RevokeUserSessions err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	if req.Others {
+		ts := make([]model.LoginToken, 0)
+		err = config.FafaRdb.Client.Cols("id", "types", "selector").Where("user_id=?", uu.Id).Find(&ts)
+		if err != nil {
+			flog.Log.Errorf("RevokeUserSessions err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		sessionToken, rememberSelector := currentLoginSelector(c)
+		req.Ids = make([]int, 0, len(ts))
+		for k := range ts {
+			if !isCurrentLogin(&ts[k], sessionToken, rememberSelector) {
+				req.Ids = append(req.Ids, ts[k].Id)
+			}
+		}
+
+		if len(req.Ids) == 0 {
+			resp.Flag = true
+			return
+		}
+	}
+
+	err = RevokeUserLogin(uu.Id, req.Ids)
+	if err != nil {
+		flog.Log.Errorf("RevokeUserSessions err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
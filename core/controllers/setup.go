@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util"
+	"sync"
+)
+
+// 一次性的初始化令牌，创建完超级管理员后清空
+var (
+	setupToken string
+	setupLock  sync.Mutex
+)
+
+// 启动时调用，还没有超级管理员时生成初始化令牌，已经有了就把新增的资源同步给超级管理员组
+func InitSetup() (string, error) {
+	ok, err := model.HasSuperAdmin()
+	if err != nil {
+		return "", err
+	}
+
+	if ok {
+		g, _, err := model.GetSuperAdminGroup()
+		if err != nil {
+			return "", err
+		}
+		return "", model.SyncGroupAllResource(g.Id)
+	}
+
+	setupLock.Lock()
+	defer setupLock.Unlock()
+	setupToken = util.GetGUID()
+	return setupToken, nil
+}
+
+type SetupRequest struct {
+	Token      string `json:"token" validate:"required"`
+	Name       string `json:"name" validate:"required,alphanumunicode,gt=1,lt=50"`
+	NickName   string `json:"nick_name" validate:"required,gt=1,lt=50"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"alphanumunicode,gt=5,lt=17"`
+	RePassword string `json:"repassword" validate:"eqfield=Password"`
+}
+
+// 首次运行，用启动时打印的令牌创建超级管理员，只能成功一次
+func Setup(c *gin.Context) {
+	resp := new(Resp)
+	req := new(SetupRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Setup err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	setupLock.Lock()
+	defer setupLock.Unlock()
+
+	if setupToken == "" || subtle.ConstantTimeCompare([]byte(setupToken), []byte(req.Token)) != 1 {
+		flog.Log.Errorf("Setup err: %s", "token wrong")
+		resp.Error = Error(SetupTokenWrong, "")
+		return
+	}
+
+	u := new(model.User)
+	u.Name = req.Name
+	repeat, err := u.IsNameRepeat()
+	if err != nil {
+		flog.Log.Errorf("Setup err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if repeat {
+		flog.Log.Errorf("Setup err: %s", "name already use by other")
+		resp.Error = Error(UserNameAlreadyBeUsed, "")
+		return
+	}
+
+	u.Email = req.Email
+	repeat, err = u.IsEmailRepeat()
+	if err != nil {
+		flog.Log.Errorf("Setup err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if repeat {
+		flog.Log.Errorf("Setup err: %s", "email already use by other")
+		resp.Error = Error(EmailAlreadyBeUsed, "")
+		return
+	}
+
+	u.NickName = req.NickName
+	u.Password, err = util.HashPassword(req.Password)
+	if err != nil {
+		flog.Log.Errorf("Setup err: %s", err.Error())
+		resp.Error = Error(PasswordHashError, err.Error())
+		return
+	}
+
+	err = model.CreateSuperAdmin(u)
+	if err != nil {
+		flog.Log.Errorf("Setup err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// 令牌只能用一次
+	setupToken = ""
+	flog.Log.Noticef("Setup super admin %s done", u.Name)
+
+	u.Password = ""
+	resp.Data = u
+	resp.Flag = true
+}
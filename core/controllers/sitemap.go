@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/patrickmn/go-cache"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 每个分页站点地图最多包含多少个ID，协议上限是50000
+	sitemapPageSize = 10000
+
+	// 分页缓存多久，过期后只重新生成被访问的那一页
+	sitemapExpire = 30 * time.Minute
+)
+
+// 站点地图的三部分：用户，节点，内容
+var sitemapTypes = []string{"user", "node", "content"}
+
+// 分页按ID区间划分，第N页是ID在((N-1)*size, N*size]的记录
+// 新增的记录只会落在最后一页，前面的页在缓存过期前都不用重新查库
+var sitemapCache = cache.New(sitemapExpire, 10*time.Minute)
+
+type sitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapUrlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+type sitemapIndexItem struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name           `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapIndexItem `xml:"sitemap"`
+}
+
+func lastMod(updateTime, createTime int64) string {
+	if updateTime == 0 {
+		updateTime = createTime
+	}
+	if updateTime == 0 {
+		return ""
+	}
+	return time.Unix(updateTime, 0).UTC().Format(time.RFC3339)
+}
+
+// 各部分最大的ID，用来算分页数
+func sitemapMaxIds() (map[string]int, error) {
+	if v, ok := sitemapCache.Get("max"); ok {
+		return v.(map[string]int), nil
+	}
+
+	tables := map[string]interface{}{
+		"user":    new(model.User),
+		"node":    new(model.ContentNode),
+		"content": new(model.Content),
+	}
+
+	back := make(map[string]int)
+	for k, table := range tables {
+		var max int
+		_, err := config.FafaRdb.Client.Table(table).Select("coalesce(max(id), 0)").Get(&max)
+		if err != nil {
+			return nil, err
+		}
+		back[k] = max
+	}
+
+	sitemapCache.SetDefault("max", back)
+	return back, nil
+}
+
+// 生成某部分的某一页，只包括公开的记录
+func sitemapPage(t string, page int) ([]sitemapUrl, error) {
+	key := fmt.Sprintf("%s_%d", t, page)
+	if v, ok := sitemapCache.Get(key); ok {
+		return v.([]sitemapUrl), nil
+	}
+
+	begin, end := (page-1)*sitemapPageSize, page*sitemapPageSize
+	urls := make([]sitemapUrl, 0)
+	switch t {
+	case "user":
+		users := make([]model.User, 0)
+		err := config.FafaRdb.Client.Cols("id", "name", "create_time", "update_time").Where("id>?", begin).And("id<=?", end).And("status=?", 1).Asc("id").Find(&users)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range users {
+			urls = append(urls, sitemapUrl{Loc: userUrl(v.Name), LastMod: lastMod(v.UpdateTime, v.CreateTime)})
+		}
+	case "node":
+		nodes := make([]model.ContentNode, 0)
+		err := config.FafaRdb.Client.Cols("id", "user_name", "seo", "create_time", "update_time").Where("id>?", begin).And("id<=?", end).And("status=?", 0).Asc("id").Find(&nodes)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range nodes {
+			urls = append(urls, sitemapUrl{Loc: nodeUrl(v.UserName, v.Seo), LastMod: lastMod(v.UpdateTime, v.CreateTime)})
+		}
+	case "content":
+		cs := make([]model.Content, 0)
+		err := config.FafaRdb.Client.Cols("id", "user_name", "seo", "create_time", "update_time").Where("id>?", begin).And("id<=?", end).And("status=?", 0).And("version>?", 0).And("password=?", "").Asc("id").Find(&cs)
+		if err != nil {
+			return nil, err
+		}
+		for k := range cs {
+			v := &cs[k]
+			urls = append(urls, sitemapUrl{Loc: contentUrl(v), LastMod: lastMod(v.UpdateTime, v.CreateTime)})
+		}
+	}
+
+	sitemapCache.SetDefault(key, urls)
+	return urls, nil
+}
+
+func writeXml(c *gin.Context, out interface{}) {
+	raw, err := xml.Marshal(out)
+	if err != nil {
+		flog.Log.Errorf("Sitemap err: %s", err.Error())
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), raw...))
+}
+
+// 站点地图，记录少时直接列出全部，多时返回站点地图索引
+// 分页访问：/sitemap.xml?type=content&page=1
+func Sitemap(c *gin.Context) {
+	maxIds, err := sitemapMaxIds()
+	if err != nil {
+		flog.Log.Errorf("Sitemap err: %s", err.Error())
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+
+	t := c.Query("type")
+	if t != "" {
+		page, _ := strconv.Atoi(c.Query("page"))
+		if _, ok := maxIds[t]; !ok || page <= 0 || (page-1)*sitemapPageSize >= maxIds[t] {
+			c.String(http.StatusNotFound, "sitemap not found")
+			return
+		}
+
+		urls, err := sitemapPage(t, page)
+		if err != nil {
+			flog.Log.Errorf("Sitemap err: %s", err.Error())
+			c.String(http.StatusInternalServerError, "")
+			return
+		}
+
+		writeXml(c, sitemapUrlSet{Urls: urls})
+		return
+	}
+
+	total := 0
+	for _, v := range maxIds {
+		total = total + v
+	}
+
+	if total <= sitemapPageSize {
+		set := sitemapUrlSet{Urls: []sitemapUrl{{Loc: siteUrl() + "/"}}}
+		for _, t := range sitemapTypes {
+			if maxIds[t] == 0 {
+				continue
+			}
+
+			urls, err := sitemapPage(t, 1)
+			if err != nil {
+				flog.Log.Errorf("Sitemap err: %s", err.Error())
+				c.String(http.StatusInternalServerError, "")
+				return
+			}
+			set.Urls = append(set.Urls, urls...)
+		}
+
+		writeXml(c, set)
+		return
+	}
+
+	index := sitemapIndex{}
+	for _, t := range sitemapTypes {
+		for page := 1; (page-1)*sitemapPageSize < maxIds[t]; page++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapIndexItem{Loc: fmt.Sprintf("%s/sitemap.xml?type=%s&page=%d", siteUrl(), t, page)})
+		}
+	}
+
+	writeXml(c, index)
+}
+
+// 爬虫规则，在配置中设置，最后会加上站点地图的地址
+func Robots(c *gin.Context) {
+	lines := config.FafaConfig.DefaultConfig.Robots
+	if len(lines) == 0 {
+		lines = []string{"User-agent: *", "Disallow: /v1/"}
+	}
+
+	robots := strings.Join(lines, "\n")
+	if !strings.Contains(strings.ToLower(robots), "sitemap:") {
+		robots = fmt.Sprintf("%s\nSitemap: %s/sitemap.xml", robots, siteUrl())
+	}
+
+	c.String(http.StatusOK, robots+"\n")
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"math"
+)
+
+// 标签云，只统计已经发布的正常内容
+type TagsRequest struct {
+	UserId int `json:"user_id"` // 可以只看某用户的标签
+	Limit  int `json:"limit"`
+}
+
+type TagX struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Num  int64  `json:"num"`
+}
+
+type TagsResponse struct {
+	Tags []TagX `json:"tags"`
+}
+
+func Tags(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(TagsResponse)
+	req := new(TagsRequest)
+	defer func() {
+		JSON(c, 200, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.ContentTag)).Alias("ct").
+		Select("t.id, t.name, count(*) as num").
+		Join("INNER", []string{"fafacms_tag", "t"}, "t.id = ct.tag_id").
+		Join("INNER", []string{"fafacms_content", "c"}, "c.id = ct.content_id").
+		Where("c.status=?", 0).And("c.version>?", 0)
+
+	if req.UserId != 0 {
+		session.And("ct.user_id=?", req.UserId)
+	}
+
+	tags := make([]TagX, 0)
+	err := session.GroupBy("t.id, t.name").Desc("num").Limit(req.Limit).Find(&tags)
+	if err != nil {
+		flog.Log.Errorf("Tags err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	respResult.Tags = tags
+	resp.Data = respResult
+	resp.Flag = true
+}
+
+// 列出某标签下已发布的内容
+type TagContentsRequest struct {
+	Id     int      `json:"id"`
+	Name   string   `json:"name"`
+	UserId int      `json:"user_id"`
+	Sort   []string `json:"sort" validate:"dive,lt=100"`
+	PageHelp
+}
+
+type TagContentsResponse struct {
+	Tag      model.Tag   `json:"tag"`
+	Contents []ContentsX `json:"contents"`
+	PageHelp
+}
+
+func TagContents(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(TagContentsResponse)
+	req := new(TagContentsRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("TagContents err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	if req.Id == 0 && req.Name == "" {
+		flog.Log.Errorf("TagContents err: %s", "where is empty")
+		resp.Error = Error(ParasError, "where is empty")
+		return
+	}
+
+	tag := new(model.Tag)
+	tag.Id = req.Id
+	tag.Name = req.Name
+	exist, err := tag.Get()
+	if err != nil {
+		flog.Log.Errorf("TagContents err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("TagContents err: %s", "tag not found")
+		resp.Error = Error(TagNotFound, "")
+		return
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	session.Table(new(model.Content)).Where("1=1")
+	session.And("id in (select content_id from fafacms_content_tag where tag_id=?)", tag.Id)
+	session.And("status=?", 0).And("version>?", 0)
+
+	if req.UserId != 0 {
+		session.And("user_id=?", req.UserId)
+	}
+
+	countSession := session.Clone()
+	defer countSession.Close()
+	total, err := countSession.Count()
+	if err != nil {
+		flog.Log.Errorf("TagContents err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	cs := make([]model.Content, 0)
+	p := &req.PageHelp
+	if total == 0 {
+	} else {
+		p.build(session, req.Sort, model.ContentSortName)
+		err = session.Omit("describe", "pre_describe").Find(&cs)
+		if err != nil {
+			flog.Log.Errorf("TagContents err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	bcs := make([]ContentsX, 0, len(cs))
+	for _, c := range cs {
+		bcs = append(bcs, content2ContentsX(c))
+	}
+
+	err = fillContentsTags(bcs)
+	if err != nil {
+		flog.Log.Errorf("TagContents err:%s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	respResult.Tag = *tag
+	respResult.Contents = bcs
+	p.Pages = int(math.Ceil(float64(total) / float64(p.Limit)))
+	respResult.PageHelp = *p
+	resp.Data = respResult
+	resp.Flag = true
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util"
+	"strings"
+	"time"
+)
+
+const (
+	accessTokenPrefix = "fafa_"
+	tokenUserKey      = "token_user"
+
+	// 令牌不能用来管理令牌，防止限定范围的令牌给自己换一个不限范围的
+	tokenPathPrefix = "/v1/user/tokens"
+)
+
+// 从 Authorization: Bearer xxx 中取令牌
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// 校验令牌，不存在或过期返回nil
+func checkAccessToken(raw string) (*model.AccessToken, error) {
+	if !strings.HasPrefix(raw, accessTokenPrefix) {
+		return nil, nil
+	}
+
+	t := new(model.AccessToken)
+	t.TokenHash, _ = util.Sha256([]byte(raw))
+	ok, err := t.GetByHash()
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	// 一分钟内用过的不再更新，避免每个请求都写库
+	if time.Now().Unix()-t.LastUseTime > 60 {
+		err = t.UpdateLastUseTime()
+		if err != nil {
+			flog.Log.Errorf("checkAccessToken err: %s", err.Error())
+		}
+	}
+	return t, nil
+}
+
+// 令牌限定了范围时，访问的地址如果是资源，必须在范围内
+func tokenInScope(t *model.AccessToken, url string) (bool, error) {
+	if t.Scopes == "" {
+		return true, nil
+	}
+
+	r := new(model.Resource)
+	r.Url = url
+	ok, err := r.GetByUrl()
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return true, nil
+	}
+	return t.InScope(r.Id), nil
+}
+
+type AccessTokenX struct {
+	model.AccessToken
+	Scopes []int  `json:"scopes"`
+	Token  string `json:"token,omitempty"` // 只在创建时返回
+}
+
+func accessTokenX(t *model.AccessToken) AccessTokenX {
+	return AccessTokenX{AccessToken: *t, Scopes: t.ScopeIds()}
+}
+
+// 列出自己的令牌
+func ListAccessToken(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("ListAccessToken err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	ts := make([]model.AccessToken, 0)
+	err = config.FafaRdb.Client.Where("user_id=?", uu.Id).Desc("id").Find(&ts)
+	if err != nil {
+		flog.Log.Errorf("ListAccessToken err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	back := make([]AccessTokenX, 0, len(ts))
+	for k := range ts {
+		back = append(back, accessTokenX(&ts[k]))
+	}
+
+	resp.Data = back
+	resp.Flag = true
+}
+
+type CreateAccessTokenRequest struct {
+	Name       string `json:"name" validate:"required,lt=100"`
+	Scopes     []int  `json:"scopes" validate:"dive,gt=0"`           // 资源id，为空表示和用户组的权限一样
+	ExpireDays int    `json:"expire_days" validate:"gte=0,lte=3650"` // 为0表示不过期
+}
+
+// 创建令牌，明文只返回这一次
+func CreateAccessToken(c *gin.Context) {
+	resp := new(Resp)
+	req := new(CreateAccessTokenRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("CreateAccessToken err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CreateAccessToken err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	if len(req.Scopes) > 0 {
+		num, err := config.FafaRdb.Client.In("id", req.Scopes).Count(new(model.Resource))
+		if err != nil {
+			flog.Log.Errorf("CreateAccessToken err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if int(num) != len(req.Scopes) {
+			flog.Log.Errorf("CreateAccessToken err: %s", "resource not found")
+			resp.Error = Error(ResourceCountNumNotRight, "")
+			return
+		}
+	}
+
+	raw, err := util.RandomHex(20)
+	if err != nil {
+		flog.Log.Errorf("CreateAccessToken err: %s", err.Error())
+		resp.Error = Error(Unknown, err.Error())
+		return
+	}
+	raw = accessTokenPrefix + raw
+
+	t := new(model.AccessToken)
+	t.UserId = uu.Id
+	t.Name = req.Name
+	t.Prefix = raw[:len(accessTokenPrefix)+4]
+	t.TokenHash, _ = util.Sha256([]byte(raw))
+	t.SetScopeIds(req.Scopes)
+	if req.ExpireDays > 0 {
+		t.ExpireTime = time.Now().Add(time.Duration(req.ExpireDays) * 24 * time.Hour).Unix()
+	}
+
+	err = t.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("CreateAccessToken err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	back := accessTokenX(t)
+	back.Token = raw
+	resp.Data = back
+	resp.Flag = true
+}
+
+type RevokeAccessTokenRequest struct {
+	Ids []int `json:"ids" validate:"required,dive,gt=0"`
+}
+
+// 撤销自己的令牌
+func RevokeAccessToken(c *gin.Context) {
+	resp := new(Resp)
+	req := new(RevokeAccessTokenRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("RevokeAccessToken err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("RevokeAccessToken err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	_, err = model.DeleteAccessTokens(uu.Id, req.Ids)
+	if err != nil {
+		flog.Log.Errorf("RevokeAccessToken err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	"github.com/hunterhug/fafacms/core/util"
+	"github.com/hunterhug/fafacms/core/util/totp"
+	"strings"
+	"time"
+)
+
+const (
+	// 密码验证通过后，多久内要输入两步验证码
+	totpPendingExpire = 5 * time.Minute
+
+	// 最多可以输错几次，超过要重新登录
+	totpPendingTimes = 5
+
+	// 恢复码个数
+	totpRecoveryNum = 10
+
+	// 两步验证相关的路由，强制开启两步验证的组的用户只能访问这些
+	totpPathPrefix = "/v1/user/totp/"
+)
+
+// 密码对了但还没有通过两步验证，这个状态保存在Session中
+type totpPending struct {
+	UserId     int
+	Remember   bool
+	ExpireTime int64
+	Times      int
+}
+
+func getTotpPending(c *gin.Context) (*totpPending, error) {
+	p := new(totpPending)
+	s := config.FafaSessionMgr.Load(c.Request)
+	err := s.GetObject("totp_pending", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.UserId == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func setTotpPending(c *gin.Context, p *totpPending) error {
+	s := config.FafaSessionMgr.Load(c.Request)
+	return s.PutObject(c.Writer, "totp_pending", p)
+}
+
+func deleteTotpPending(c *gin.Context) error {
+	s := config.FafaSessionMgr.Load(c.Request)
+	return s.Remove(c.Writer, "totp_pending")
+}
+
+// 生成恢复码，返回明文和保存用的哈希
+func newTotpRecovery() ([]string, string, error) {
+	codes := make([]string, 0, totpRecoveryNum)
+	hashes := make([]string, 0, totpRecoveryNum)
+	for i := 0; i < totpRecoveryNum; i++ {
+		code, err := util.RandomHex(5)
+		if err != nil {
+			return nil, "", err
+		}
+
+		hash, _ := util.Sha256([]byte(code))
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+// 校验两步验证码或者恢复码，通过后会更新用户，同一个码不能用第二次
+func checkTotpCode(u *model.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if counter, ok := totp.Validate(u.TotpSecret, code, time.Now(), u.TotpLastCounter); ok {
+		u.TotpLastCounter = counter
+		return true, u.UpdateTotp()
+	}
+
+	if u.TotpRecovery == "" {
+		return false, nil
+	}
+
+	hash, _ := util.Sha256([]byte(strings.ToLower(code)))
+	hashes := strings.Split(u.TotpRecovery, ",")
+	for k, v := range hashes {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(hash)) == 1 {
+			u.TotpRecovery = strings.Join(append(hashes[:k], hashes[k+1:]...), ",")
+			return true, u.UpdateTotp()
+		}
+	}
+	return false, nil
+}
+
+// 用户所在的组（包括继承的）是否有强制开启两步验证的
+func isTotpForced(u *model.User) (bool, error) {
+	groupIds, err := model.GetUserAllGroupIds(u.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if len(groupIds) == 0 {
+		return false, nil
+	}
+
+	num, err := config.FafaRdb.Client.In("id", groupIds).And("force_totp=?", 1).Count(new(model.Group))
+	return num > 0, err
+}
+
+type LoginTotpRequest struct {
+	Code string `json:"code" validate:"required,lt=20"`
+}
+
+// 登录第二步，输入两步验证码或恢复码
+func LoginTotp(c *gin.Context) {
+	resp := new(Resp)
+	req := new(LoginTotpRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	p, _ := getTotpPending(c)
+	if p == nil || p.ExpireTime < time.Now().Unix() {
+		flog.Log.Errorf("LoginTotp err: %s", "pending expired")
+		deleteTotpPending(c)
+		resp.Error = Error(TotpPendingExpired, "")
+		return
+	}
+
+	p.Times = p.Times + 1
+	if p.Times > totpPendingTimes {
+		flog.Log.Errorf("LoginTotp err: %s", "too many times")
+		deleteTotpPending(c)
+		resp.Error = Error(TotpPendingExpired, "")
+		return
+	}
+
+	err = setTotpPending(c, p)
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(SetUserSessionError, err.Error())
+		return
+	}
+
+	uu := new(model.User)
+	uu.Id = p.UserId
+	err = uu.Get()
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(UserNotFound, err.Error())
+		return
+	}
+
+	ok, err := checkTotpCode(uu, req.Code)
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !ok {
+		flog.Log.Errorf("LoginTotp err: %s", "code wrong")
+
+		// 验证码错误也算登录失败，防止反复用密码登录来猜验证码
+		if wait := loginFail(uu.Name); wait > 0 {
+			deleteTotpPending(c)
+			resp.Error = Error(LoginLocked, fmt.Sprintf("retry after %ds", retrySeconds(wait)))
+			return
+		}
+		resp.Error = Error(TotpCodeWrong, "")
+		return
+	}
+
+	loginSuccess(uu.Name)
+
+	err = deleteTotpPending(c)
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(SetUserSessionError, err.Error())
+		return
+	}
+
+	c.Set("uid", uu.Id)
+	err = SetUserSession(c, uu)
+	if err != nil {
+		flog.Log.Errorf("LoginTotp err: %s", err.Error())
+		resp.Error = Error(SetUserSessionError, err.Error())
+		return
+	}
+
+	if p.Remember {
+		err = SetRememberToken(c, uu.Id)
+		if err != nil {
+			flog.Log.Errorf("LoginTotp err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+	}
+
+	resp.Flag = true
+}
+
+type TotpEnrollResponse struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"` // 生成二维码给验证器应用扫
+}
+
+// 生成两步验证的密钥，还需要验证一次才开启
+func TotpEnroll(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("TotpEnroll err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	u := new(model.User)
+	u.Id = uu.Id
+	err = u.Get()
+	if err != nil {
+		flog.Log.Errorf("TotpEnroll err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if u.TotpEnable == 1 {
+		flog.Log.Errorf("TotpEnroll err: %s", "already enable")
+		resp.Error = Error(TotpAlreadyEnable, "")
+		return
+	}
+
+	u.TotpSecret, err = totp.GenerateSecret()
+	if err != nil {
+		flog.Log.Errorf("TotpEnroll err: %s", err.Error())
+		resp.Error = Error(Unknown, err.Error())
+		return
+	}
+
+	u.TotpRecovery = ""
+	u.TotpLastCounter = 0
+	err = u.UpdateTotp()
+	if err != nil {
+		flog.Log.Errorf("TotpEnroll err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = TotpEnrollResponse{Secret: u.TotpSecret, Uri: totp.ProvisioningURI(u.TotpSecret, siteName, u.Name)}
+	resp.Flag = true
+}
+
+type TotpEnableRequest struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+// 输入验证器上的验证码，开启两步验证，返回恢复码，只显示这一次
+func TotpEnable(c *gin.Context) {
+	resp := new(Resp)
+	req := new(TotpEnableRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("TotpEnable err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("TotpEnable err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	u := new(model.User)
+	u.Id = uu.Id
+	err = u.Get()
+	if err != nil {
+		flog.Log.Errorf("TotpEnable err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if u.TotpEnable == 1 {
+		flog.Log.Errorf("TotpEnable err: %s", "already enable")
+		resp.Error = Error(TotpAlreadyEnable, "")
+		return
+	}
+
+	if u.TotpSecret == "" {
+		flog.Log.Errorf("TotpEnable err: %s", "not enroll")
+		resp.Error = Error(TotpNotEnroll, "")
+		return
+	}
+
+	counter, ok := totp.Validate(u.TotpSecret, req.Code, time.Now(), 0)
+	if !ok {
+		flog.Log.Errorf("TotpEnable err: %s", "code wrong")
+		resp.Error = Error(TotpCodeWrong, "")
+		return
+	}
+
+	codes, hashes, err := newTotpRecovery()
+	if err != nil {
+		flog.Log.Errorf("TotpEnable err: %s", err.Error())
+		resp.Error = Error(Unknown, err.Error())
+		return
+	}
+
+	u.TotpEnable = 1
+	u.TotpLastCounter = counter
+	u.TotpRecovery = hashes
+	err = u.UpdateTotp()
+	if err != nil {
+		flog.Log.Errorf("TotpEnable err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	c.Set(auditSkipOutKey, true)
+	resp.Data = codes
+	resp.Flag = true
+}
+
+type TotpPasswordRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func totpPasswordHelper(c *gin.Context, name string) (*model.User, *ErrorResp) {
+	req := new(TotpPasswordRequest)
+	if errResp := ParseJSON(c, req); errResp != nil {
+		return nil, errResp
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("%s err: %s", name, err.Error())
+		return nil, Error(ParasError, err.Error())
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("%s err: %s", name, err.Error())
+		return nil, Error(GetUserSessionError, err.Error())
+	}
+
+	u := new(model.User)
+	u.Id = uu.Id
+	err = u.Get()
+	if err != nil {
+		flog.Log.Errorf("%s err: %s", name, err.Error())
+		return nil, Error(DBError, err.Error())
+	}
+
+	// 再输一次密码
+	if !util.CheckPassword(u.Password, req.Password) {
+		flog.Log.Errorf("%s err: %s", name, "password wrong")
+		return nil, Error(LoginWrong, "")
+	}
+
+	if u.TotpEnable != 1 {
+		flog.Log.Errorf("%s err: %s", name, "not enable")
+		return nil, Error(TotpNotEnroll, "")
+	}
+
+	return u, nil
+}
+
+// 关闭两步验证，需要密码
+func TotpDisable(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	u, errResp := totpPasswordHelper(c, "TotpDisable")
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	forced, err := isTotpForced(u)
+	if err != nil {
+		flog.Log.Errorf("TotpDisable err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if forced {
+		flog.Log.Errorf("TotpDisable err: %s", "group force")
+		resp.Error = Error(TotpForce, "")
+		return
+	}
+
+	u.TotpEnable = 0
+	u.TotpSecret = ""
+	u.TotpRecovery = ""
+	u.TotpLastCounter = 0
+	err = u.UpdateTotp()
+	if err != nil {
+		flog.Log.Errorf("TotpDisable err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
+
+// 重新生成恢复码，旧的作废，需要密码
+func TotpRecovery(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	u, errResp := totpPasswordHelper(c, "TotpRecovery")
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	codes, hashes, err := newTotpRecovery()
+	if err != nil {
+		flog.Log.Errorf("TotpRecovery err: %s", err.Error())
+		resp.Error = Error(Unknown, err.Error())
+		return
+	}
+
+	u.TotpRecovery = hashes
+	err = u.UpdateTotp()
+	if err != nil {
+		flog.Log.Errorf("TotpRecovery err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	c.Set(auditSkipOutKey, true)
+	resp.Data = codes
+	resp.Flag = true
+}
@@ -0,0 +1,738 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+	myutil "github.com/hunterhug/fafacms/core/util"
+	"github.com/hunterhug/fafacms/core/util/storage"
+	"github.com/hunterhug/parrot/util"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 每种上传类型的大小限制，可在配置中修改
+var FileMaxBytes = map[string]int64{
+	"image": 1 << 25, // 图片要读到内存中裁剪，不要太大
+	"flash": 1 << 25,
+	"media": 1 << 30,
+	"file":  1 << 28,
+	"other": 1 << 25,
+}
+
+var (
+	uploadTempPath  string
+	uploadChunkSize int64 = 5 << 20
+
+	// 用户和所在组都没有设置时的配额
+	uploadQuota model.Quota
+)
+
+// 上传的临时目录和大小限制，并定时清理没有完成的分片上传
+func InitUpload(conf config.UploadConfig, storagePath string) error {
+	for k, v := range conf.MaxSize {
+		if _, ok := FileAllow[k]; !ok {
+			return fmt.Errorf("upload type %s not exist", k)
+		}
+		if v > 0 {
+			FileMaxBytes[k] = v
+		}
+	}
+
+	uploadTempPath = conf.TempPath
+	if uploadTempPath == "" {
+		uploadTempPath = storagePath + "_tmp"
+	}
+
+	err := os.MkdirAll(uploadTempPath, 0777)
+	if err != nil {
+		return err
+	}
+
+	if conf.ChunkSize > 0 {
+		uploadChunkSize = conf.ChunkSize
+	}
+
+	uploadQuota = model.Quota{Size: conf.QuotaSize, Count: conf.QuotaCount}
+
+	expire := conf.ExpireHour
+	if expire <= 0 {
+		expire = 24
+	}
+
+	go uploadCleaner(time.Duration(expire) * time.Hour)
+	return nil
+}
+
+// 所有类型中最大的限制
+func maxFileBytes() int64 {
+	var max int64
+	for _, v := range FileMaxBytes {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// 检查上传类型和文件后缀，返回后缀和该类型的大小限制
+func checkUploadType(fileType string, fileName string) (string, int64, *ErrorResp) {
+	fileAllowArray, ok := FileAllow[fileType]
+	if !ok {
+		flog.Log.Errorf("upload err: type not permit")
+		return "", 0, Error(UploadFileTypeNotPermit, "")
+	}
+
+	fileSuffix := util.GetFileSuffix(fileName)
+	if !util.InArray(fileAllowArray, fileSuffix) {
+		flog.Log.Errorf("upload err: file suffix: %s not permit", fileSuffix)
+		return "", 0, Error(UploadFileTypeNotPermit, fmt.Sprintf("file suffix: %s not permit", fileSuffix))
+	}
+
+	return fileSuffix, FileMaxBytes[fileType], nil
+}
+
+// 流式写到临时文件，边写边算哈希，返回的文件已经回到开头
+func spoolUpload(src io.Reader, limit int64) (*os.File, int64, string, *ErrorResp) {
+	tmp, err := ioutil.TempFile(uploadTempPath, "upload_")
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return nil, 0, "", Error(UploadFileError, err.Error())
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(src, limit+1))
+	if err != nil {
+		removeTemp(tmp)
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return nil, 0, "", Error(UploadFileError, err.Error())
+	}
+
+	if size > limit {
+		removeTemp(tmp)
+		flog.Log.Errorf("upload err: file size too big: %d", size)
+		return nil, 0, "", Error(UploadFileTooMaxLimit, fmt.Sprintf(" file size too big: %d", size))
+	}
+
+	// 空文件报错
+	if size == 0 {
+		removeTemp(tmp)
+		flog.Log.Errorf("upload err:%s", "file empty")
+		return nil, 0, "", Error(UploadFileError, "file empty")
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		removeTemp(tmp)
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return nil, 0, "", Error(UploadFileError, err.Error())
+	}
+
+	return tmp, size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 检查配额，加上这个文件后大小和个数都不能超过
+func checkQuota(userId int, size int64) *ErrorResp {
+	q, err := model.GetUserQuota(userId, uploadQuota)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return Error(DBError, err.Error())
+	}
+
+	if q.Size == 0 && q.Count == 0 {
+		return nil
+	}
+
+	used, err := model.GetFileUsage(userId)
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return Error(DBError, err.Error())
+	}
+
+	if q.Size > 0 && used.Size+size > q.Size {
+		flog.Log.Errorf("upload err: quota size %d+%d over %d", used.Size, size, q.Size)
+		return Error(UploadQuotaExceeded, fmt.Sprintf("size %d+%d over %d", used.Size, size, q.Size))
+	}
+
+	if q.Count > 0 && used.Count+1 > q.Count {
+		flog.Log.Errorf("upload err: quota count %d over %d", used.Count+1, q.Count)
+		return Error(UploadQuotaExceeded, fmt.Sprintf("count %d over %d", used.Count+1, q.Count))
+	}
+	return nil
+}
+
+func removeTemp(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+type uploadMeta struct {
+	Type     string
+	Tag      string
+	Describe string
+	RealName string
+	Suffix   string
+}
+
+// 临时文件存到默认的存储后端，同一个用户相同的文件只保存一次
+func storeUpload(uu *model.User, meta uploadMeta, tmp *os.File, size int64, hash string) (*UploadResponse, *ErrorResp) {
+	uName := uu.Name
+	data := new(UploadResponse)
+
+	// 不相信后缀，按内容判断
+	contentType, errResp := sniffUpload(tmp, meta.Suffix)
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	// 哈希需要再加上用户唯一标志，方便不同用户可以上传一样的文件
+	fileHashCode := uName + "_" + hash
+	fileName := fileHashCode + "." + meta.Suffix
+
+	// 判断数据库文件是否存在
+	p := new(model.File)
+	p.HashCode = fileHashCode
+	exist, err := p.Get()
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return nil, Error(DBError, err.Error())
+	}
+
+	if !exist {
+		// 相同的文件不再占用配额
+		errResp = checkQuota(uu.Id, size)
+		if errResp != nil {
+			return nil, errResp
+		}
+
+		storeType, store := config.FafaStorage.Default()
+		p.StoreType = storeType
+		p.StoreKey = fmt.Sprintf("storage/%s/%s/%s", uName, meta.Type, fileName)
+		p.Url = store.URL(p.StoreKey)
+		p.UrlHashCode, _ = myutil.Sha256([]byte(p.Url))
+
+		// 图片要解码校验，去掉元数据，生成缩略图
+		if util.InArray(pictureType, meta.Suffix) {
+			size, errResp = storePicture(store, p, tmp, meta.Suffix, contentType)
+			if errResp != nil {
+				return nil, errResp
+			}
+		} else {
+			err = store.Put(p.StoreKey, tmp, size, contentType)
+			if err != nil {
+				flog.Log.Errorf("upload err:%s", err.Error())
+				return nil, Error(UploadFileError, err.Error())
+			}
+		}
+
+		p.Type = meta.Type
+		p.FileName = fileName
+		p.ReallyFileName = meta.RealName
+		p.CreateTime = time.Now().Unix()
+		p.Describe = meta.Describe
+		p.UserId = uu.Id
+		p.UserName = uName
+		p.Tag = meta.Tag
+		p.Size = size
+		_, err = config.FafaRdb.InsertOne(p)
+		if err != nil {
+			flog.Log.Errorf("upload err:%s", err.Error())
+			return nil, Error(DBError, err.Error())
+		}
+	} else {
+		// 文件存在
+		data.Addon = "file the same in server"
+		if p.Status != 0 {
+			// 如果被隐藏了额，应该改回来
+			p.Status = 0
+			p.UpdateStatus()
+		}
+	}
+
+	// 返回基本信息
+	data.FileName = p.FileName
+	data.IsPicture = p.IsPicture == 1
+	data.Size = p.Size
+	data.Url = p.Url
+	data.Oss = p.StoreType == storage.TypeOss
+	data.StoreType = p.StoreType
+	data.Thumbs = fileThumbUrls(p)
+	data.Url_X = data.Thumbs["x"]
+	return data, nil
+}
+
+// 分片放在临时目录下，每个上传一个目录，文件名为分片序号
+func uploadPartDir(uploadId string) string {
+	return filepath.Join(uploadTempPath, "chunk_"+uploadId)
+}
+
+// 已经上传了的分片序号
+func uploadParts(u *model.FileUpload) ([]int, error) {
+	fs, err := ioutil.ReadDir(uploadPartDir(u.UploadId))
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]int, 0, len(fs))
+	for _, f := range fs {
+		index, err := strconv.Atoi(f.Name())
+		if err != nil || f.Size() != u.PartSize(index) {
+			continue
+		}
+		parts = append(parts, index)
+	}
+	sort.Ints(parts)
+	return parts, nil
+}
+
+// 取自己的分片上传
+func getFileUpload(userId int, uploadId string) (*model.FileUpload, *ErrorResp) {
+	if uploadId == "" {
+		flog.Log.Errorf("upload err:%s", "upload id empty")
+		return nil, Error(UploadNotFound, "")
+	}
+
+	u := new(model.FileUpload)
+	u.UserId = userId
+	u.UploadId = uploadId
+	ok, err := u.Get()
+	if err != nil {
+		flog.Log.Errorf("upload err:%s", err.Error())
+		return nil, Error(DBError, err.Error())
+	}
+
+	if !ok {
+		flog.Log.Errorf("upload err:%s", "upload not found")
+		return nil, Error(UploadNotFound, "")
+	}
+	return u, nil
+}
+
+func removeFileUpload(u *model.FileUpload) error {
+	err := os.RemoveAll(uploadPartDir(u.UploadId))
+	if err != nil {
+		return err
+	}
+	return u.Delete()
+}
+
+// 定时清理太久没有完成的分片上传，以及异常退出时留下的临时文件
+func uploadCleaner(expire time.Duration) {
+	for {
+		before := time.Now().Add(-expire)
+		us, err := model.ListExpiredFileUpload(before.Unix())
+		if err != nil {
+			flog.Log.Errorf("clean upload err:%s", err.Error())
+		}
+
+		for k := range us {
+			err = removeFileUpload(&us[k])
+			if err != nil {
+				flog.Log.Errorf("clean upload err:%s", err.Error())
+			}
+		}
+
+		fs, _ := ioutil.ReadDir(uploadTempPath)
+		for _, f := range fs {
+			if !f.IsDir() && strings.HasPrefix(f.Name(), "upload_") && f.ModTime().Before(before) {
+				os.Remove(filepath.Join(uploadTempPath, f.Name()))
+			}
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
+
+type UploadInitRequest struct {
+	Type     string `json:"type"`
+	Tag      string `json:"tag" validate:"lt=100"`
+	Describe string `json:"describe"`
+	FileName string `json:"file_name" validate:"required,lt=255"`
+	Size     int64  `json:"size" validate:"gt=0"`
+}
+
+// 开始分片上传，返回分片的大小和数量
+func UploadInit(c *gin.Context) {
+	resp := new(Resp)
+	req := new(UploadInitRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UploadInit err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UploadInit err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = "other"
+	}
+
+	if req.Tag == "" {
+		req.Tag = "other"
+	}
+
+	_, limit, errResp := checkUploadType(req.Type, req.FileName)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	if req.Size > limit {
+		flog.Log.Errorf("UploadInit err: file size too big: %d", req.Size)
+		resp.Error = Error(UploadFileTooMaxLimit, fmt.Sprintf(" file size too big: %d", req.Size))
+		return
+	}
+
+	// 先检查一次，免得传完了才发现超了
+	errResp = checkQuota(uu.Id, req.Size)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	uploadId, err := myutil.RandomHex(16)
+	if err != nil {
+		flog.Log.Errorf("UploadInit err: %s", err.Error())
+		resp.Error = Error(Unknown, err.Error())
+		return
+	}
+
+	u := new(model.FileUpload)
+	u.UploadId = uploadId
+	u.UserId = uu.Id
+	u.Type = req.Type
+	u.Tag = req.Tag
+	u.Describe = req.Describe
+	u.FileName = req.FileName
+	u.Size = req.Size
+	u.ChunkSize = uploadChunkSize
+	u.Chunks = int((req.Size + uploadChunkSize - 1) / uploadChunkSize)
+
+	err = os.MkdirAll(uploadPartDir(u.UploadId), 0777)
+	if err != nil {
+		flog.Log.Errorf("UploadInit err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	err = u.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("UploadInit err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = u
+	resp.Flag = true
+}
+
+/*
+upload_id: 开始分片上传时返回的
+index: 分片序号，从0开始，重复上传会覆盖
+file: 分片内容
+*/
+func UploadPart(c *gin.Context) {
+	resp := new(Resp)
+	defer func() {
+		JSONL(c, 200, nil, resp)
+	}()
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadChunkSize+1<<20)
+
+	u, errResp := getFileUpload(uu.Id, c.PostForm("upload_id"))
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	index, err := strconv.Atoi(c.PostForm("index"))
+	if err != nil || index < 0 || index >= u.Chunks {
+		flog.Log.Errorf("UploadPart err: index wrong")
+		resp.Error = Error(UploadPartWrong, "index wrong")
+		return
+	}
+
+	h, err := c.FormFile("file")
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	f, err := h.Open()
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	defer f.Close()
+
+	// 先写临时文件再改名，没写完的分片不会被当成已上传
+	partName := filepath.Join(uploadPartDir(u.UploadId), strconv.Itoa(index))
+	part, err := os.Create(partName + ".tmp")
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	want := u.PartSize(index)
+	num, err := io.Copy(part, io.LimitReader(f, want+1))
+	part.Close()
+	if err != nil || num != want {
+		os.Remove(partName + ".tmp")
+		flog.Log.Errorf("UploadPart err: part size %d not %d", num, want)
+		resp.Error = Error(UploadPartWrong, fmt.Sprintf("part size must be %d", want))
+		return
+	}
+
+	err = os.Rename(partName+".tmp", partName)
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	err = u.Touch()
+	if err != nil {
+		flog.Log.Errorf("UploadPart err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
+
+type UploadIdRequest struct {
+	UploadId string `json:"upload_id" validate:"required,lt=64"`
+}
+
+type UploadStatusResponse struct {
+	Upload *model.FileUpload `json:"upload"`
+	Parts  []int             `json:"parts"` // 已经上传的分片序号，断点续传时跳过
+}
+
+// 查看分片上传的进度
+func UploadStatus(c *gin.Context) {
+	resp := new(Resp)
+	req := new(UploadIdRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UploadStatus err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UploadStatus err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	u, errResp := getFileUpload(uu.Id, req.UploadId)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	parts, err := uploadParts(u)
+	if err != nil {
+		flog.Log.Errorf("UploadStatus err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	resp.Data = UploadStatusResponse{Upload: u, Parts: parts}
+	resp.Flag = true
+}
+
+// 分片全部上传后合并，和普通上传一样保存
+func UploadComplete(c *gin.Context) {
+	resp := new(Resp)
+	req := new(UploadIdRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UploadComplete err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UploadComplete err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	u, errResp := getFileUpload(uu.Id, req.UploadId)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	parts, err := uploadParts(u)
+	if err != nil {
+		flog.Log.Errorf("UploadComplete err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	if len(parts) != u.Chunks {
+		flog.Log.Errorf("UploadComplete err: parts %d not %d", len(parts), u.Chunks)
+		resp.Error = Error(UploadNotComplete, fmt.Sprintf("parts %d/%d", len(parts), u.Chunks))
+		return
+	}
+
+	fileSuffix, limit, errResp := checkUploadType(u.Type, u.FileName)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, index := range parts {
+		f, err := os.Open(filepath.Join(uploadPartDir(u.UploadId), strconv.Itoa(index)))
+		if err != nil {
+			flog.Log.Errorf("UploadComplete err: %s", err.Error())
+			resp.Error = Error(UploadFileError, err.Error())
+			return
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	tmp, size, hash, errResp := spoolUpload(io.MultiReader(readers...), limit)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	defer removeTemp(tmp)
+
+	if size != u.Size {
+		flog.Log.Errorf("UploadComplete err: size %d not %d", size, u.Size)
+		resp.Error = Error(UploadPartWrong, fmt.Sprintf("size %d not %d", size, u.Size))
+		return
+	}
+
+	data, errResp := storeUpload(uu, uploadMeta{
+		Type:     u.Type,
+		Tag:      u.Tag,
+		Describe: u.Describe,
+		RealName: u.FileName,
+		Suffix:   fileSuffix,
+	}, tmp, size, hash)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	err = removeFileUpload(u)
+	if err != nil {
+		flog.Log.Errorf("UploadComplete err: %s", err.Error())
+	}
+
+	resp.Data = data
+	resp.Flag = true
+}
+
+// 放弃分片上传
+func UploadAbort(c *gin.Context) {
+	resp := new(Resp)
+	req := new(UploadIdRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("UploadAbort err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("UploadAbort err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	u, errResp := getFileUpload(uu.Id, req.UploadId)
+	if errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	err = removeFileUpload(u)
+	if err != nil {
+		flog.Log.Errorf("UploadAbort err: %s", err.Error())
+		resp.Error = Error(UploadFileError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
@@ -108,7 +108,13 @@ func RegisterUser(c *gin.Context) {
 	u.ActivateCodeExpired = time.Now().Add(48 * time.Hour).Unix()
 	u.Describe = req.Describe
 	u.NickName = req.NickName
-	u.Password = req.Password
+	u.Password, err = util.HashPassword(req.Password)
+	if err != nil {
+		flog.Log.Errorf("RegisterUser err:%s", err.Error())
+		resp.Error = Error(PasswordHashError, err.Error())
+		return
+	}
+
 	u.Gender = req.Gender
 	u.WeChat = req.WeChat
 	u.QQ = req.QQ
@@ -213,7 +219,13 @@ func CreateUser(c *gin.Context) {
 
 	u.Describe = req.Describe
 	u.NickName = req.NickName
-	u.Password = req.Password
+	u.Password, err = util.HashPassword(req.Password)
+	if err != nil {
+		flog.Log.Errorf("CreateUser err:%s", err.Error())
+		resp.Error = Error(PasswordHashError, err.Error())
+		return
+	}
+
 	u.Gender = req.Gender
 	u.WeChat = req.WeChat
 	u.QQ = req.QQ
@@ -229,6 +241,7 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	u.Password = ""
 	resp.Flag = true
 	resp.Data = u
 }
@@ -504,7 +517,13 @@ func ChangePasswordOfUser(c *gin.Context) {
 
 	// 验证码一致，可以修改
 	if u.ResetCode == req.Code {
-		u.Password = req.Password
+		u.Password, err = util.HashPassword(req.Password)
+		if err != nil {
+			flog.Log.Errorf("ChangePassword err:%s", err.Error())
+			resp.Error = Error(PasswordHashError, err.Error())
+			return
+		}
+
 		err = u.UpdatePassword()
 		if err != nil {
 			flog.Log.Errorf("ChangePassword err:%s", err.Error())
@@ -517,9 +536,14 @@ func ChangePasswordOfUser(c *gin.Context) {
 		return
 	}
 
-	// 更改密码后需要删除登录信息
+	// 更改密码后需要删除所有设备的登录信息
+	err = RevokeUserLogin(u.Id, nil)
+	if err != nil {
+		flog.Log.Errorf("ChangePassword err:%s", err.Error())
+	}
+
 	DeleteUserSession(c)
-	c.SetCookie("auth", "", 0, "", "", false, false)
+	c.SetCookie("auth", "", -1, "/", "", false, true)
 	resp.Flag = true
 }
 
@@ -796,7 +820,7 @@ func ListGroupUser(c *gin.Context) {
 	users := make([]model.User, 0)
 
 	// group list where prepare
-	err = session.Table(users).Where("group_id=?", req.GroupId).Find(&users)
+	err = session.Table(users).Where("id in (select user_id from fafacms_user_group where group_id=?)", req.GroupId).Find(&users)
 	if err != nil {
 		flog.Log.Errorf("ListUser err:%s", err.Error())
 		resp.Error = Error(DBError, err.Error())
@@ -810,11 +834,11 @@ func ListGroupUser(c *gin.Context) {
 
 type AssignGroupRequest struct {
 	GroupId      int   `json:"group_id"`
-	GroupRelease int   `json:"group_release"`
+	GroupRelease int   `json:"group_release"` // 1表示移出组，组为0时移出全部组
 	Users        []int `json:"users"`
 }
 
-// 为用户分配组，每个用户只能有一个组，权限相对弱一点
+// 为用户分配组，一个用户可以在多个组，权限取所有组的并集，拒绝优先
 func AssignGroupToUser(c *gin.Context) {
 	resp := new(Resp)
 	req := new(AssignGroupRequest)
@@ -835,14 +859,12 @@ func AssignGroupToUser(c *gin.Context) {
 
 	// 为用户移除组
 	if req.GroupRelease == 1 {
-		u := new(model.User)
-		num, err := config.FafaRdb.Client.Cols("group_id").In("id", req.Users).Update(u)
+		err := model.RemoveUserGroup(req.Users, req.GroupId)
 		if err != nil {
 			flog.Log.Errorf("AssignGroupToUser err:%s", err.Error())
 			resp.Error = Error(DBError, err.Error())
 			return
 		}
-		resp.Data = num
 	} else {
 		if req.GroupId == 0 {
 			flog.Log.Errorf("AssignGroupToUser err:%s", "group id empty")
@@ -865,15 +887,25 @@ func AssignGroupToUser(c *gin.Context) {
 			return
 		}
 
-		u := new(model.User)
-		u.GroupId = req.GroupId
-		num, err := config.FafaRdb.Client.Cols("group_id").In("id", req.Users).Update(u)
+		num, err := config.FafaRdb.Client.In("id", req.Users).Count(new(model.User))
+		if err != nil {
+			flog.Log.Errorf("AssignGroupToUser err:%s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		if int(num) != len(req.Users) {
+			flog.Log.Errorf("AssignGroupToUser err:%s", "user not found")
+			resp.Error = Error(UserNotFound, "")
+			return
+		}
+
+		err = model.AddUserGroup(req.Users, req.GroupId)
 		if err != nil {
 			flog.Log.Errorf("AssignGroupToUser err:%s", err.Error())
 			resp.Error = Error(DBError, err.Error())
 			return
 		}
-		resp.Data = num
 	}
 
 	resp.Flag = true
@@ -910,7 +942,16 @@ func UpdateUserAdmin(c *gin.Context) {
 	u := new(model.User)
 	u.NickName = req.NickName
 	u.Id = req.Id
-	u.Password = req.Password
+
+	// 密码为空表示不修改
+	if req.Password != "" {
+		u.Password, err = util.HashPassword(req.Password)
+		if err != nil {
+			flog.Log.Errorf("UpdateUserAdmin err:%s", err.Error())
+			resp.Error = Error(PasswordHashError, err.Error())
+			return
+		}
+	}
 
 	// 可以将用户拉入黑名单或者激活
 	u.Status = req.Status
@@ -921,6 +962,15 @@ func UpdateUserAdmin(c *gin.Context) {
 		return
 	}
 
+	// 改了密码或者拉入黑名单，所有设备都要重新登录
+	if req.Password != "" || req.Status == 2 {
+		err = RevokeUserLogin(u.Id, nil)
+		if err != nil {
+			flog.Log.Errorf("UpdateUserAdmin err:%s", err.Error())
+		}
+	}
+
+	u.Password = ""
 	resp.Data = u
 	resp.Flag = true
 }
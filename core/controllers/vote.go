@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/model"
+)
+
+// 获取可以投票的对象所属的用户
+func getVoteObjectUser(objectType int, objectId int, password string) (int, *ErrorResp) {
+	if objectType == model.VoteObjectContent {
+		content, errResp := getPublicContent(objectId, password)
+		if errResp != nil {
+			return 0, errResp
+		}
+		return content.UserId, nil
+	}
+
+	// 评论必须是正常的，且评论的内容也要公开
+	comment := new(model.Comment)
+	comment.Id = objectId
+	exist, err := comment.Get()
+	if err != nil {
+		return 0, Error(DBError, err.Error())
+	}
+
+	if !exist || comment.Status != 1 {
+		return 0, Error(CommentNotFound, "")
+	}
+
+	_, errResp := getPublicContent(comment.ObjectId, password)
+	if errResp != nil {
+		return 0, errResp
+	}
+
+	return comment.UserId, nil
+}
+
+// 为内容或评论点赞/反对
+type CreateVoteRequest struct {
+	ObjectType int    `json:"object_type" validate:"oneof=0 1"` // 0内容，1评论
+	ObjectId   int    `json:"object_id" validate:"required"`
+	Types      int    `json:"types" validate:"oneof=0 1"` // 0点赞，1反对
+	Password   string `json:"password"`                   // 内容有密码时需要
+}
+
+func CreateVote(c *gin.Context) {
+	resp := new(Resp)
+	req := new(CreateVoteRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("CreateVote err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("CreateVote err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	objectUserId, errResp := getVoteObjectUser(req.ObjectType, req.ObjectId, req.Password)
+	if errResp != nil {
+		flog.Log.Errorf("CreateVote err: %s", errResp.Error())
+		resp.Error = errResp
+		return
+	}
+
+	vote := new(model.Vote)
+	vote.UserId = uu.Id
+	vote.ObjectType = req.ObjectType
+	vote.ObjectId = req.ObjectId
+	exist, err := vote.Get()
+	if err != nil {
+		flog.Log.Errorf("CreateVote err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// 投过了，要先取消才能重新投
+	if exist {
+		flog.Log.Errorf("CreateVote err: %s", "vote repeat")
+		resp.Error = Error(VoteRepeat, "")
+		return
+	}
+
+	vote.ObjectUserId = objectUserId
+	vote.Types = req.Types
+	err = vote.InsertOne()
+	if err != nil {
+		flog.Log.Errorf("CreateVote err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Data = vote
+	resp.Flag = true
+}
+
+// 取消点赞/反对
+type DeleteVoteRequest struct {
+	ObjectType int `json:"object_type" validate:"oneof=0 1"`
+	ObjectId   int `json:"object_id" validate:"required"`
+}
+
+func DeleteVote(c *gin.Context) {
+	resp := new(Resp)
+	req := new(DeleteVoteRequest)
+	defer func() {
+		JSONL(c, 200, req, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("DeleteVote err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	uu, err := GetUserSession(c)
+	if err != nil {
+		flog.Log.Errorf("DeleteVote err: %s", err.Error())
+		resp.Error = Error(GetUserSessionError, err.Error())
+		return
+	}
+
+	vote := new(model.Vote)
+	vote.UserId = uu.Id
+	vote.ObjectType = req.ObjectType
+	vote.ObjectId = req.ObjectId
+	exist, err := vote.Get()
+	if err != nil {
+		flog.Log.Errorf("DeleteVote err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	if !exist {
+		flog.Log.Errorf("DeleteVote err: %s", "vote not found")
+		resp.Error = Error(VoteNotFound, "")
+		return
+	}
+
+	err = vote.Delete()
+	if err != nil {
+		flog.Log.Errorf("DeleteVote err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	resp.Flag = true
+}
+
+// 前端获取投票情况
+type VotesRequest struct {
+	ObjectType int    `json:"object_type" validate:"oneof=0 1"`
+	ObjectIds  []int  `json:"object_ids" validate:"required,lt=101,dive,required"`
+	Password   string `json:"password"` // 内容有密码时需要，密码不对的内容和其评论不返回
+}
+
+type VoteX struct {
+	ObjectId int   `json:"object_id"`
+	Good     int64 `json:"good"`
+	Bad      int64 `json:"bad"`
+	IsVote   bool  `json:"is_vote"`         // 当前登录用户是否投过票
+	Types    int   `json:"types,omitempty"` // 当前登录用户投的票，0点赞，1反对
+}
+
+type VotesResponse struct {
+	Votes []VoteX `json:"votes"`
+}
+
+// 获取内容或评论的投票数，以及当前登录用户是否投过票
+func Votes(c *gin.Context) {
+	resp := new(Resp)
+
+	respResult := new(VotesResponse)
+	req := new(VotesRequest)
+	defer func() {
+		JSON(c, 200, resp)
+	}()
+
+	if errResp := ParseJSON(c, req); errResp != nil {
+		resp.Error = errResp
+		return
+	}
+
+	var validate = validator.New()
+	err := validate.Struct(req)
+	if err != nil {
+		flog.Log.Errorf("Votes err: %s", err.Error())
+		resp.Error = Error(ParasError, err.Error())
+		return
+	}
+
+	back := make([]VoteX, 0, len(req.ObjectIds))
+	if req.ObjectType == model.VoteObjectContent {
+		cs := make([]model.Content, 0)
+		err = config.FafaRdb.Client.Cols("id", "good", "bad").In("id", req.ObjectIds).And("status=?", 0).And("version>?", 0).
+			And("(password=? or password=?)", "", req.Password).Find(&cs)
+		for _, v := range cs {
+			back = append(back, VoteX{ObjectId: v.Id, Good: v.Good, Bad: v.Bad})
+		}
+	} else {
+		cs := make([]model.Comment, 0)
+		err = config.FafaRdb.Client.Cols("id", "good", "bad").In("id", req.ObjectIds).And("status=?", 1).
+			And("object_id in (select id from fafacms_content where status=0 and version>0 and (password='' or password=?))", req.Password).Find(&cs)
+		for _, v := range cs {
+			back = append(back, VoteX{ObjectId: v.Id, Good: v.Good, Bad: v.Bad})
+		}
+	}
+
+	if err != nil {
+		flog.Log.Errorf("Votes err: %s", err.Error())
+		resp.Error = Error(DBError, err.Error())
+		return
+	}
+
+	// 登录了才需要看自己有没有投过
+	uu, _ := GetUserSession(c)
+	if uu != nil && len(back) > 0 {
+		vs := make([]model.Vote, 0)
+		err = config.FafaRdb.Client.Where("user_id=?", uu.Id).And("object_type=?", req.ObjectType).In("object_id", req.ObjectIds).Find(&vs)
+		if err != nil {
+			flog.Log.Errorf("Votes err: %s", err.Error())
+			resp.Error = Error(DBError, err.Error())
+			return
+		}
+
+		for _, v := range vs {
+			for k := range back {
+				if back[k].ObjectId == v.ObjectId {
+					back[k].IsVote = true
+					back[k].Types = v.Types
+				}
+			}
+		}
+	}
+
+	respResult.Votes = back
+	resp.Data = respResult
+	resp.Flag = true
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 个人访问令牌，给脚本和客户端用 Authorization: Bearer 访问 /v1 接口
+// 库中只保存令牌的哈希，明文只在创建时返回一次
+type AccessToken struct {
+	Id          int    `json:"id" xorm:"bigint pk autoincr"`
+	UserId      int    `json:"user_id" xorm:"bigint index"`
+	Name        string `json:"name" xorm:"varchar(100)"`
+	Prefix      string `json:"prefix" xorm:"varchar(20)"` // 令牌的前几位，方便用户辨认
+	TokenHash   string `json:"-" xorm:"varchar(100) notnull unique"`
+	Scopes      string `json:"-" xorm:"TEXT"` // 可访问的资源id，逗号隔开，为空表示不限
+	CreateTime  int64  `json:"create_time"`
+	LastUseTime int64  `json:"last_use_time"`
+	ExpireTime  int64  `json:"expire_time"` // 为0表示不过期
+}
+
+var AccessTokenSortName = []string{"=id", "-create_time", "-last_use_time"}
+
+func (t *AccessToken) InsertOne() error {
+	if t.UserId == 0 || t.TokenHash == "" {
+		return errors.New("where is empty")
+	}
+
+	t.CreateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.InsertOne(t)
+	return err
+}
+
+// 根据哈希获取，过期的不要
+func (t *AccessToken) GetByHash() (bool, error) {
+	if t.TokenHash == "" {
+		return false, errors.New("where is empty")
+	}
+
+	ok, err := config.FafaRdb.Client.Where("token_hash=?", t.TokenHash).Get(t)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if t.ExpireTime != 0 && t.ExpireTime <= time.Now().Unix() {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (t *AccessToken) UpdateLastUseTime() error {
+	if t.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	t.LastUseTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", t.Id).Cols("last_use_time").Update(t)
+	return err
+}
+
+func (t *AccessToken) ScopeIds() []int {
+	ids := make([]int, 0)
+	for _, v := range strings.Split(t.Scopes, ",") {
+		id, err := strconv.Atoi(v)
+		if err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (t *AccessToken) SetScopeIds(ids []int) {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, strconv.Itoa(id))
+	}
+	t.Scopes = strings.Join(s, ",")
+}
+
+// 令牌是否可以访问某资源，没有设置范围的都可以
+func (t *AccessToken) InScope(resourceId int) bool {
+	if t.Scopes == "" {
+		return true
+	}
+
+	for _, id := range t.ScopeIds() {
+		if id == resourceId {
+			return true
+		}
+	}
+	return false
+}
+
+// 删除用户的令牌，ids为空表示全部
+func DeleteAccessTokens(userId int, ids []int) (int64, error) {
+	if userId == 0 {
+		return 0, errors.New("where is empty")
+	}
+
+	s := config.FafaRdb.Client.Where("user_id=?", userId)
+	if len(ids) > 0 {
+		s.In("id", ids)
+	}
+	return s.Delete(new(AccessToken))
+}
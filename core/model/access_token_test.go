@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestAccessToken_InScope(t *testing.T) {
+	token := new(AccessToken)
+	if !token.InScope(1) {
+		t.Fatalf("no scope should allow all")
+	}
+
+	token.SetScopeIds([]int{3, 5})
+	if token.Scopes != "3,5" {
+		t.Fatalf("scopes wrong: %s", token.Scopes)
+	}
+
+	if !token.InScope(3) || !token.InScope(5) || token.InScope(1) {
+		t.Fatalf("in scope wrong")
+	}
+
+	token.Scopes = "3,,x,7"
+	if ids := token.ScopeIds(); len(ids) != 2 || ids[1] != 7 {
+		t.Fatalf("scope ids wrong: %v", ids)
+	}
+}
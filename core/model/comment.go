@@ -1,20 +1,116 @@
 package model
 
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
 // 灌水表
 type Comment struct {
 	Id                int    `json:"id" xorm:"bigint pk autoincr"`
-	UserId            int    `json:"user_id" xorm:"bigint index"`                                                   // 评论者的用户ID
-	ObjectId          int    `json:"object_id" xorm:"bigint index"`                                                 // 评论对应的内容ID
-	ObjectUserId      int    `json:"object_user_id" xorm:"bigint index"`                                            // 评论对应的内容所属用户ID
-	CommentId         int    `json:"comment_id,omitempty"`                                                          //  对某评论的评论，某评论的ID
-	CommentUserId     int    `json:"comment_user_id,omitempty"`                                                     //  对某评论的评论，某评论所属的用户ID
-	Status            int    `json:"status" xorm:"not null comment('1 normal, 0 hide，2 deleted') TINYINT(1) index"` // 逻辑删除为2
+	UserId            int    `json:"user_id" xorm:"bigint index"`                                                             // 评论者的用户ID
+	ObjectId          int    `json:"object_id" xorm:"bigint index"`                                                           // 评论对应的内容ID
+	ObjectUserId      int    `json:"object_user_id" xorm:"bigint index"`                                                      // 评论对应的内容所属用户ID
+	CommentId         int    `json:"comment_id,omitempty" xorm:"bigint index"`                                                //  对某评论的评论，某评论的ID
+	CommentUserId     int    `json:"comment_user_id,omitempty"`                                                               //  对某评论的评论，某评论所属的用户ID
+	RootCommentId     int    `json:"root_comment_id,omitempty" xorm:"bigint index"`                                           //  堆楼，楼层最顶层评论的ID，顶层评论为0
+	Status            int    `json:"status" xorm:"not null comment('1 normal, 0 hide，2 deleted, 3 reject') TINYINT(1) index"` // 逻辑删除为2，0表示等待审核
 	Describe          string `json:"describe" xorm:"TEXT"`
 	CreateTime        int64  `json:"create_time"`
 	UpdateTime        int64  `json:"update_time,omitempty"`
 	SuggestUpdateTime int64  `json:"suggest_update_time,omitempty"` // 建议协程更新时间
+	ReviewUserId      int    `json:"review_user_id,omitempty"`      // 审核者的用户ID
+	ReviewTime        int64  `json:"review_time,omitempty"`         // 审核时间
+	Good              int64  `json:"good"`                          // 点赞数
+	Bad               int64  `json:"bad"`                           // 反对数
 	Aa                string `json:"aa,omitempty"`
 	Ab                string `json:"ab,omitempty"`
 	Ac                string `json:"ac,omitempty"`
 	Ad                string `json:"ad,omitempty"`
 }
+
+var CommentSortName = []string{"=id", "+create_time", "-update_time", "=user_id", "=object_id", "=status", "=good", "=bad"}
+
+// 评论插入
+func (c *Comment) InsertOne() error {
+	c.CreateTime = time.Now().Unix()
+	_, err := config.FafaRdb.InsertOne(c)
+	return err
+}
+
+// 获取评论，需要评论ID
+func (c *Comment) Get() (bool, error) {
+	if c.Id == 0 {
+		return false, errors.New("where is empty")
+	}
+	return config.FafaRdb.Client.Get(c)
+}
+
+// 更新评论内容
+func (c *Comment) UpdateDescribe() error {
+	if c.Id == 0 || c.UserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	c.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", c.Id).And("user_id=?", c.UserId).Cols("describe", "status", "update_time").Update(c)
+	return err
+}
+
+// 审核评论，只能审核自己内容下等待审核的评论，1通过，3拒绝
+func (c *Comment) Review(ids []int) (int64, error) {
+	if c.ObjectUserId == 0 || len(ids) == 0 {
+		return 0, errors.New("where is empty")
+	}
+
+	c.ReviewUserId = c.ObjectUserId
+	c.ReviewTime = time.Now().Unix()
+	c.UpdateTime = c.ReviewTime
+	return config.FafaRdb.Client.In("id", ids).And("object_user_id=?", c.ObjectUserId).And("status=?", 0).Cols("status", "review_user_id", "review_time", "update_time").Update(c)
+}
+
+// 级联逻辑删除，评论下的所有回复都会被删除
+func (c *Comment) Delete() error {
+	if c.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	deleted := new(Comment)
+	deleted.Status = 2
+	deleted.UpdateTime = time.Now().Unix()
+
+	// 一层层往下找回复，回复的回复也要删掉
+	ids := []int{c.Id}
+	for len(ids) > 0 {
+		_, err := session.In("id", ids).Cols("status", "update_time").Update(deleted)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+
+		children := make([]Comment, 0)
+		err = session.Cols("id").In("comment_id", ids).And("status!=?", 2).Find(&children)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+
+		ids = make([]int, 0, len(children))
+		for _, v := range children {
+			ids = append(ids, v.Id)
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
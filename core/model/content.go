@@ -8,31 +8,37 @@ import (
 
 // 内容表
 type Content struct {
-	Id           int    `json:"id" xorm:"bigint pk autoincr"`
-	Seo          string `json:"seo" xorm:"index"`
-	Title        string `json:"title" xorm:"varchar(200) notnull"`
-	PreTitle     string `json:"pre_title" xorm:"varchar(200) notnull"`
-	UserId       int    `json:"user_id" xorm:"bigint index"` // 内容所属用户
-	UserName     string `json:"user_name" xorm:"index"`
-	NodeId       int    `json:"node_id" xorm:"bigint index"`                                                          // 节点ID
-	NodeSeo      string `json:"node_seo" xorm:"index"`                                                                // 节点ID SEO
-	Status       int    `json:"status" xorm:"not null comment('0 normal, 1 hide，2 ban, 3 rubbish') TINYINT(1) index"` // 0-1-2-3为正常
-	Top          int    `json:"top" xorm:"not null comment('0 normal, 1 top') TINYINT(1) index"`                      // 置顶
-	Describe     string `json:"describe" xorm:"TEXT"`
-	PreDescribe  string `json:"pre_describe" xorm:"TEXT"`                                                           // 预览内容，临时保存，当修改后调用发布接口，会刷新到Describe，每次这个字段刷新都会记录进历史表
-	PreFlush     int    `json:"pre_flush" xorm:"not null comment('1 flush') TINYINT(1)"`                            // 是否预览内容已经被刷新
-	CloseComment int    `json:"close_comment" xorm:"not null comment('0 close, 1 open, 2 direct open') TINYINT(1)"` // 关闭评论开关，默认关闭
-	Version      int    `json:"version"`                                                                            // 0表示什么都没发布  发布了多少次版本
-	CreateTime   int64  `json:"create_time"`
-	UpdateTime   int64  `json:"update_time,omitempty"`
-	PublishTime  int64  `json:"publish_time,omitempty"`
-	ImagePath    string `json:"image_path" xorm:"varchar(700)"`
-	Views        int    `json:"views"` // 被点击多少次，弱化
-	Password     string `json:"password,omitempty"`
-	SortNum      int64  `json:"sort_num"`
+	Id           int      `json:"id" xorm:"bigint pk autoincr"`
+	Seo          string   `json:"seo" xorm:"index"`
+	Title        string   `json:"title" xorm:"varchar(200) notnull"`
+	PreTitle     string   `json:"pre_title" xorm:"varchar(200) notnull"`
+	UserId       int      `json:"user_id" xorm:"bigint index"` // 内容所属用户
+	UserName     string   `json:"user_name" xorm:"index"`
+	NodeId       int      `json:"node_id" xorm:"bigint index"`                                                          // 节点ID
+	NodeSeo      string   `json:"node_seo" xorm:"index"`                                                                // 节点ID SEO
+	Status       int      `json:"status" xorm:"not null comment('0 normal, 1 hide，2 ban, 3 rubbish') TINYINT(1) index"` // 0-1-2-3为正常
+	Top          int      `json:"top" xorm:"not null comment('0 normal, 1 top') TINYINT(1) index"`                      // 置顶
+	Describe     string   `json:"describe" xorm:"TEXT"`
+	PreDescribe  string   `json:"pre_describe" xorm:"TEXT"`                                                           // 预览内容，临时保存，当修改后调用发布接口，会刷新到Describe，每次这个字段刷新都会记录进历史表
+	PreFlush     int      `json:"pre_flush" xorm:"not null comment('1 flush') TINYINT(1)"`                            // 是否预览内容已经被刷新
+	CloseComment int      `json:"close_comment" xorm:"not null comment('0 close, 1 open, 2 direct open') TINYINT(1)"` // 关闭评论开关，默认关闭
+	Version      int      `json:"version"`                                                                            // 0表示什么都没发布  发布了多少次版本
+	CreateTime   int64    `json:"create_time"`
+	UpdateTime   int64    `json:"update_time,omitempty"`
+	PublishTime  int64    `json:"publish_time,omitempty"`
+	ImagePath    string   `json:"image_path" xorm:"varchar(700)"`
+	Views        int      `json:"views"` // 被点击多少次，弱化
+	Password     string   `json:"password,omitempty"`
+	SortNum      int64    `json:"sort_num"`
+	Good         int64    `json:"good"`                    // 点赞数
+	Bad          int64    `json:"bad"`                     // 反对数
+	Tags         []string `json:"tags,omitempty" xorm:"-"` // 标签，不存库，标签在关联表
 }
 
-var ContentSortName = []string{"=id", "-user_id", "-top", `-sort_num`, "-create_time", "-update_time", "-views", "=version", "+status", "=seo"}
+var ContentSortName = []string{"=id", "-user_id", "-top", `-sort_num`, "-create_time", "-update_time", "-views", "=version", "+status", "=seo", "=good", "=bad"}
+
+// 关注的人的动态，不分作者按时间倒序，同一秒的按id
+var FeedSortName = []string{"-create_time", "-id", "=update_time", "=views", "=good"}
 
 // 内容历史表
 type ContentHistory struct {
@@ -80,7 +86,11 @@ func (c *Content) CheckSeoValid() (bool, error) {
 // 硬核插入
 func (c *Content) Insert() (int64, error) {
 	c.CreateTime = time.Now().Unix()
-	return config.FafaRdb.InsertOne(c)
+	n, err := config.FafaRdb.InsertOne(c)
+	if err == nil {
+		AddFileRef(FileRefContent, c.Id, c.ImagePath, c.Describe, c.PreDescribe)
+	}
+	return n, err
 }
 
 // 一般的获取，放松，需要内容ID
@@ -139,9 +149,12 @@ func (c *Content) UpdateDescribeAndHistory() error {
 	err = session.Commit()
 	if err != nil {
 		session.Rollback()
+		return err
 	}
 
-	return err
+	// 发布和恢复用的都是已经有的内容，只有这里会引用新的文件
+	AddFileRef(FileRefContent, c.Id, c.PreDescribe)
+	return nil
 }
 
 // 更新SEO，不需要更新时间，在内容变化才需要
@@ -157,7 +170,11 @@ func (c *Content) UpdateImage() (int64, error) {
 	if c.UserId == 0 || c.Id == 0 {
 		return 0, errors.New("where is empty")
 	}
-	return config.FafaRdb.Client.Cols("image_path").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	n, err := config.FafaRdb.Client.Cols("image_path").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	if err == nil && n > 0 {
+		AddFileRef(FileRefContent, c.Id, c.ImagePath)
+	}
+	return n, err
 }
 
 // 更新状态
@@ -165,7 +182,11 @@ func (c *Content) UpdateStatus() (int64, error) {
 	if c.UserId == 0 || c.Id == 0 {
 		return 0, errors.New("where is empty")
 	}
-	return config.FafaRdb.Client.Cols("status").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	num, err := config.FafaRdb.Client.Cols("status").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	if err == nil {
+		SyncContentSearch(c.Id)
+	}
+	return num, err
 }
 
 // 更新Top
@@ -181,7 +202,11 @@ func (c *Content) UpdatePassword() (int64, error) {
 	if c.UserId == 0 || c.Id == 0 {
 		return 0, errors.New("where is empty")
 	}
-	return config.FafaRdb.Client.Cols("password").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	num, err := config.FafaRdb.Client.Cols("password").Where("id=?", c.Id).And("user_id=?", c.UserId).Update(c)
+	if err == nil {
+		SyncContentSearch(c.Id)
+	}
+	return num, err
 }
 
 // 更新内容的节点
@@ -227,6 +252,7 @@ func (n *Content) UpdateNode(beforeNodeId int) error {
 		return err
 	}
 
+	SyncContentSearch(n.Id)
 	return nil
 }
 
@@ -280,6 +306,8 @@ func (c *Content) PublishDescribe() error {
 		session.Rollback()
 		return err
 	}
+
+	SyncContentSearch(c.Id)
 	return nil
 }
 
@@ -353,10 +381,17 @@ func (c *Content) Delete() error {
 		return err
 	}
 
+	if _, err := session.Where("content_id=?", c.Id).And("user_id=?", c.UserId).Delete(new(ContentTag)); err != nil {
+		session.Rollback()
+		return err
+	}
+
 	if err := session.Commit(); err != nil {
 		return err
 	}
 
+	ContentSearch.Remove(c.Id)
+	RemoveFileRef(FileRefContent, c.Id)
 	return nil
 }
 
@@ -1,9 +1,11 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/hunterhug/fafacms/core/config"
 	"github.com/hunterhug/fafacms/core/util"
+	"strings"
 	"time"
 )
 
@@ -22,13 +24,78 @@ type File struct {
 	CreateTime     int64  `json:"create_time"`
 	UpdateTime     int64  `json:"update_time,omitempty"`
 	Status         int    `json:"status" xorm:"not null comment('0 normal，1 hide but can use') TINYINT(1)"` // 逻辑隐藏为1，HashCode仍有效
-	StoreType      int    `json:"store_type" xorm:"not null comment('0 local，1 oss') TINYINT(1)"`
+	StoreType      int    `json:"store_type" xorm:"not null comment('0 local，1 oss，2 s3') TINYINT(1)"`      // 存储后端的编号
+	StoreKey       string `json:"store_key" xorm:"varchar(700)"`                                            // 在存储后端中的key，旧数据为空
+	Thumbs         string `json:"-" xorm:"TEXT"`                                                            // 缩略图的名字到key，json格式，旧数据为空
 	IsPicture      int    `json:"is_picture"`
 	Size           int64  `json:"size"`
 }
 
 var FileSortName = []string{"=id", "-create_time", "-update_time", "=user_id", "=type", "=tag", "=store_type", "=status", "=size"}
 
+// 文件在存储后端中的key，旧数据没有保存，从地址推出来
+func (f *File) Key() string {
+	if f.StoreKey != "" {
+		return f.StoreKey
+	}
+
+	// 旧的OSS文件直接用地址作为对象名
+	if f.StoreType != 0 {
+		return f.Url
+	}
+	return strings.TrimPrefix(f.Url, "/")
+}
+
+// 图片缩略图的key，放在 storage_x 下
+func (f *File) ScaleKey() string {
+	key := f.Key()
+	if i := strings.Index(key, "storage/"); i >= 0 {
+		return "storage_x/" + key[i+len("storage/"):]
+	}
+	return key
+}
+
+// 缩略图的key，x 就是以前的 ScaleKey，其他的在文件名后面加上 _名字，ext 为空时后缀和原图一样
+func (f *File) ThumbKey(name string, ext string) string {
+	key := f.ScaleKey()
+	base, suffix := key, ""
+	if dot := strings.LastIndex(key, "."); dot > strings.LastIndex(key, "/") {
+		base, suffix = key[:dot], key[dot+1:]
+	}
+
+	if name != "x" {
+		base = base + "_" + name
+	}
+
+	if ext == "" {
+		ext = suffix
+	}
+
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// 所有缩略图的key，旧的图片只有 x
+func (f *File) ThumbKeys() map[string]string {
+	keys := make(map[string]string)
+	if f.Thumbs != "" {
+		json.Unmarshal([]byte(f.Thumbs), &keys)
+		return keys
+	}
+
+	if f.IsPicture == 1 {
+		keys["x"] = f.ScaleKey()
+	}
+	return keys
+}
+
+func (f *File) SetThumbKeys(keys map[string]string) {
+	raw, _ := json.Marshal(keys)
+	f.Thumbs = string(raw)
+}
+
 // 判断文件是否存在，被隐藏的文件也可以找到
 // 必须是图片，毕竟我们的系统目前只会上传图片
 func (f *File) Exist() (bool, error) {
@@ -142,3 +209,33 @@ func (f *File) UpdateStatus() (bool, error) {
 
 	return true, nil
 }
+
+// 真正删除没有被引用的文件记录，存储里的文件由调用者删，返回是否删了
+// 垃圾回收时只删仍然隐藏的，防止刚好被恢复
+func (f *File) Delete(hidden bool) (bool, error) {
+	if f.Id == 0 {
+		return false, errors.New("where is empty")
+	}
+
+	s := config.FafaRdb.Client.NewSession()
+	defer s.Close()
+
+	s.Where("id=?", f.Id)
+
+	if f.UserId != 0 {
+		s.And("user_id=?", f.UserId)
+	}
+
+	if hidden {
+		s.And("status=?", 1)
+	}
+
+	s.And("not exists (select 1 from fafacms_file_ref r where r.file_id=fafacms_file.id)")
+
+	n, err := s.Delete(new(File))
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
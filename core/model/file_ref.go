@@ -0,0 +1,360 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	FileRefUser    = "user"    // 用户头像
+	FileRefGroup   = "group"   // 组的图片
+	FileRefNode    = "node"    // 节点背景图
+	FileRefContent = "content" // 文章背景图和正文，包括历史版本
+)
+
+// 文件被谁引用了，被引用的文件不能删除，垃圾回收也会跳过
+// 文章的引用只增不减，历史版本可能还在用，文章删除后才释放
+type FileRef struct {
+	Id         int    `json:"id" xorm:"bigint pk autoincr"`
+	FileId     int    `json:"file_id" xorm:"bigint notnull unique(ref)"`
+	RefType    string `json:"ref_type" xorm:"varchar(20) notnull unique(ref) index(obj)"`
+	RefId      int    `json:"ref_id" xorm:"bigint notnull unique(ref) index(obj)"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// 文件地址中的 用户名_哈希，缩略图和各种存储后端的地址都有这一段
+var fileHashRegexp = regexp.MustCompile(`storage(?:_x)?/[^/\s"'<>()\[\]]+/[^/\s"'<>()\[\]]+/([^/\s"'<>()\[\]]+_[0-9a-f]{64})`)
+
+// 从地址或者正文中找出引用的文件的 HashCode
+// S3 的地址和粘贴进正文的地址可能是转义过的，如中文用户名，要先还原
+func FileHashCodes(texts ...string) []string {
+	seen := make(map[string]bool)
+	codes := make([]string, 0)
+	for _, text := range texts {
+		for _, m := range fileHashRegexp.FindAllStringSubmatch(text, -1) {
+			code, err := url.PathUnescape(m[1])
+			if err != nil {
+				code = m[1]
+			}
+
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+// 根据 HashCode 找到文件id，分批查
+func fileIdsByHashCode(codes []string) (map[int]bool, error) {
+	ids := make(map[int]bool)
+	for start := 0; start < len(codes); start += 500 {
+		end := start + 500
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		fs := make([]File, 0)
+		err := config.FafaRdb.Client.Cols("id").In("hash_code", codes[start:end]).Find(&fs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fs {
+			ids[f.Id] = true
+		}
+	}
+	return ids, nil
+}
+
+func fileRefIds(refType string, refId int) (map[int]bool, error) {
+	refs := make([]FileRef, 0)
+	err := config.FafaRdb.Client.Where("ref_type=?", refType).And("ref_id=?", refId).Find(&refs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int]bool, len(refs))
+	for _, r := range refs {
+		ids[r.FileId] = true
+	}
+	return ids, nil
+}
+
+func updateFileRef(refType string, refId int, replace bool, texts []string) error {
+	if refType == "" || refId == 0 {
+		return errors.New("where is empty")
+	}
+
+	want, err := fileIdsByHashCode(FileHashCodes(texts...))
+	if err != nil {
+		return err
+	}
+
+	have, err := fileRefIds(refType, refId)
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		drop := make([]int, 0)
+		for id := range have {
+			if !want[id] {
+				drop = append(drop, id)
+			}
+		}
+
+		if len(drop) > 0 {
+			_, err = config.FafaRdb.Client.Where("ref_type=?", refType).And("ref_id=?", refId).In("file_id", drop).Delete(new(FileRef))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	add := make([]FileRef, 0)
+	for id := range want {
+		if !have[id] {
+			add = append(add, FileRef{FileId: id, RefType: refType, RefId: refId, CreateTime: now})
+		}
+	}
+
+	if len(add) > 0 {
+		_, err = config.FafaRdb.Client.Insert(add)
+	}
+	return err
+}
+
+// 引用改成这些内容中的文件，如头像和背景图修改时
+func SetFileRef(refType string, refId int, texts ...string) {
+	err := updateFileRef(refType, refId, true, texts)
+	if err != nil {
+		flog.Log.Errorf("SetFileRef err: %s", err.Error())
+	}
+}
+
+// 加上这些内容中的文件，原来的引用保留
+func AddFileRef(refType string, refId int, texts ...string) {
+	err := updateFileRef(refType, refId, false, texts)
+	if err != nil {
+		flog.Log.Errorf("AddFileRef err: %s", err.Error())
+	}
+}
+
+// 引用者被删除了
+func RemoveFileRef(refType string, refId int) {
+	_, err := config.FafaRdb.Client.Where("ref_type=?", refType).And("ref_id=?", refId).Delete(new(FileRef))
+	if err != nil {
+		flog.Log.Errorf("RemoveFileRef err: %s", err.Error())
+	}
+}
+
+// 文件被哪些地方引用
+func ListFileRef(fileId int) ([]FileRef, error) {
+	if fileId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	refs := make([]FileRef, 0)
+	err := config.FafaRdb.Client.Where("file_id=?", fileId).Asc("id").Find(&refs)
+	return refs, err
+}
+
+type fileRefKey struct {
+	RefType string
+	RefId   int
+}
+
+// 扫描所有引用文件的地方，和引用表对比，补上缺的，删掉多的，返回引用数
+// 启动时和每次垃圾回收前都会执行，即使某处修改时漏了记录也不会误删
+// 不清空重建，扫描开始后新加的引用不在扫描结果中，也要保留
+func RebuildFileRef() (int, error) {
+	scanTime := time.Now().Unix()
+	codes := make(map[fileRefKey][]string)
+	collect := func(refType string, refId int, texts ...string) {
+		k := fileRefKey{RefType: refType, RefId: refId}
+		codes[k] = append(codes[k], FileHashCodes(texts...)...)
+	}
+
+	us := make([]User, 0)
+	err := config.FafaRdb.Client.Cols("id", "head_photo").Where("head_photo!=?", "").Find(&us)
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range us {
+		collect(FileRefUser, u.Id, u.HeadPhoto)
+	}
+
+	gs := make([]Group, 0)
+	err = config.FafaRdb.Client.Cols("id", "image_path").Where("image_path!=?", "").Find(&gs)
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range gs {
+		collect(FileRefGroup, g.Id, g.ImagePath)
+	}
+
+	ns := make([]ContentNode, 0)
+	err = config.FafaRdb.Client.Cols("id", "image_path").Where("image_path!=?", "").Find(&ns)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range ns {
+		collect(FileRefNode, n.Id, n.ImagePath)
+	}
+
+	// 正文可能很多，分批读
+	lastId := 0
+	for {
+		cs := make([]Content, 0)
+		err = config.FafaRdb.Client.Cols("id", "image_path", "describe", "pre_describe").Where("id>?", lastId).Asc("id").Limit(searchBatchNum).Find(&cs)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, c := range cs {
+			collect(FileRefContent, c.Id, c.ImagePath, c.Describe, c.PreDescribe)
+		}
+
+		if len(cs) < searchBatchNum {
+			break
+		}
+		lastId = cs[len(cs)-1].Id
+	}
+
+	lastId = 0
+	for {
+		hs := make([]ContentHistory, 0)
+		err = config.FafaRdb.Client.Cols("id", "content_id", "describe").Where("id>?", lastId).Asc("id").Limit(searchBatchNum).Find(&hs)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, h := range hs {
+			collect(FileRefContent, h.ContentId, h.Describe)
+		}
+
+		if len(hs) < searchBatchNum {
+			break
+		}
+		lastId = hs[len(hs)-1].Id
+	}
+
+	all := make([]string, 0)
+	for _, v := range codes {
+		all = append(all, v...)
+	}
+
+	fileIds := make(map[string]int)
+	for start := 0; start < len(all); start += 500 {
+		end := start + 500
+		if end > len(all) {
+			end = len(all)
+		}
+
+		fs := make([]File, 0)
+		err = config.FafaRdb.Client.Cols("id", "hash_code").In("hash_code", all[start:end]).Find(&fs)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, f := range fs {
+			fileIds[f.HashCode] = f.Id
+		}
+	}
+
+	want := make(map[FileRef]bool)
+	for k, v := range codes {
+		for _, code := range v {
+			if id, ok := fileIds[code]; ok {
+				want[FileRef{FileId: id, RefType: k.RefType, RefId: k.RefId}] = true
+			}
+		}
+	}
+
+	have := make(map[FileRef]bool)
+	drop := make([]int, 0)
+	lastId = 0
+	for {
+		rs := make([]FileRef, 0)
+		err = config.FafaRdb.Client.Where("id>?", lastId).Asc("id").Limit(searchBatchNum).Find(&rs)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, r := range rs {
+			k := FileRef{FileId: r.FileId, RefType: r.RefType, RefId: r.RefId}
+			have[k] = true
+			if !want[k] && r.CreateTime < scanTime {
+				drop = append(drop, r.Id)
+			}
+		}
+
+		if len(rs) < searchBatchNum {
+			break
+		}
+		lastId = rs[len(rs)-1].Id
+	}
+
+	for start := 0; start < len(drop); start += 500 {
+		end := start + 500
+		if end > len(drop) {
+			end = len(drop)
+		}
+
+		_, err = config.FafaRdb.Client.In("id", drop[start:end]).Delete(new(FileRef))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().Unix()
+	add := make([]FileRef, 0)
+	for k := range want {
+		if !have[k] {
+			k.CreateTime = now
+			add = append(add, k)
+		}
+	}
+
+	for start := 0; start < len(add); start += 500 {
+		end := start + 500
+		if end > len(add) {
+			end = len(add)
+		}
+
+		_, err = config.FafaRdb.Client.Insert(add[start:end])
+		if err != nil {
+			// 可能刚好被其他地方加上了，一条条补
+			for _, r := range add[start:end] {
+				ok, err := config.FafaRdb.Client.Where("file_id=?", r.FileId).And("ref_type=?", r.RefType).And("ref_id=?", r.RefId).Exist(new(FileRef))
+				if err != nil {
+					return 0, err
+				}
+
+				if !ok {
+					if _, err := config.FafaRdb.Client.InsertOne(&r); err != nil {
+						return 0, err
+					}
+				}
+			}
+		}
+	}
+
+	return len(want), nil
+}
+
+// 隐藏超过一段时间并且没有被引用的文件，垃圾回收用
+func ListOrphanFile(before int64, lastId int, limit int) ([]File, error) {
+	fs := make([]File, 0)
+	err := config.FafaRdb.Client.Where("id>?", lastId).And("status=?", 1).And("update_time<?", before).
+		And("not exists (select 1 from fafacms_file_ref r where r.file_id=fafacms_file.id)").
+		Asc("id").Limit(limit).Find(&fs)
+	return fs, err
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileHashCodes(t *testing.T) {
+	hash := "fafa_" + strings.Repeat("ab12", 16)
+	other := "hun_ter_" + strings.Repeat("0f", 32)
+
+	codes := FileHashCodes(
+		"/storage/fafa/image/"+hash+".jpg",
+		"![a](http://bucket.oss.com/storage_x/fafa/image/"+hash+"_m.webp) and <img src=\"/storage/hun_ter/file/"+other+".png\">",
+		"/storage/fafa/image/fafa_abc.jpg",
+		"",
+	)
+
+	if len(codes) != 2 || codes[0] != hash || codes[1] != other {
+		t.Fatalf("hash codes wrong: %v", codes)
+	}
+
+	// S3 的地址会转义中文用户名
+	zh := "张三_" + strings.Repeat("9e", 32)
+	codes = FileHashCodes(
+		"https://s3.example.com/fafa/storage/%E5%BC%A0%E4%B8%89/image/%E5%BC%A0%E4%B8%89_"+strings.Repeat("9e", 32)+".png",
+		"/storage/张三/image/"+zh+".png",
+	)
+
+	if len(codes) != 1 || codes[0] != zh {
+		t.Fatalf("escaped hash codes wrong: %v", codes)
+	}
+}
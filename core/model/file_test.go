@@ -0,0 +1,26 @@
+package model
+
+import "testing"
+
+func TestFile_ThumbKey(t *testing.T) {
+	f := File{StoreKey: "storage/fafa/image/fafa_abc.jpg", IsPicture: 1}
+	if f.ThumbKey("x", "") != "storage_x/fafa/image/fafa_abc.jpg" {
+		t.Fatalf("x thumb should be scale key: %s", f.ThumbKey("x", ""))
+	}
+
+	if f.ThumbKey("m", "webp") != "storage_x/fafa/image/fafa_abc_m.webp" {
+		t.Fatalf("thumb key wrong: %s", f.ThumbKey("m", "webp"))
+	}
+
+	// 旧数据没有记录缩略图
+	keys := f.ThumbKeys()
+	if len(keys) != 1 || keys["x"] != "storage_x/fafa/image/fafa_abc.jpg" {
+		t.Fatalf("legacy thumbs wrong: %v", keys)
+	}
+
+	f.SetThumbKeys(map[string]string{"m": f.ThumbKey("m", "")})
+	keys = f.ThumbKeys()
+	if len(keys) != 1 || keys["m"] != "storage_x/fafa/image/fafa_abc_m.jpg" {
+		t.Fatalf("thumbs wrong: %v", keys)
+	}
+}
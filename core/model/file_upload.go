@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 分片上传，分片放在临时目录，全部上传后合并为文件
+type FileUpload struct {
+	Id         int    `json:"-" xorm:"bigint pk autoincr"`
+	UploadId   string `json:"upload_id" xorm:"varchar(64) notnull unique"`
+	UserId     int    `json:"user_id" xorm:"bigint index"`
+	Type       string `json:"type"`
+	Tag        string `json:"tag"`
+	Describe   string `json:"describe" xorm:"TEXT"`
+	FileName   string `json:"file_name"`
+	Size       int64  `json:"size"`
+	ChunkSize  int64  `json:"chunk_size"`
+	Chunks     int    `json:"chunks"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time" xorm:"index"` // 每传一片更新一次，太久没有更新的会被清理
+}
+
+func (u *FileUpload) InsertOne() error {
+	if u.UploadId == "" || u.UserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	u.CreateTime = time.Now().Unix()
+	u.UpdateTime = u.CreateTime
+	_, err := config.FafaRdb.Client.InsertOne(u)
+	return err
+}
+
+// 只能取自己的
+func (u *FileUpload) Get() (bool, error) {
+	if u.UploadId == "" || u.UserId == 0 {
+		return false, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("upload_id=?", u.UploadId).And("user_id=?", u.UserId).Get(u)
+}
+
+func (u *FileUpload) Touch() error {
+	if u.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	u.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Cols("update_time").Update(u)
+	return err
+}
+
+func (u *FileUpload) Delete() error {
+	if u.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Delete(new(FileUpload))
+	return err
+}
+
+// 第几片的大小，最后一片可能小一点
+func (u *FileUpload) PartSize(index int) int64 {
+	if index < 0 || index >= u.Chunks {
+		return 0
+	}
+
+	if index == u.Chunks-1 {
+		return u.Size - int64(index)*u.ChunkSize
+	}
+	return u.ChunkSize
+}
+
+// 某个时间之后没有更新过的分片上传
+func ListExpiredFileUpload(before int64) ([]FileUpload, error) {
+	us := make([]FileUpload, 0)
+	err := config.FafaRdb.Client.Where("update_time<?", before).Find(&us)
+	return us, err
+}
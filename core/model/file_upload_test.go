@@ -0,0 +1,14 @@
+package model
+
+import "testing"
+
+func TestFileUpload_PartSize(t *testing.T) {
+	u := FileUpload{Size: 12, ChunkSize: 5, Chunks: 3}
+	if u.PartSize(0) != 5 || u.PartSize(1) != 5 || u.PartSize(2) != 2 {
+		t.Fatalf("part size wrong")
+	}
+
+	if u.PartSize(-1) != 0 || u.PartSize(3) != 0 {
+		t.Fatalf("part out of range should be 0")
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 关注表，用户关注用户
+type Follow struct {
+	Id           int   `json:"id" xorm:"bigint pk autoincr"`
+	UserId       int   `json:"user_id" xorm:"bigint unique(follow)"`              // 关注者的用户ID
+	FollowUserId int   `json:"follow_user_id" xorm:"bigint unique(follow) index"` // 被关注的用户ID
+	CreateTime   int64 `json:"create_time"`
+}
+
+var FollowSortName = []string{"-create_time", "=id"}
+
+// 是否已经关注
+func (f *Follow) Get() (bool, error) {
+	if f.UserId == 0 || f.FollowUserId == 0 {
+		return false, errors.New("where is empty")
+	}
+	return config.FafaRdb.Client.Where("user_id=?", f.UserId).And("follow_user_id=?", f.FollowUserId).Get(f)
+}
+
+// 关注
+func (f *Follow) InsertOne() error {
+	if f.UserId == 0 || f.FollowUserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	f.CreateTime = time.Now().Unix()
+	_, err := config.FafaRdb.InsertOne(f)
+	return err
+}
+
+// 取消关注
+func (f *Follow) Delete() error {
+	if f.UserId == 0 || f.FollowUserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	_, err := config.FafaRdb.Client.Where("user_id=?", f.UserId).And("follow_user_id=?", f.FollowUserId).Delete(new(Follow))
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/util"
 	"time"
 )
 
@@ -14,6 +15,10 @@ type Group struct {
 	CreateTime int64  `json:"create_time"`
 	UpdateTime int64  `json:"update_time,omitempty"`
 	ImagePath  string `json:"image_path" xorm:"varchar(700)"`
+	ForceTotp  int    `json:"force_totp" xorm:"not null comment('0 no, 1 yes') TINYINT(1)"` // 组下的用户必须开启两步验证
+	ParentId   int    `json:"parent_id" xorm:"bigint index"`                                // 继承父组的权限，0表示不继承
+	QuotaSize  int64  `json:"quota_size"`                                                   // 组下用户的存储配额，单位字节，0表示没有设置，-1表示不限
+	QuotaCount int64  `json:"quota_count"`                                                  // 组下用户的文件数配额，同上
 }
 
 var GroupSortName = []string{"=id", "=name", "-create_time", "=update_time"}
@@ -26,14 +31,16 @@ type Resource struct {
 	Describe   string `json:"describe" xorm:"TEXT"`
 	Admin      bool   `json:"admin"`
 	CreateTime int64  `json:"create_time"`
+	Stale      bool   `json:"stale"` // 路由已经不存在，保留记录以免丢失授权
 }
 
 var ResourceSortName = []string{"=id", "-admin", "+create_time", "-name",}
 
 type GroupResource struct {
 	Id         int `json:"id" xorm:"bigint pk autoincr"`
-	GroupId    int `json:"group_id index(gr)"`
-	ResourceId int `json:"resource_id index(gr)"`
+	GroupId    int `json:"group_id" xorm:"index(gr)"`
+	ResourceId int `json:"resource_id" xorm:"index(gr)"`
+	Effect     int `json:"effect" xorm:"not null default 0 comment('0 allow, 1 deny') TINYINT(1)"` // 拒绝优先于允许
 }
 
 func (g *Group) GetById() (exist bool, err error) {
@@ -51,6 +58,39 @@ func (g *Group) Update() error {
 
 	g.UpdateTime = time.Now().Unix()
 	_, err := config.FafaRdb.Client.Where("id=?", g.Id).Omit("id").Update(g)
+	if err == nil && g.ImagePath != "" {
+		SetFileRef(FileRefGroup, g.Id, g.ImagePath)
+	}
+	return err
+}
+
+func (g *Group) UpdateForceTotp() error {
+	if g.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	g.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", g.Id).Cols("force_totp", "update_time").Update(g)
+	return err
+}
+
+func (g *Group) UpdateQuota() error {
+	if g.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	g.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", g.Id).Cols("quota_size", "quota_count", "update_time").Update(g)
+	return err
+}
+
+func (g *Group) UpdateParent() error {
+	if g.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	g.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", g.Id).Cols("parent_id", "update_time").Update(g)
 	return err
 }
 
@@ -84,6 +124,9 @@ func (g *Group) Delete() error {
 	}
 
 	_, err := config.FafaRdb.Client.Delete(g)
+	if err == nil && g.Id != 0 {
+		RemoveFileRef(FileRefGroup, g.Id)
+	}
 	return err
 }
 
@@ -111,6 +154,11 @@ func (r *Resource) Get() (err error) {
 	return
 }
 
+// 原生获取，不区分是否管理资源
+func (r *Resource) GetRaw() (bool, error) {
+	return config.FafaRdb.Client.Get(r)
+}
+
 func (r *Resource) InsertOne() (err error) {
 	_, err = config.FafaRdb.Client.InsertOne(r)
 	if err != nil {
@@ -119,6 +167,94 @@ func (r *Resource) InsertOne() (err error) {
 	return
 }
 
+// 资源地址的哈希，地址为完整的请求路径，包括/v1前缀
+func ResourceUrlHash(url string) string {
+	hash, _ := util.Sha256([]byte(url))
+	return hash
+}
+
+// 根据请求路径获取资源
+func (r *Resource) GetByUrl() (bool, error) {
+	if r.Url == "" {
+		return false, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("url_hash=?", ResourceUrlHash(r.Url)).Get(r)
+}
+
+// 把路由同步到资源表，新路由登记，已有的以路由为准更新，不存在的路由标记为失效
+// 按地址匹配，旧版本的哈希不包括/v1前缀，也会在这里修正
+func SyncResource(rs []Resource) (added int, stale int, err error) {
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err = session.Begin()
+	if err != nil {
+		return
+	}
+
+	exists := make([]Resource, 0)
+	err = session.Find(&exists)
+	if err != nil {
+		session.Rollback()
+		return
+	}
+
+	old := make(map[string]Resource, len(exists))
+	for _, v := range exists {
+		old[v.Url] = v
+	}
+
+	now := time.Now().Unix()
+	seen := make(map[string]bool, len(rs))
+	for _, r := range rs {
+		seen[r.Url] = true
+		r.UrlHash = ResourceUrlHash(r.Url)
+		r.Stale = false
+
+		v, ok := old[r.Url]
+		if !ok {
+			r.CreateTime = now
+			_, err = session.InsertOne(&r)
+			if err != nil {
+				session.Rollback()
+				return
+			}
+			added++
+			continue
+		}
+
+		if v.UrlHash == r.UrlHash && v.Name == r.Name && v.Admin == r.Admin && !v.Stale {
+			continue
+		}
+
+		_, err = session.Where("id=?", v.Id).Cols("url_hash", "name", "admin", "stale").Update(&r)
+		if err != nil {
+			session.Rollback()
+			return
+		}
+	}
+
+	for _, v := range exists {
+		if seen[v.Url] || v.Stale {
+			continue
+		}
+
+		_, err = session.Where("id=?", v.Id).Cols("stale").Update(&Resource{Stale: true})
+		if err != nil {
+			session.Rollback()
+			return
+		}
+		stale++
+	}
+
+	err = session.Commit()
+	if err != nil {
+		session.Rollback()
+	}
+	return
+}
+
 func (gr *GroupResource) Exist() (bool, error) {
 	if gr.Id == 0 && gr.GroupId == 0 && gr.ResourceId == 0 {
 		return false, errors.New("where is empty")
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 第三方登录绑定，一个用户可以绑定多个第三方，同一个第三方账号只能绑定一个用户
+type UserIdentity struct {
+	Id          int    `json:"id" xorm:"bigint pk autoincr"`
+	UserId      int    `json:"user_id" xorm:"bigint index"`
+	Provider    string `json:"provider" xorm:"varchar(50) notnull unique(provider_uid)"`
+	ProviderUid string `json:"provider_uid" xorm:"varchar(255) notnull unique(provider_uid)"` // 第三方的用户唯一标志
+	Name        string `json:"name" xorm:"varchar(255)"`                                      // 第三方的用户名
+	Email       string `json:"email" xorm:"varchar(255)"`
+	CreateTime  int64  `json:"create_time"`
+	UpdateTime  int64  `json:"update_time,omitempty"`
+}
+
+var UserIdentitySortName = []string{"=id", "-create_time", "=provider"}
+
+// 根据第三方和第三方的用户标志获取
+func (i *UserIdentity) GetByProviderUid() (bool, error) {
+	if i.Provider == "" || i.ProviderUid == "" {
+		return false, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("provider=?", i.Provider).And("provider_uid=?", i.ProviderUid).Get(i)
+}
+
+// 用户是否已经绑定了某个第三方
+func (i *UserIdentity) ExistUserProvider() (bool, error) {
+	if i.UserId == 0 || i.Provider == "" {
+		return false, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("user_id=?", i.UserId).And("provider=?", i.Provider).Exist(new(UserIdentity))
+}
+
+func (i *UserIdentity) InsertOne() error {
+	if i.UserId == 0 || i.Provider == "" || i.ProviderUid == "" {
+		return errors.New("where is empty")
+	}
+
+	i.CreateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.InsertOne(i)
+	return err
+}
+
+// 每次登录更新第三方的用户名和邮箱
+func (i *UserIdentity) UpdateInfo() error {
+	if i.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	i.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", i.Id).Cols("name", "email", "update_time").Update(i)
+	return err
+}
+
+func (i *UserIdentity) Delete() error {
+	if i.Id == 0 || i.UserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	_, err := config.FafaRdb.Client.Where("id=?", i.Id).And("user_id=?", i.UserId).Delete(new(UserIdentity))
+	return err
+}
+
+// 第三方首次登录时创建用户并绑定
+func CreateUserWithIdentity(u *User, i *UserIdentity) error {
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err := session.Begin()
+	if err != nil {
+		return err
+	}
+
+	u.CreateTime = time.Now().Unix()
+	_, err = session.InsertOne(u)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	i.UserId = u.Id
+	i.CreateTime = u.CreateTime
+	_, err = session.InsertOne(i)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
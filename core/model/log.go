@@ -1,20 +1,46 @@
 package model
 
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+)
+
 type Log struct {
 	Id           int    `json:"id" xorm:"bigint pk autoincr"`
-	Cid          string `json:"cid"`
+	Cid          string `json:"cid" xorm:"varchar(50) index"`
 	Ip           string `json:"ip"`
-	Url          string `json:"url"`
-	LogTime      int64  `json:"log_time"`
-	Ua           string `json:"ua"`
+	Url          string `json:"url" xorm:"varchar(255) index"`
+	LogTime      int64  `json:"log_time" xorm:"index"`
+	Ua           string `json:"ua" xorm:"varchar(500)"`
 	UserId       int    `json:"user_id" xorm:"bigint index"`
 	Flag         bool   `json:"flag"`
 	In           string `json:"in" xorm:"TEXT"`
 	Out          string `json:"out" xorm:"TEXT"`
-	ErrorId      string `json:"error_id"`
-	ErrorMessage string `json:"error_message"`
+	ErrorId      string `json:"error_id" xorm:"varchar(50) index"`
+	ErrorMessage string `json:"error_message" xorm:"TEXT"`
 	Aa           string `json:"aa,omitempty"`
 	Ab           string `json:"ab,omitempty"`
 	Ac           string `json:"ac,omitempty"`
 	Ad           string `json:"ad,omitempty"`
 }
+
+var LogSortName = []string{"=id", "-log_time", "=user_id", "=url"}
+
+// 批量插入审计日志
+func InsertLogs(logs []Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	_, err := config.FafaRdb.Client.Insert(&logs)
+	return err
+}
+
+// 删除某个时间之前的审计日志
+func DeleteLogBefore(logTime int64) (int64, error) {
+	if logTime <= 0 {
+		return 0, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("log_time<?", logTime).Delete(new(Log))
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+const (
+	LoginTokenTypeRemember = 0 // 记住登录的令牌
+	LoginTokenTypeSession  = 1 // Session
+)
+
+// 轮换后旧的校验串还能用多少秒，页面同时发出的请求带的都是旧 cookie
+const LoginTokenRotateGrace = 30
+
+// 用户登录的设备，包括记住登录的令牌和Session
+// 记住登录的 cookie 为 selector|validator，库中只保存 validator 的哈希
+// Session 的 selector 为 Session 令牌，撤销时要去存储中删除
+type LoginToken struct {
+	Id           int    `json:"id" xorm:"bigint pk autoincr"`
+	UserId       int    `json:"user_id" xorm:"bigint index"`
+	Types        int    `json:"types" xorm:"not null comment('0 remember, 1 session') TINYINT(1) index"`
+	Selector     string `json:"-" xorm:"varchar(100) notnull unique"`
+	Validator    string `json:"-" xorm:"varchar(100)"`
+	PreValidator string `json:"-" xorm:"varchar(100)"` // 轮换前的校验串哈希
+	RotateTime   int64  `json:"-"`
+	Ip           string `json:"ip" xorm:"varchar(100)"`
+	UserAgent    string `json:"user_agent" xorm:"varchar(700)"`
+	CreateTime   int64  `json:"create_time"`
+	LastUseTime  int64  `json:"last_use_time"`
+	ExpireTime   int64  `json:"expire_time" xorm:"index"`
+}
+
+var LoginTokenSortName = []string{"=id", "-last_use_time", "-create_time", "=types"}
+
+func (t *LoginToken) InsertOne() error {
+	if t.UserId == 0 || t.Selector == "" {
+		return errors.New("where is empty")
+	}
+
+	now := time.Now().Unix()
+
+	// 顺便清理该用户过期的
+	_, err := config.FafaRdb.Client.Where("user_id=?", t.UserId).And("expire_time<=?", now).Delete(new(LoginToken))
+	if err != nil {
+		return err
+	}
+
+	t.CreateTime = now
+	t.LastUseTime = now
+	_, err = config.FafaRdb.Client.InsertOne(t)
+	return err
+}
+
+// 根据 selector 获取，过期的不要
+func (t *LoginToken) GetBySelector() (bool, error) {
+	if t.Selector == "" {
+		return false, errors.New("where is empty")
+	}
+
+	return config.FafaRdb.Client.Where("selector=?", t.Selector).And("types=?", t.Types).And("expire_time>?", time.Now().Unix()).Get(t)
+}
+
+// 校验串的哈希是否正确，返回是否通过，以及是否需要轮换
+// 刚轮换过的一小段时间内旧的也算通过，但不再轮换
+func (t *LoginToken) CheckValidator(hash string, now int64) (bool, bool) {
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(t.Validator)) == 1 {
+		return true, true
+	}
+
+	if t.PreValidator != "" && now-t.RotateTime <= LoginTokenRotateGrace &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(t.PreValidator)) == 1 {
+		return true, false
+	}
+	return false, false
+}
+
+// 轮换校验串，每次使用后旧的 cookie 过一会就失效，validator 为新的哈希
+// 同时有别的请求先轮换了返回 false，这时不用再发新的 cookie
+func (t *LoginToken) Rotate(validator string) (bool, error) {
+	if t.Id == 0 {
+		return false, errors.New("where is empty")
+	}
+
+	old := t.Validator
+	t.PreValidator = old
+	t.Validator = validator
+	t.LastUseTime = time.Now().Unix()
+	t.RotateTime = t.LastUseTime
+	n, err := config.FafaRdb.Client.Where("id=?", t.Id).And("validator=?", old).Cols("validator", "pre_validator", "rotate_time", "ip", "user_agent", "last_use_time", "expire_time").Update(t)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (t *LoginToken) DeleteBySelector() error {
+	if t.Selector == "" {
+		return errors.New("where is empty")
+	}
+
+	_, err := config.FafaRdb.Client.Where("selector=?", t.Selector).And("types=?", t.Types).Delete(new(LoginToken))
+	return err
+}
+
+// 删除用户的登录设备，ids为空表示全部，返回被删除的 Session 令牌
+func DeleteLoginTokens(userId int, ids []int) ([]string, error) {
+	if userId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err := session.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	ts := make([]LoginToken, 0)
+	session.Where("user_id=?", userId)
+	if len(ids) > 0 {
+		session.In("id", ids)
+	}
+	err = session.Find(&ts)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if len(ts) == 0 {
+		session.Rollback()
+		return []string{}, nil
+	}
+
+	deleteIds := make([]int, 0, len(ts))
+	tokens := make([]string, 0)
+	for _, v := range ts {
+		deleteIds = append(deleteIds, v.Id)
+		if v.Types == LoginTokenTypeSession {
+			tokens = append(tokens, v.Selector)
+		}
+	}
+
+	_, err = session.In("id", deleteIds).Delete(new(LoginToken))
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	return tokens, nil
+}
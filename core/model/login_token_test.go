@@ -0,0 +1,29 @@
+package model
+
+import "testing"
+
+func TestLoginToken_CheckValidator(t *testing.T) {
+	token := &LoginToken{Validator: "new", PreValidator: "old", RotateTime: 100}
+
+	if ok, rotate := token.CheckValidator("new", 200); !ok || !rotate {
+		t.Fatalf("current validator should pass and rotate")
+	}
+
+	// 刚轮换过，旧的还能用
+	if ok, rotate := token.CheckValidator("old", 100+LoginTokenRotateGrace); !ok || rotate {
+		t.Fatalf("previous validator in grace should pass without rotate")
+	}
+
+	if ok, _ := token.CheckValidator("old", 101+LoginTokenRotateGrace); ok {
+		t.Fatalf("previous validator after grace should fail")
+	}
+
+	if ok, _ := token.CheckValidator("other", 100); ok {
+		t.Fatalf("wrong validator should fail")
+	}
+
+	token.PreValidator = ""
+	if ok, _ := token.CheckValidator("", 100); ok {
+		t.Fatalf("empty previous validator should fail")
+	}
+}
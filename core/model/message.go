@@ -0,0 +1,72 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 站内信表，每个接收者一条记录
+type Message struct {
+	Id            int    `json:"id" xorm:"bigint pk autoincr"`
+	SendUserId    int    `json:"send_user_id" xorm:"bigint index"`                                                                               // 发送者的用户ID，系统发送为0
+	ReceiveUserId int    `json:"receive_user_id" xorm:"bigint index"`                                                                            // 接收者的用户ID
+	MessageType   int    `json:"message_type" xorm:"not null comment('0 global, 1 comment, 2 reply, 3 follow, 4 content ban') TINYINT(1) index"` // 站内信类型
+	ObjectId      int    `json:"object_id,omitempty" xorm:"bigint"`                                                                              // 相关的内容ID，关注时为关注者的用户ID
+	CommentId     int    `json:"comment_id,omitempty" xorm:"bigint"`                                                                             // 相关的评论ID
+	Describe      string `json:"describe" xorm:"TEXT"`
+	Status        int    `json:"status" xorm:"not null comment('0 unread, 1 read') TINYINT(1) index"`
+	CreateTime    int64  `json:"create_time"`
+	ReadTime      int64  `json:"read_time,omitempty"`
+}
+
+const (
+	MessageTypeGlobal     = 0
+	MessageTypeComment    = 1
+	MessageTypeReply      = 2
+	MessageTypeFollow     = 3
+	MessageTypeContentBan = 4
+)
+
+var MessageSortName = []string{"=id", "-create_time", "=status", "=message_type"}
+
+// 发送站内信
+func (m *Message) InsertOne() error {
+	if m.ReceiveUserId == 0 {
+		return errors.New("where is empty")
+	}
+
+	m.CreateTime = time.Now().Unix()
+	_, err := config.FafaRdb.InsertOne(m)
+	return err
+}
+
+// 批量发送站内信，群发时使用
+func InsertMessages(ms []Message) error {
+	if len(ms) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for k := range ms {
+		ms[k].CreateTime = now
+	}
+
+	_, err := config.FafaRdb.Client.Insert(&ms)
+	return err
+}
+
+// 标记已读，ids为空时全部标记已读
+func (m *Message) Read(ids []int) (int64, error) {
+	if m.ReceiveUserId == 0 {
+		return 0, errors.New("where is empty")
+	}
+
+	m.Status = 1
+	m.ReadTime = time.Now().Unix()
+	session := config.FafaRdb.Client.Where("receive_user_id=?", m.ReceiveUserId).And("status=?", 0)
+	if len(ids) > 0 {
+		session.In("id", ids)
+	}
+	return session.Cols("status", "read_time").Update(m)
+}
@@ -84,6 +84,9 @@ func (n *ContentNode) CheckChildrenNum() (int, error) {
 func (n *ContentNode) InsertOne() error {
 	n.CreateTime = time.Now().Unix()
 	_, err := config.FafaRdb.Insert(n)
+	if err == nil && n.ImagePath != "" {
+		SetFileRef(FileRefNode, n.Id, n.ImagePath)
+	}
 	return err
 }
 
@@ -175,6 +178,9 @@ func (n *ContentNode) UpdateImage() error {
 	defer session.Close()
 	n.UpdateTime = time.Now().Unix()
 	_, err := session.Where("id=?", n.Id).And("user_id=?", n.UserId).MustCols("image_path").Omit("id", "user_id").Update(n)
+	if err == nil {
+		SetFileRef(FileRefNode, n.Id, n.ImagePath)
+	}
 	return err
 }
 
@@ -0,0 +1,283 @@
+package model
+
+import (
+	"errors"
+	"github.com/go-xorm/xorm"
+	"github.com/hunterhug/fafacms/core/config"
+	"strings"
+	"time"
+)
+
+const (
+	EffectAllow = 0 // 允许
+	EffectDeny  = 1 // 显式拒绝，优先于允许
+)
+
+// 用户和组多对多，User.GroupId 只保留为主组，权限以这张表为准
+type UserGroup struct {
+	Id         int   `json:"id" xorm:"bigint pk autoincr"`
+	UserId     int   `json:"user_id" xorm:"bigint notnull unique(ug)"`
+	GroupId    int   `json:"group_id" xorm:"bigint notnull unique(ug) index"`
+	CreateTime int64 `json:"create_time"`
+}
+
+// 用户直接所在的组
+func GetUserGroupIds(userId int) ([]int, error) {
+	if userId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	ugs := make([]UserGroup, 0)
+	err := config.FafaRdb.Client.Where("user_id=?", userId).Find(&ugs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(ugs))
+	for _, v := range ugs {
+		ids = append(ids, v.GroupId)
+	}
+	return ids, nil
+}
+
+// 这些组和它们祖先的父组，key为组id
+// 每次请求都要判断权限，不能查整张组表，一层层往上找
+func groupParents(ids []int) (map[int]int, error) {
+	parents := make(map[int]int)
+	next := ids
+	for len(next) > 0 {
+		gs := make([]Group, 0)
+		err := config.FafaRdb.Client.Cols("id", "parent_id").In("id", next).Find(&gs)
+		if err != nil {
+			return nil, err
+		}
+
+		next = make([]int, 0)
+		for _, g := range gs {
+			parents[g.Id] = g.ParentId
+		}
+
+		for _, g := range gs {
+			// 已经查过的不再查，防止继承成环
+			if _, ok := parents[g.ParentId]; g.ParentId != 0 && !ok {
+				next = append(next, g.ParentId)
+			}
+		}
+	}
+	return parents, nil
+}
+
+// 加上继承的祖先组，返回组id到它是从哪个直接组继承来的，直接组对应自己
+func ExpandGroupIds(ids []int) (map[int]int, error) {
+	back := make(map[int]int)
+	if len(ids) == 0 {
+		return back, nil
+	}
+
+	parents, err := groupParents(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		// 已经走过的不再走，防止继承成环
+		for now := id; now != 0; now = parents[now] {
+			if _, ok := back[now]; ok {
+				break
+			}
+			back[now] = id
+		}
+	}
+	return back, nil
+}
+
+// 组的祖先，不包括自己
+func GroupAncestorIds(groupId int) ([]int, error) {
+	parents, err := groupParents([]int{groupId})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0)
+	seen := map[int]bool{groupId: true}
+	for now := parents[groupId]; now != 0 && !seen[now]; now = parents[now] {
+		seen[now] = true
+		ids = append(ids, now)
+	}
+	return ids, nil
+}
+
+// 用户所有的组，包括继承的
+func GetUserAllGroupIds(userId int) ([]int, error) {
+	direct, err := GetUserGroupIds(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := ExpandGroupIds(direct)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(all))
+	for id := range all {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 根据规则判断，任何一个组拒绝就拒绝
+// 管理资源需要有组允许，普通资源没有拒绝就允许
+func Decide(admin bool, grs []GroupResource) bool {
+	allow := false
+	for _, v := range grs {
+		if v.Effect == EffectDeny {
+			return false
+		}
+		allow = true
+	}
+
+	if admin {
+		return allow
+	}
+	return true
+}
+
+// 用户是否可以访问某资源
+func CheckPermission(userId int, r *Resource) (bool, error) {
+	if userId == 0 || r.Id == 0 {
+		return false, errors.New("where is empty")
+	}
+
+	groupIds, err := GetUserAllGroupIds(userId)
+	if err != nil {
+		return false, err
+	}
+
+	grs := make([]GroupResource, 0)
+	if len(groupIds) > 0 {
+		err = config.FafaRdb.Client.Where("resource_id=?", r.Id).In("group_id", groupIds).Find(&grs)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return Decide(r.Admin, grs), nil
+}
+
+// 旧数据迁移，把 User.GroupId 写入用户组关联表，可以重复执行
+func MigrateUserGroup() (int64, error) {
+	result, err := config.FafaRdb.Client.Exec("insert into fafacms_user_group (user_id, group_id, create_time) " +
+		"select u.id, u.group_id, u.create_time from fafacms_user u where u.group_id>0 " +
+		"and not exists (select 1 from fafacms_user_group ug where ug.user_id=u.id and ug.group_id=u.group_id)")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 把用户加入组
+func AddUserGroup(userIds []int, groupId int) error {
+	if len(userIds) == 0 || groupId == 0 {
+		return errors.New("where is empty")
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err := session.Begin()
+	if err != nil {
+		return err
+	}
+
+	exists := make([]UserGroup, 0)
+	err = session.Where("group_id=?", groupId).In("user_id", userIds).Find(&exists)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	has := make(map[int]bool, len(exists))
+	for _, v := range exists {
+		has[v.UserId] = true
+	}
+
+	now := time.Now().Unix()
+	ugs := make([]UserGroup, 0, len(userIds))
+	for _, id := range userIds {
+		if !has[id] {
+			has[id] = true
+			ugs = append(ugs, UserGroup{UserId: id, GroupId: groupId, CreateTime: now})
+		}
+	}
+
+	if len(ugs) > 0 {
+		_, err = session.Insert(ugs)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	err = syncUserMainGroup(session, userIds)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
+
+// 把用户移出组，groupId为0表示移出全部组
+func RemoveUserGroup(userIds []int, groupId int) error {
+	if len(userIds) == 0 {
+		return errors.New("where is empty")
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err := session.Begin()
+	if err != nil {
+		return err
+	}
+
+	session.In("user_id", userIds)
+	if groupId != 0 {
+		session.And("group_id=?", groupId)
+	}
+	_, err = session.Delete(new(UserGroup))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	err = syncUserMainGroup(session, userIds)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
+
+// 主组取剩下的组中最小的，没有了为0
+func syncUserMainGroup(session *xorm.Session, userIds []int) error {
+	args := make([]interface{}, 0, len(userIds)+1)
+	args = append(args, "update fafacms_user set group_id=coalesce((select min(ug.group_id) from fafacms_user_group ug where ug.user_id=fafacms_user.id), 0) "+
+		"where id in ("+strings.TrimSuffix(strings.Repeat("?,", len(userIds)), ",")+")")
+	for _, id := range userIds {
+		args = append(args, id)
+	}
+
+	_, err := session.Exec(args...)
+	return err
+}
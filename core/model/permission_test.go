@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestDecide(t *testing.T) {
+	allow := GroupResource{GroupId: 1, ResourceId: 1, Effect: EffectAllow}
+	deny := GroupResource{GroupId: 2, ResourceId: 1, Effect: EffectDeny}
+
+	if Decide(true, nil) {
+		t.Fatalf("admin resource without allow should deny")
+	}
+
+	if !Decide(true, []GroupResource{allow}) {
+		t.Fatalf("admin resource with allow should allow")
+	}
+
+	if !Decide(false, nil) {
+		t.Fatalf("normal resource should allow by default")
+	}
+
+	if Decide(true, []GroupResource{allow, deny}) || Decide(false, []GroupResource{deny, allow}) {
+		t.Fatalf("deny should win")
+	}
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+)
+
+// 用户和组的配额设置为-1表示不限，0表示没有设置
+const QuotaUnlimited = -1
+
+// 实际生效的配额，为0表示不限
+type Quota struct {
+	Size  int64 `json:"size"`
+	Count int64 `json:"count"`
+}
+
+// 文件占用的空间，按类型或标签统计时 Name 为类型或标签
+type FileUsage struct {
+	Name  string `json:"name,omitempty"`
+	Size  int64  `json:"size"`
+	Count int64  `json:"count"`
+}
+
+var FileUsageSortName = []string{"-size", "=count", "=user_id"}
+
+// 一项配额，用户单独设置的优先，其次是所在组中最宽的，都没有设置用默认值，返回0表示不限
+func ResolveQuota(user int64, groups []int64, def int64) int64 {
+	if user == QuotaUnlimited {
+		return 0
+	}
+
+	if user > 0 {
+		return user
+	}
+
+	var back int64
+	for _, v := range groups {
+		if v == QuotaUnlimited {
+			return 0
+		}
+
+		if v > back {
+			back = v
+		}
+	}
+
+	if back > 0 {
+		return back
+	}
+
+	if def < 0 {
+		return 0
+	}
+	return def
+}
+
+// 用户实际的配额，组包括继承来的
+func GetUserQuota(userId int, def Quota) (*Quota, error) {
+	if userId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	u := new(User)
+	ok, err := config.FafaRdb.Client.Cols("quota_size", "quota_count").Where("id=?", userId).Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+
+	groupIds, err := GetUserAllGroupIds(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	gs := make([]Group, 0)
+	if len(groupIds) > 0 {
+		err = config.FafaRdb.Client.Cols("quota_size", "quota_count").In("id", groupIds).Find(&gs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sizes := make([]int64, 0, len(gs))
+	counts := make([]int64, 0, len(gs))
+	for _, g := range gs {
+		sizes = append(sizes, g.QuotaSize)
+		counts = append(counts, g.QuotaCount)
+	}
+
+	return &Quota{
+		Size:  ResolveQuota(u.QuotaSize, sizes, def.Size),
+		Count: ResolveQuota(u.QuotaCount, counts, def.Count),
+	}, nil
+}
+
+// 用户已经用了多少，隐藏的文件也还占着空间
+func GetFileUsage(userId int) (*FileUsage, error) {
+	if userId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	size, err := config.FafaRdb.Client.Where("user_id=?", userId).SumInt(new(File), "size")
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := config.FafaRdb.Client.Where("user_id=?", userId).Count(new(File))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileUsage{Size: size, Count: count}, nil
+}
+
+// 按类型或者标签统计用户的占用
+func ListFileUsage(userId int, by string) ([]FileUsage, error) {
+	if userId == 0 {
+		return nil, errors.New("where is empty")
+	}
+
+	if by != "type" && by != "tag" {
+		return nil, errors.New("usage by type or tag")
+	}
+
+	us := make([]FileUsage, 0)
+	err := config.FafaRdb.Client.Table(new(File)).Select(by+" as name, sum(size) as size, count(id) as count").
+		Where("user_id=?", userId).GroupBy(by).Desc("size").Find(&us)
+	return us, err
+}
@@ -0,0 +1,27 @@
+package model
+
+import "testing"
+
+func TestResolveQuota(t *testing.T) {
+	cases := []struct {
+		user   int64
+		groups []int64
+		def    int64
+		want   int64
+	}{
+		{0, nil, 0, 0},
+		{0, nil, 100, 100},
+		{50, []int64{200}, 100, 50},            // 管理员单独设置的优先
+		{QuotaUnlimited, []int64{200}, 100, 0}, // 单独设置了不限
+		{0, []int64{0, 200, 300}, 100, 300},    // 组中取最宽的
+		{0, []int64{200, QuotaUnlimited}, 100, 0},
+		{0, []int64{0}, 100, 100}, // 组没有设置用默认
+		{0, nil, QuotaUnlimited, 0},
+	}
+
+	for _, v := range cases {
+		if got := ResolveQuota(v.user, v.groups, v.def); got != v.want {
+			t.Fatalf("resolve %d %v %d: got %d, want %d", v.user, v.groups, v.def, got, v.want)
+		}
+	}
+}
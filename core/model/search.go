@@ -0,0 +1,71 @@
+package model
+
+import (
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/flog"
+	"github.com/hunterhug/fafacms/core/util/search"
+)
+
+// 内容全文索引，进程内维护，启动时重建，内容发布、删除和状态改变时更新
+var ContentSearch = search.NewIndex()
+
+// 重建时每批读取的数量
+const searchBatchNum = 500
+
+func content2Doc(c *Content) search.Doc {
+	return search.Doc{
+		Id:          c.Id,
+		UserId:      c.UserId,
+		NodeId:      c.NodeId,
+		Status:      c.Status,
+		Locked:      c.Password != "",
+		Title:       c.Title,
+		Describe:    c.Describe,
+		CreateTime:  c.CreateTime,
+		PublishTime: c.PublishTime,
+	}
+}
+
+// 重建索引，只索引发布过的内容
+func RebuildContentSearch() (int, error) {
+	index := search.NewIndex()
+	lastId := 0
+	for {
+		cs := make([]Content, 0)
+		err := config.FafaRdb.Client.Cols("id", "user_id", "node_id", "status", "password", "title", "describe", "create_time", "publish_time").
+			Where("id>?", lastId).And("version>?", 0).Asc("id").Limit(searchBatchNum).Find(&cs)
+		if err != nil {
+			return 0, err
+		}
+
+		for k := range cs {
+			index.Put(content2Doc(&cs[k]))
+		}
+
+		if len(cs) < searchBatchNum {
+			break
+		}
+		lastId = cs[len(cs)-1].Id
+	}
+
+	ContentSearch = index
+	return index.Len(), nil
+}
+
+// 同步某内容到索引，内容不存在或者没有发布就移除
+func SyncContentSearch(id int) {
+	c := new(Content)
+	c.Id = id
+	exist, err := c.GetByRaw()
+	if err != nil {
+		flog.Log.Errorf("SyncContentSearch err: %s", err.Error())
+		return
+	}
+
+	if !exist || c.Version == 0 {
+		ContentSearch.Remove(id)
+		return
+	}
+
+	ContentSearch.Put(content2Doc(c))
+}
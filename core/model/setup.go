@@ -0,0 +1,129 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 超级管理员组，拥有全部资源
+const SuperAdminGroupName = "super_admin"
+
+// 获取超级管理员组
+func GetSuperAdminGroup() (*Group, bool, error) {
+	g := new(Group)
+	exist, err := config.FafaRdb.Client.Where("name=?", SuperAdminGroupName).Get(g)
+	return g, exist, err
+}
+
+// 是否已经有可用的超级管理员
+func HasSuperAdmin() (bool, error) {
+	g, exist, err := GetSuperAdminGroup()
+	if err != nil || !exist {
+		return false, err
+	}
+
+	num, err := config.FafaRdb.Client.Table(new(User)).Where("id in (select user_id from fafacms_user_group where group_id=?)", g.Id).And("status=?", 1).Count()
+	return num > 0, err
+}
+
+// 把还没有分配的资源都分配给组，新增路由后组也能马上拥有
+func SyncGroupAllResource(groupId int) error {
+	if groupId == 0 {
+		return errors.New("where is empty")
+	}
+
+	rs := make([]Resource, 0)
+	err := config.FafaRdb.Client.Where("id not in (select resource_id from fafacms_group_resource where group_id=?)", groupId).Find(&rs)
+	if err != nil {
+		return err
+	}
+
+	if len(rs) == 0 {
+		return nil
+	}
+
+	grs := make([]GroupResource, 0, len(rs))
+	for _, r := range rs {
+		grs = append(grs, GroupResource{GroupId: groupId, ResourceId: r.Id})
+	}
+
+	_, err = config.FafaRdb.Client.Insert(grs)
+	return err
+}
+
+// 创建超级管理员，组不存在时一并创建，组拥有全部资源
+func CreateSuperAdmin(u *User) error {
+	if u.Name == "" || u.Email == "" || u.Password == "" {
+		return errors.New("where is empty")
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+
+	err := session.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	g := new(Group)
+	exist, err := session.Where("name=?", SuperAdminGroupName).Get(g)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if !exist {
+		g.Name = SuperAdminGroupName
+		g.Describe = "super admin, has all resource"
+		g.CreateTime = now
+		_, err = session.InsertOne(g)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	rs := make([]Resource, 0)
+	err = session.Where("id not in (select resource_id from fafacms_group_resource where group_id=?)", g.Id).Find(&rs)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if len(rs) > 0 {
+		grs := make([]GroupResource, 0, len(rs))
+		for _, r := range rs {
+			grs = append(grs, GroupResource{GroupId: g.Id, ResourceId: r.Id})
+		}
+
+		_, err = session.Insert(grs)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	u.GroupId = g.Id
+	u.Status = 1
+	u.CreateTime = now
+	_, err = session.InsertOne(u)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	_, err = session.InsertOne(&UserGroup{UserId: u.Id, GroupId: g.Id, CreateTime: now})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"errors"
+	"github.com/hunterhug/fafacms/core/config"
+	"strings"
+	"time"
+)
+
+// 标签表，所有用户共用
+type Tag struct {
+	Id         int    `json:"id" xorm:"bigint pk autoincr"`
+	Name       string `json:"name" xorm:"varchar(100) notnull unique"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// 内容标签关联表
+type ContentTag struct {
+	Id         int   `json:"id" xorm:"bigint pk autoincr"`
+	ContentId  int   `json:"content_id" xorm:"bigint unique(content_tag)"`
+	TagId      int   `json:"tag_id" xorm:"bigint unique(content_tag) index"`
+	UserId     int   `json:"user_id" xorm:"bigint index"` // 内容所属的用户ID
+	CreateTime int64 `json:"create_time"`
+}
+
+// 标签名去掉空白并去重
+func CleanTagNames(names []string) []string {
+	back := make([]string, 0, len(names))
+	exist := make(map[string]bool)
+	for _, v := range names {
+		v = strings.TrimSpace(v)
+		if v == "" || exist[v] {
+			continue
+		}
+		exist[v] = true
+		back = append(back, v)
+	}
+	return back
+}
+
+// 获取标签，需要标签ID或名字
+func (t *Tag) Get() (bool, error) {
+	if t.Id == 0 && t.Name == "" {
+		return false, errors.New("where is empty")
+	}
+	return config.FafaRdb.Client.Get(t)
+}
+
+// 设置内容的标签，不存在的标签会被创建，原来的标签会被替换
+func SetContentTags(contentId int, userId int, names []string) error {
+	if contentId == 0 || userId == 0 {
+		return errors.New("where is empty")
+	}
+
+	names = CleanTagNames(names)
+	tagIds := make([]int, 0, len(names))
+	for _, name := range names {
+		tag := new(Tag)
+		tag.Name = name
+		exist, err := tag.Get()
+		if err != nil {
+			return err
+		}
+
+		if !exist {
+			tag.CreateTime = time.Now().Unix()
+			_, err = config.FafaRdb.InsertOne(tag)
+			if err != nil {
+				// 可能被别人同时创建了，再找一次
+				tag = new(Tag)
+				tag.Name = name
+				exist, err = tag.Get()
+				if err != nil {
+					return err
+				}
+				if !exist {
+					return errors.New("tag create fail")
+				}
+			}
+		}
+
+		tagIds = append(tagIds, tag.Id)
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if _, err := session.Where("content_id=?", contentId).Delete(new(ContentTag)); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if len(tagIds) > 0 {
+		now := time.Now().Unix()
+		cts := make([]ContentTag, 0, len(tagIds))
+		for _, v := range tagIds {
+			cts = append(cts, ContentTag{ContentId: contentId, TagId: v, UserId: userId, CreateTime: now})
+		}
+
+		if _, err := session.Insert(&cts); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
+
+// 批量获取内容的标签名，键为内容ID
+func GetContentsTags(contentIds []int) (map[int][]string, error) {
+	back := make(map[int][]string)
+	if len(contentIds) == 0 {
+		return back, nil
+	}
+
+	type contentTagName struct {
+		ContentId int
+		Name      string
+	}
+
+	result := make([]contentTagName, 0)
+	err := config.FafaRdb.Client.Table(new(ContentTag)).Alias("ct").
+		Select("ct.content_id, t.name").
+		Join("INNER", []string{"fafacms_tag", "t"}, "t.id = ct.tag_id").
+		In("ct.content_id", contentIds).Asc("ct.id").Find(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range result {
+		back[v.ContentId] = append(back[v.ContentId], v.Name)
+	}
+	return back, nil
+}
@@ -18,7 +18,7 @@ type User struct {
 	WeiBo               string `json:"weibo" xorm:"TEXT"`
 	Github              string `json:"github" xorm:"TEXT"`
 	QQ                  string `json:"qq" xorm:"varchar(100)"`
-	Password            string `json:"password,omitempty" xorm:"varchar(100)"` // 明文的密码，就是这么强
+	Password            string `json:"password,omitempty" xorm:"varchar(100)"` // 密码的哈希，旧数据可能是明文，登录成功后会自动转换
 	Gender              int    `json:"gender" xorm:"not null comment('0 unknow,1 boy,2 girl') TINYINT(1)"`
 	Describe            string `json:"describe" xorm:"TEXT"`
 	HeadPhoto           string `json:"head_photo" xorm:"varchar(700)"`
@@ -28,8 +28,14 @@ type User struct {
 	ActivateCodeExpired int64  `json:"activate_code_expired,omitempty"`      // activate code expired time
 	Status              int    `json:"status" xorm:"not null comment('0 unactive, 1 normal, 2 black') TINYINT(1) index"`
 	GroupId             int    `json:"group_id,omitempty" xorm:"bigint index"`
-	ResetCode           string `json:"reset_code,omitempty" xorm:"index"` // forget password code
-	ResetCodeExpired    int64  `json:"reset_code_expired,omitempty"`      // forget password code expired
+	ResetCode           string `json:"reset_code,omitempty" xorm:"index"`                                 // forget password code
+	ResetCodeExpired    int64  `json:"reset_code_expired,omitempty"`                                      // forget password code expired
+	TotpEnable          int    `json:"totp_enable" xorm:"not null comment('0 close, 1 open') TINYINT(1)"` // 两步验证是否开启
+	TotpSecret          string `json:"-" xorm:"varchar(100)"`                                             // 两步验证的密钥，开启前为待验证的
+	TotpRecovery        string `json:"-" xorm:"TEXT"`                                                     // 恢复码的哈希，逗号隔开，用一个少一个
+	TotpLastCounter     int64  `json:"-"`                                                                 // 上次使用的验证码周期，防止重放
+	QuotaSize           int64  `json:"quota_size"`                                                        // 管理员单独设置的存储配额，单位字节，0表示按所在组，-1表示不限
+	QuotaCount          int64  `json:"quota_count"`                                                       // 管理员单独设置的文件数配额，同上
 	Aa                  string `json:"aa,omitempty"`
 	Ab                  string `json:"ab,omitempty"`
 	Ac                  string `json:"ac,omitempty"`
@@ -114,6 +120,9 @@ func (u *User) IsEmailRepeat() (bool, error) {
 func (u *User) InsertOne() error {
 	u.CreateTime = time.Now().Unix()
 	_, err := config.FafaRdb.Insert(u)
+	if err == nil && u.HeadPhoto != "" {
+		SetFileRef(FileRefUser, u.Id, u.HeadPhoto)
+	}
 	return err
 }
 
@@ -175,6 +184,63 @@ func (u *User) UpdatePassword() error {
 	return err
 }
 
+// 只更新密码，旧的明文密码登录后转为哈希时用
+func (u *User) UpdatePasswordHash() error {
+	if u.Id == 0 || u.Password == "" {
+		return errors.New("where is empty")
+	}
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Cols("password").Update(u)
+	return err
+}
+
+// 第三方验证过的邮箱认领没激活的账号，账号可能是别人用这个邮箱抢注的
+// 注册时设的密码和两步验证都不能留，清掉后再激活，返回是否需要这样处理
+func (u *User) PrepareEmailClaim() bool {
+	if u.Status != 0 {
+		return false
+	}
+
+	u.Status = 1
+	u.Password = ""
+	u.TotpEnable = 0
+	u.TotpSecret = ""
+	u.TotpRecovery = ""
+	u.TotpLastCounter = 0
+	return true
+}
+
+// 保存认领后的账号，零值也要更新
+func (u *User) UpdateEmailClaim() error {
+	if u.Id == 0 {
+		return errors.New("where is empty")
+	}
+	u.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).And("status=?", 0).
+		Cols("status", "password", "totp_enable", "totp_secret", "totp_recovery", "totp_last_counter", "update_time").Update(u)
+	return err
+}
+
+// 更新两步验证的信息，零值也要更新
+func (u *User) UpdateTotp() error {
+	if u.Id == 0 {
+		return errors.New("where is empty")
+	}
+	u.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Cols("totp_enable", "totp_secret", "totp_recovery", "totp_last_counter", "update_time").Update(u)
+	return err
+}
+
+// 管理员设置用户的配额
+func (u *User) UpdateQuota() error {
+	if u.Id == 0 {
+		return errors.New("where is empty")
+	}
+
+	u.UpdateTime = time.Now().Unix()
+	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Cols("quota_size", "quota_count", "update_time").Update(u)
+	return err
+}
+
 func (u *User) UpdateInfo() error {
 	if u.Id == 0 {
 		return errors.New("where is empty")
@@ -182,5 +248,10 @@ func (u *User) UpdateInfo() error {
 
 	u.UpdateTime = time.Now().Unix()
 	_, err := config.FafaRdb.Client.Where("id=?", u.Id).Omit("id").Update(u)
+
+	// 空的字段不会更新，头像也就没变
+	if err == nil && u.HeadPhoto != "" {
+		SetFileRef(FileRefUser, u.Id, u.HeadPhoto)
+	}
 	return err
 }
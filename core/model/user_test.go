@@ -0,0 +1,21 @@
+package model
+
+import "testing"
+
+func TestUser_PrepareEmailClaim(t *testing.T) {
+	// 别人用这个邮箱抢注的，没有激活
+	u := &User{Status: 0, Password: "attacker", TotpEnable: 1, TotpSecret: "secret", TotpRecovery: "a,b", TotpLastCounter: 9}
+	if !u.PrepareEmailClaim() {
+		t.Fatalf("unactive user should be reset")
+	}
+
+	if u.Status != 1 || u.Password != "" || u.TotpEnable != 0 || u.TotpSecret != "" || u.TotpRecovery != "" || u.TotpLastCounter != 0 {
+		t.Fatalf("claim reset wrong: %+v", u)
+	}
+
+	// 已经激活的账号只绑定，不动
+	u = &User{Status: 1, Password: "mine", TotpEnable: 1}
+	if u.PrepareEmailClaim() || u.Password != "mine" || u.TotpEnable != 1 {
+		t.Fatalf("active user should not be reset: %+v", u)
+	}
+}
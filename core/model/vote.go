@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hunterhug/fafacms/core/config"
+	"time"
+)
+
+// 点赞表，一个用户对一个对象只能投一次
+type Vote struct {
+	Id           int   `json:"id" xorm:"bigint pk autoincr"`
+	UserId       int   `json:"user_id" xorm:"bigint unique(vote)"`                                                  // 投票的用户ID
+	ObjectType   int   `json:"object_type" xorm:"not null comment('0 content, 1 comment') TINYINT(1) unique(vote)"` // 投票的对象类型
+	ObjectId     int   `json:"object_id" xorm:"bigint unique(vote)"`                                                // 内容或评论的ID
+	ObjectUserId int   `json:"object_user_id" xorm:"bigint index"`                                                  // 对象所属的用户ID
+	Types        int   `json:"types" xorm:"not null comment('0 good, 1 bad') TINYINT(1)"`                           // 0点赞，1反对
+	CreateTime   int64 `json:"create_time"`
+}
+
+const (
+	VoteObjectContent = 0
+	VoteObjectComment = 1
+)
+
+// 对象对应的表名
+func voteTable(objectType int) (string, error) {
+	switch objectType {
+	case VoteObjectContent:
+		return "fafacms_content", nil
+	case VoteObjectComment:
+		return "fafacms_comment", nil
+	}
+	return "", errors.New("object type not right")
+}
+
+// 对象对应的计数字段
+func voteCol(types int) string {
+	if types == 1 {
+		return "bad"
+	}
+	return "good"
+}
+
+// 获取某用户对某对象的投票
+func (v *Vote) Get() (bool, error) {
+	if v.UserId == 0 || v.ObjectId == 0 {
+		return false, errors.New("where is empty")
+	}
+	return config.FafaRdb.Client.Where("user_id=?", v.UserId).And("object_type=?", v.ObjectType).And("object_id=?", v.ObjectId).Get(v)
+}
+
+// 投票，计数同时加一，唯一索引保证不会重复投票
+func (v *Vote) InsertOne() error {
+	if v.UserId == 0 || v.ObjectId == 0 {
+		return errors.New("where is empty")
+	}
+
+	table, err := voteTable(v.ObjectType)
+	if err != nil {
+		return err
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	v.CreateTime = time.Now().Unix()
+	_, err = session.InsertOne(v)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	col := voteCol(v.Types)
+	_, err = session.Exec(fmt.Sprintf("update %s SET %s=%s+1 where id = ?", table, col, col), v.ObjectId)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
+
+// 取消投票，计数同时减一
+func (v *Vote) Delete() error {
+	if v.Id == 0 || v.ObjectId == 0 {
+		return errors.New("where is empty")
+	}
+
+	table, err := voteTable(v.ObjectType)
+	if err != nil {
+		return err
+	}
+
+	session := config.FafaRdb.Client.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	num, err := session.Where("id=?", v.Id).Delete(new(Vote))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	// 已经被删除了，不需要再减
+	if num == 0 {
+		session.Rollback()
+		return nil
+	}
+
+	col := voteCol(v.Types)
+	_, err = session.Exec(fmt.Sprintf("update %s SET %s=%s-1 where id = ? and %s > 0", table, col, col, col), v.ObjectId)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		session.Rollback()
+		return err
+	}
+	return nil
+}
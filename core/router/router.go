@@ -1,8 +1,11 @@
 package router
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/hunterhug/fafacms/core/controllers"
+	"github.com/hunterhug/fafacms/core/util/limit"
+	"time"
 )
 
 type HttpHandle struct {
@@ -30,16 +33,38 @@ var (
 		"/u/node":  {"List User Nodes One", controllers.NodeInfo, GP, false}, // 查找某用户下的某一个节点
 
 		// review  2019/05/14
-		"/p":         {"List Peoples", controllers.Peoples, GP, false},         // 列出用户
-		"/u/info":    {"List User Info", controllers.UserInfo, GP, false},      // 获取某用户信息
-		"/u/count":   {"Count User Content", controllers.UserCount, GP, false}, // 统计某用户文章情况（某用户可留空）
-		"/u/content": {"List User Content", controllers.Contents, GP, false},   // 列出某用户下文章（某用户可留空）
-		"/c":         {"Get Content", controllers.Content, GP, false},          // 获取文章
+		"/p":           {"List Peoples", controllers.Peoples, GP, false},           // 列出用户
+		"/u/info":      {"List User Info", controllers.UserInfo, GP, false},        // 获取某用户信息
+		"/u/followers": {"List User Followers", controllers.Followers, GP, false},  // 列出某用户的粉丝
+		"/u/following": {"List User Following", controllers.Following, GP, false},  // 列出某用户关注的人
+		"/u/count":     {"Count User Content", controllers.UserCount, GP, false},   // 统计某用户文章情况（某用户可留空）
+		"/u/content":   {"List User Content", controllers.Contents, GP, false},     // 列出某用户下文章（某用户可留空）
+		"/c":           {"Get Content", controllers.Content, GP, false},            // 获取文章
+		"/comments":    {"List Content Comments", controllers.Comments, GP, false}, // 获取文章的评论
+		"/votes":       {"List Votes", controllers.Votes, GP, false},               // 获取文章或评论的点赞情况，登录时可以知道自己是否点过
+		"/tags":        {"List Tags", controllers.Tags, GP, false},                 // 标签云
+		"/tag":         {"List Tag Content", controllers.TagContents, GP, false},   // 列出某标签下的文章
+		"/search":      {"Search Content", controllers.Search, GP, false},          // 全文搜索已发布的文章
+
+		// 订阅，只包括已发布且没有密码的文章
+		"/feed.xml":   {"Site Rss", controllers.FeedRss, GET, false},       // 全站RSS
+		"/atom.xml":   {"Site Atom", controllers.FeedAtom, GET, false},     // 全站Atom
+		"/u/feed.xml": {"User Rss", controllers.UserFeedRss, GET, false},   // 某用户或某节点的RSS
+		"/u/atom.xml": {"User Atom", controllers.UserFeedAtom, GET, false}, // 某用户或某节点的Atom
+
+		// 搜索引擎
+		"/sitemap.xml": {"Sitemap", controllers.Sitemap, GET, false}, // 站点地图，记录多时为索引，可带type和page访问分页
+		"/robots.txt":  {"Robots", controllers.Robots, GET, false},   // 爬虫规则，可配置
 
 		// 前端的用户授权路由，不需要登录即可操作
 		// 已经Review 2019/5/12 chen
+		"/setup":           {"Setup Super Admin", controllers.Setup, POST, false}, // 首次运行时用启动日志中的令牌创建超级管理员
 		"/login":           {"User Login", controllers.Login, GP, false},
+		"/login/totp":      {"User Login Two Factor", controllers.LoginTotp, GP, false}, // 开启两步验证的用户，密码登录后再输入验证码
 		"/logout":          {"User Logout", controllers.Logout, GP, false},
+		"/oauth/providers": {"OAuth Providers", controllers.OAuthProviders, GET, false}, // 列出可用的第三方登录
+		"/oauth/url":       {"OAuth Url", controllers.OAuthUrl, GP, false},              // 获取第三方授权地址
+		"/oauth/callback":  {"OAuth Callback", controllers.OAuthCallback, POST, false},  // 第三方回调后登录，没有账号时自动注册
 		"/register":        {"User Register", controllers.RegisterUser, GP, false},
 		"/activate":        {"User Verify Email To Activate", controllers.ActivateUser, GP, false},               // 用户自己激活
 		"/activate/code":   {"User Resend Email Activate Code", controllers.ResendActivateCodeToUser, GP, false}, // 激活码过期重新获取
@@ -59,28 +84,55 @@ var (
 		"/group/list":          {"List Group", controllers.ListGroup, GP, true},
 		"/group/user/list":     {"Group List User", controllers.ListGroupUser, GP, true},         // 超级管理员列出组下的用户
 		"/group/resource/list": {"Group List Resource", controllers.ListGroupResource, GP, true}, // 超级管理员列出组下的资源
+		"/group/quota":         {"Group Quota Set", controllers.SetGroupQuota, POST, true},       // 设置组下用户的存储配额
 
 		// 用户操作
 		// 已经Review 2019/5/12 chen
-		"/user/list":         {"User List All", controllers.ListUser, GP, true},              // 超级管理员列出用户列表
-		"/user/create":       {"User Create", controllers.CreateUser, GP, true},              // 超级管理员创建用户，默认激活
-		"/user/assign":       {"User Assign Group", controllers.AssignGroupToUser, GP, true}, // 超级管理员给用户分配用户组
-		"/user/info":         {"User Info Self", controllers.TakeUser, GP, false},            // 获取自己的信息
-		"/user/update":       {"User Update Self", controllers.UpdateUser, GP, false},        // 更新自己的信息
-		"/user/admin/update": {"User Update Admin", controllers.UpdateUserAdmin, GP, true},   // 管理员修改其他用户信息
+		"/user/list":            {"User List All", controllers.ListUser, GP, true},                        // 超级管理员列出用户列表
+		"/user/create":          {"User Create", controllers.CreateUser, GP, true},                        // 超级管理员创建用户，默认激活
+		"/user/assign":          {"User Assign Group", controllers.AssignGroupToUser, GP, true},           // 超级管理员给用户分配用户组
+		"/user/permission":      {"User Permission", controllers.ListUserPermission, GP, true},            // 超级管理员查看用户的实际权限
+		"/user/quota":           {"User Quota Set", controllers.SetUserQuota, POST, true},                 // 超级管理员单独设置用户的存储配额
+		"/user/info":            {"User Info Self", controllers.TakeUser, GP, false},                      // 获取自己的信息
+		"/user/update":          {"User Update Self", controllers.UpdateUser, GP, false},                  // 更新自己的信息
+		"/user/admin/update":    {"User Update Admin", controllers.UpdateUserAdmin, GP, true},             // 管理员修改其他用户信息
+		"/user/sessions":        {"User Sessions", controllers.ListUserSessions, GP, false},               // 列出自己登录的设备
+		"/user/sessions/revoke": {"User Sessions Revoke", controllers.RevokeUserSessions, GP, false},      // 撤销自己登录的设备
+		"/user/totp/enroll":     {"User Totp Enroll", controllers.TotpEnroll, GP, false},                  // 生成两步验证的密钥
+		"/user/totp/enable":     {"User Totp Enable", controllers.TotpEnable, GP, false},                  // 验证后开启两步验证，返回恢复码
+		"/user/totp/disable":    {"User Totp Disable", controllers.TotpDisable, GP, false},                // 关闭两步验证，需要密码
+		"/user/totp/recovery":   {"User Totp Recovery", controllers.TotpRecovery, GP, false},              // 重新生成恢复码，需要密码
+		"/user/oauth/list":      {"User OAuth List", controllers.ListUserIdentity, GP, false},             // 列出自己绑定的第三方
+		"/user/oauth/bind":      {"User OAuth Bind", controllers.BindUserIdentity, GP, false},             // 绑定第三方，返回授权地址
+		"/user/oauth/unbind":    {"User OAuth Unbind", controllers.UnbindUserIdentity, POST, false},       // 解除绑定第三方
+		"/user/tokens":          {"User Access Token List", controllers.ListAccessToken, GP, false},       // 列出自己的个人访问令牌
+		"/user/tokens/create":   {"User Access Token Create", controllers.CreateAccessToken, POST, false}, // 创建令牌，可限定资源范围和过期时间，明文只返回一次
+		"/user/tokens/revoke":   {"User Access Token Revoke", controllers.RevokeAccessToken, POST, false}, // 撤销令牌
 
 		// 资源操作
 		// 已经Review 2019/5/12 chen
 		"/resource/list":   {"Resource List All", controllers.ListResource, GP, true},              // 列出资源
 		"/resource/assign": {"Resource Assign Group", controllers.AssignResourceToGroup, GP, true}, // 资源分配给组
 
+		// 审计日志
+		"/log/list": {"Log List", controllers.ListLog, GP, true}, // 超级管理员查看审计日志
+
 		// 文件操作
 		// 已经Review 2019/5/12 chen
-		"/file/upload":       {"File Upload", controllers.UploadFile, POST, false},
-		"/file/list":         {"File List Self", controllers.ListFile, POST, false},
-		"/file/admin/list":   {"File List All", controllers.ListFileAdmin, POST, true}, // 管理员查看所有文件
-		"/file/update":       {"File Update Self", controllers.UpdateFile, POST, false},
-		"/file/admin/update": {"File Update All", controllers.UpdateFileAdmin, POST, true}, // 管理员修改文件
+		"/file/upload":          {"File Upload", controllers.UploadFile, POST, false},
+		"/file/upload/init":     {"File Upload Init", controllers.UploadInit, POST, false},         // 开始分片上传
+		"/file/upload/part":     {"File Upload Part", controllers.UploadPart, POST, false},         // 上传分片，可以断点续传
+		"/file/upload/status":   {"File Upload Status", controllers.UploadStatus, POST, false},     // 查看已上传的分片
+		"/file/upload/complete": {"File Upload Complete", controllers.UploadComplete, POST, false}, // 合并分片
+		"/file/upload/abort":    {"File Upload Abort", controllers.UploadAbort, POST, false},       // 放弃分片上传
+		"/file/list":            {"File List Self", controllers.ListFile, POST, false},
+		"/file/admin/list":      {"File List All", controllers.ListFileAdmin, POST, true},       // 管理员查看所有文件
+		"/file/usage":           {"File Usage Self", controllers.FileUsage, GP, false},          // 自己的占用和配额，按类型和标签统计
+		"/file/admin/usage":     {"File Usage All", controllers.ListFileUsageAdmin, POST, true}, // 管理员查看占用最多的用户
+		"/file/update":          {"File Update Self", controllers.UpdateFile, POST, false},
+		"/file/admin/update":    {"File Update All", controllers.UpdateFileAdmin, POST, true}, // 管理员修改文件
+		"/file/delete":          {"File Delete Self", controllers.DeleteFile, POST, false},    // 删除文件，被引用的不能删
+		"/file/admin/delete":    {"File Delete All", controllers.DeleteFileAdmin, POST, true}, // 管理员删除文件
 
 		// 比较重要的, 节点和文章都应该支持拖曳，文章首页排序还是按照创建时间，但是后台使用排序字段
 		// 需要参考简书
@@ -127,16 +179,89 @@ var (
 		"/content/admin/list":         {"List Content All", controllers.ListContentAdmin, GP, true},                  // 管理员列出文章，什么类型都可以
 		"/content/history/list":       {"List Content History Self", controllers.ListContentHistory, GP, false},      // 列出文章的历史记录
 		"/content/history/admin/list": {"List Content History All", controllers.ListContentHistoryAdmin, GP, true},   // 管理员列出文章的历史纪录
+		"/content/search":             {"Search Content Self", controllers.SearchContent, GP, false},                 // 全文搜索自己的文章
+
+		// 评论操作
+		"/comment/create":     {"Create Comment Self", controllers.CreateComment, POST, false}, // 评论内容或者回复评论
+		"/comment/update":     {"Update Comment Self", controllers.UpdateComment, POST, false}, // 修改自己的评论
+		"/comment/delete":     {"Delete Comment Self", controllers.DeleteComment, POST, false}, // 删除评论，回复会一起删除
+		"/comment/take":       {"Take Comment Self", controllers.TakeComment, GP, false},
+		"/comment/list":       {"List Comment Self", controllers.ListComment, GP, false},
+		"/comment/admin/list": {"List Comment All", controllers.ListCommentAdmin, GP, true}, // 管理员列出所有评论
+
+		// 点赞操作，一个用户对同一内容或评论只能投一次
+		"/vote/create": {"Create Vote Self", controllers.CreateVote, POST, false}, // 点赞或反对
+		"/vote/delete": {"Delete Vote Self", controllers.DeleteVote, POST, false}, // 取消点赞或反对
+
+		// 关注用户
+		"/follow/create": {"Create Follow Self", controllers.CreateFollow, POST, false}, // 关注某用户
+		"/follow/delete": {"Delete Follow Self", controllers.DeleteFollow, POST, false}, // 取消关注某用户
+		"/follow/feed":   {"List Follow Content", controllers.Feed, GP, false},          // 列出关注的人发布的内容
+
+		// 站内信
+		"/message/list":       {"List Message Self", controllers.ListMessage, GP, false},          // 列出自己的站内信
+		"/message/read":       {"Read Message Self", controllers.ReadMessage, POST, false},        // 标记已读
+		"/message/read/all":   {"Read All Message Self", controllers.ReadAllMessage, POST, false}, // 全部标记已读
+		"/message/count":      {"Count Message Self", controllers.CountMessage, GP, false},        // 统计未读
+		"/message/admin/send": {"Send Message All", controllers.SendMessageAdmin, POST, true},     // 管理员群发站内信
+
+		// 评论审核，内容设置为需要审核时，评论需要所有者审核通过才会展示
+		"/comment/review/list":  {"List Comment Self Wait Review", controllers.ListReviewComment, GP, false},   // 列出自己内容下等待审核的评论
+		"/comment/review":       {"Review Comment Self", controllers.ReviewComment, POST, false},               // 批量通过或拒绝
+		"/comment/review/count": {"Count Comment Self Wait Review", controllers.CountReviewComment, GP, false}, // 每篇内容等待审核的评论数量
+	}
+
+	// 限流规则，key和路由一致，没有配置的路由不限
+	// 同一IP或同一账号在窗口时间内超过次数返回429
+	HomeLimitRouter = map[string]controllers.LimitRule{
+		"/setup":           {Ip: limit.Rule{Times: 10, Window: time.Minute}},
+		"/login":           {Ip: limit.Rule{Times: 30, Window: time.Minute}, Account: limit.Rule{Times: 10, Window: time.Minute}, AccountField: "user_name"}, // 密码错误太多次另有锁定
+		"/login/totp":      {Ip: limit.Rule{Times: 10, Window: time.Minute}},
+		"/oauth/callback":  {Ip: limit.Rule{Times: 30, Window: time.Minute}},
+		"/register":        {Ip: limit.Rule{Times: 10, Window: time.Hour}, Account: limit.Rule{Times: 3, Window: time.Hour}, AccountField: "email"},  // 会发邮件
+		"/activate/code":   {Ip: limit.Rule{Times: 10, Window: time.Hour}, Account: limit.Rule{Times: 3, Window: time.Hour}, AccountField: "email"},  // 会发邮件
+		"/password/forget": {Ip: limit.Rule{Times: 10, Window: time.Hour}, Account: limit.Rule{Times: 3, Window: time.Hour}, AccountField: "email"},  // 会发邮件
+		"/password/change": {Ip: limit.Rule{Times: 20, Window: time.Hour}, Account: limit.Rule{Times: 10, Window: time.Hour}, AccountField: "email"}, // 防止猜验证码
+	}
 
-		//
-		//"/comment/create": {controllers.CreateComment, POST},
-		//"/comment/update": {controllers.UpdateComment, POST},
-		//"/comment/delete": {controllers.DeleteComment, POST},
-		//"/comment/take":   {controllers.TakeComment, GP},
-		//"/comment/list":   {controllers.ListComment, GP},
+	// 账号为登录的用户
+	V1LimitRouter = map[string]controllers.LimitRule{
+		"/comment/create":   {Account: limit.Rule{Times: 20, Window: time.Minute}},
+		"/vote/create":      {Account: limit.Rule{Times: 60, Window: time.Minute}},
+		"/follow/create":    {Account: limit.Rule{Times: 30, Window: time.Minute}},
+		"/file/upload":      {Account: limit.Rule{Times: 30, Window: time.Minute}},
+		"/file/upload/init": {Account: limit.Rule{Times: 30, Window: time.Minute}},
 	}
 )
 
+// 合并限流规则，V1的加上前缀
+func LimitRules() map[string]controllers.LimitRule {
+	rules := make(map[string]controllers.LimitRule, len(HomeLimitRouter)+len(V1LimitRouter))
+	for url, rule := range HomeLimitRouter {
+		rules[url] = rule
+	}
+	for url, rule := range V1LimitRouter {
+		rules["/v1"+url] = rule
+	}
+	return rules
+}
+
+// 限流规则的key必须是存在的路由，写错了启动时报错，不能悄悄失效
+func CheckLimitRouter() error {
+	for url := range HomeLimitRouter {
+		if _, ok := HomeRouter[url]; !ok {
+			return fmt.Errorf("limit router %s not found", url)
+		}
+	}
+
+	for url := range V1LimitRouter {
+		if _, ok := V1Router[url]; !ok {
+			return fmt.Errorf("limit router /v1%s not found", url)
+		}
+	}
+	return nil
+}
+
 // home end.
 func SetRouter(router *gin.Engine) {
 	for url, app := range HomeRouter {
@@ -8,11 +8,13 @@ import (
 	"github.com/alexedwards/scs/stores/memstore"
 	"github.com/alexedwards/scs/stores/redisstore"
 	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/controllers"
 	"github.com/hunterhug/fafacms/core/model"
 	"github.com/hunterhug/fafacms/core/router"
-	"github.com/hunterhug/fafacms/core/util"
+	"github.com/hunterhug/fafacms/core/util/limit"
 	"github.com/hunterhug/fafacms/core/util/rdb"
 	"github.com/hunterhug/fafacms/core/util/session"
+	"github.com/hunterhug/fafacms/core/util/storage"
 	"io/ioutil"
 	"time"
 )
@@ -54,12 +56,62 @@ func InitSession(redisConf session.MyRedisConf) error {
 		return err
 	}
 	redisStore := redisstore.New(pool)
+	config.FafaSessionStore = redisStore
 	config.FafaSessionMgr = scs.NewManager(redisStore)
+	config.FafaLimiter = limit.New(limit.NewRedisStore(pool), "fafacms_limit:")
 	return nil
 }
 
 func InitMemorySession() {
-	config.FafaSessionMgr = scs.NewManager(memstore.New(time.Hour * 1))
+	config.FafaSessionStore = memstore.New(time.Hour * 1)
+	config.FafaSessionMgr = scs.NewManager(config.FafaSessionStore)
+	config.FafaLimiter = limit.New(limit.NewMemoryStore(), "")
+}
+
+// 登记配置了的存储后端，本地的总是登记，旧文件可能在本地
+func InitStorage(c *config.Config) error {
+	r := storage.NewRegistry()
+	r.Register(storage.TypeLocal, storage.NewLocal(map[string]string{
+		"storage":   c.DefaultConfig.StoragePath,
+		"storage_x": c.DefaultConfig.StoragePath + "_x",
+	}))
+
+	if c.OssConfig.Endpoint != "" && c.OssConfig.BucketName != "" {
+		o, err := storage.NewOss(c.OssConfig)
+		if err != nil {
+			return err
+		}
+		r.Register(storage.TypeOss, o)
+	}
+
+	if c.S3Config.Endpoint != "" {
+		s3, err := storage.NewS3(c.S3Config)
+		if err != nil {
+			return err
+		}
+		r.Register(storage.TypeS3, s3)
+	}
+
+	name := c.DefaultConfig.Storage
+	if name == "" {
+		name = "local"
+		if c.DefaultConfig.StorageOss {
+			name = "oss"
+		}
+	}
+
+	id, ok := storage.TypeNames[name]
+	if !ok {
+		return fmt.Errorf("storage %s not support", name)
+	}
+
+	err := r.SetDefault(id)
+	if err != nil {
+		return err
+	}
+
+	config.FafaStorage = r
+	return nil
 }
 
 func CreateTable(tables []interface{}) {
@@ -75,6 +127,13 @@ func CreateTable(tables []interface{}) {
 				fmt.Println(err.Error())
 				continue
 			}
+		} else {
+			// 表已经存在，新增的字段要同步进去
+			err = config.FafaRdb.Client.Sync2(table)
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
 		}
 
 		err = config.FafaRdb.Client.CreateIndexes(table)
@@ -88,26 +147,26 @@ func CreateTable(tables []interface{}) {
 			continue
 		}
 	}
-
-	InitResource()
 }
 
-func InitResource() {
+// 每次启动把V1路由同步到资源表，返回新登记和标记为失效的数量
+func InitResource() (added int, stale int, err error) {
+	rs := make([]model.Resource, 0, len(router.V1Router))
+	admins := make([]string, 0)
 	for url, handler := range router.V1Router {
-		if !handler.Admin {
-			continue
-		}
-		r := new(model.Resource)
-		r.Url = fmt.Sprintf("/v1%s", url)
-		r.UrlHash, _ = util.Sha256([]byte(url))
+		r := model.Resource{}
+		r.Url = "/v1" + url
 		r.Name = handler.Name
 		r.Describe = handler.Name
 		r.Admin = handler.Admin
-		r.CreateTime = time.Now().Unix()
-		err := r.InsertOne()
-		if err != nil {
-			fmt.Println(err.Error())
-		}
+		rs = append(rs, r)
 
+		if handler.Admin {
+			admins = append(admins, r.Url)
+		}
 	}
+
+	// 先设置，即使同步失败管理路由也不会放行
+	controllers.SetAdminRoutes(admins)
+	return model.SyncResource(rs)
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/hunterhug/fafacms/core/config"
+	"github.com/hunterhug/fafacms/core/controllers"
+	"github.com/hunterhug/fafacms/core/router"
 	"time"
 )
 
@@ -13,6 +16,12 @@ func Server() *gin.Engine {
 
 	r := gin.New()
 
+	// 上传的文件超过这个大小时先写到磁盘，不占用内存
+	r.MaxMultipartMemory = 8 << 20
+
+	// 请求头可以随便填，只有在反向代理后面才信任
+	r.ForwardedByClientIP = config.FafaConfig.DefaultConfig.TrustProxy
+
 	// LoggerWithFormatter middleware will write the logs to gin.DefaultWriter
 	// By default gin.DefaultWriter = os.Stdout
 	r.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
@@ -38,11 +47,14 @@ func Server() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOriginFunc:  func(origin string) bool { return true },
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// 按路由限流，规则在 router 中配置
+	r.Use(controllers.RateLimit(router.LimitRules()))
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(200, "pong")
 	})
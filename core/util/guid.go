@@ -2,7 +2,9 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/satori/go.uuid"
@@ -18,6 +20,16 @@ func GetGUID() (valueGUID string) {
 	return valueGUID
 }
 
+// 安全的随机串，n个字节转为十六进制
+func RandomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
 // sha256  256 bit防止碰撞
 func Sha256(raw []byte) (string, error) {
 	h := sha256.New()
@@ -36,3 +36,15 @@ func TestMd5(t *testing.T) {
 	d, _ := Sha256(raw)
 	fmt.Println(len(d))
 }
+
+func TestRandomHex(t *testing.T) {
+	a, err := RandomHex(16)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	b, _ := RandomHex(16)
+	if len(a) != 32 || a == b {
+		t.Fatalf("random wrong: %s %s", a, b)
+	}
+}
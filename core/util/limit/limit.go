@@ -0,0 +1,118 @@
+package limit
+
+import (
+	"fmt"
+	"time"
+)
+
+// 计数存储，内存或Redis
+type Store interface {
+	// 计数加一，key不存在时新建并在window后过期，返回当前计数和剩余时间
+	Incr(key string, window time.Duration) (int64, time.Duration, error)
+
+	// 设置一个标记，ttl后过期
+	Set(key string, ttl time.Duration) error
+
+	// 标记剩余时间，不存在返回0
+	TTL(key string) (time.Duration, error)
+
+	Delete(key string) error
+}
+
+// 固定窗口限流规则，Window时间内最多Times次，Times为0表示不限
+type Rule struct {
+	Times  int64
+	Window time.Duration
+}
+
+func (r Rule) Enable() bool {
+	return r.Times > 0 && r.Window > 0
+}
+
+// 限流器，key会加上前缀区分
+type Limiter struct {
+	Store  Store
+	Prefix string
+}
+
+func New(store Store, prefix string) *Limiter {
+	return &Limiter{Store: store, Prefix: prefix}
+}
+
+func (l *Limiter) key(kind, key string) string {
+	return fmt.Sprintf("%s%s:%s", l.Prefix, kind, key)
+}
+
+// 按规则计数，超过后返回false和需要等待的时间
+func (l *Limiter) Allow(key string, rule Rule) (bool, time.Duration, error) {
+	if !rule.Enable() {
+		return true, 0, nil
+	}
+
+	num, ttl, err := l.Store.Incr(l.key("rate", key), rule.Window)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if num > rule.Times {
+		return false, ttl, nil
+	}
+	return true, 0, nil
+}
+
+// 渐进锁定，失败Free次以内不锁，之后每多失败一次锁定时间翻倍，最多Max
+type Lockout struct {
+	Free   int64
+	Base   time.Duration
+	Max    time.Duration
+	Window time.Duration // 失败次数的统计窗口
+}
+
+// 锁定剩余时间，为0表示未锁定
+func (l *Limiter) Locked(key string) (time.Duration, error) {
+	return l.Store.TTL(l.key("lock", key))
+}
+
+// 记一次失败，返回这次失败后的锁定时间
+func (l *Limiter) Fail(key string, lock Lockout) (time.Duration, error) {
+	num, _, err := l.Store.Incr(l.key("fail", key), lock.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	d := lock.Duration(num)
+	if d == 0 {
+		return 0, nil
+	}
+
+	return d, l.Store.Set(l.key("lock", key), d)
+}
+
+// 成功后清空失败记录
+func (l *Limiter) Reset(key string) error {
+	err := l.Store.Delete(l.key("fail", key))
+	if err != nil {
+		return err
+	}
+	return l.Store.Delete(l.key("lock", key))
+}
+
+// 第num次失败后的锁定时间
+func (lock Lockout) Duration(num int64) time.Duration {
+	if num <= lock.Free {
+		return 0
+	}
+
+	d := lock.Base
+	for i := lock.Free + 1; i < num; i++ {
+		d = d * 2
+		if d >= lock.Max {
+			return lock.Max
+		}
+	}
+
+	if d > lock.Max {
+		return lock.Max
+	}
+	return d
+}
@@ -0,0 +1,126 @@
+package limit
+
+import (
+	"github.com/patrickmn/go-cache"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(NewMemoryStore(), "test:")
+	rule := Rule{Times: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Allow("127.0.0.1", rule)
+		if err != nil || !ok {
+			t.Fatalf("times %d should allow", i+1)
+		}
+	}
+
+	ok, wait, err := l.Allow("127.0.0.1", rule)
+	if err != nil || ok || wait <= 0 || wait > time.Minute {
+		t.Fatalf("should deny, wait %v", wait)
+	}
+
+	// 其他key不受影响
+	ok, _, _ = l.Allow("127.0.0.2", rule)
+	if !ok {
+		t.Fatalf("other key should allow")
+	}
+
+	// 不设置规则不限制
+	ok, _, _ = l.Allow("127.0.0.1", Rule{})
+	if !ok {
+		t.Fatalf("empty rule should allow")
+	}
+}
+
+func TestAllowWindow(t *testing.T) {
+	l := New(NewMemoryStore(), "test:")
+	rule := Rule{Times: 1, Window: 50 * time.Millisecond}
+
+	l.Allow("a", rule)
+	if ok, _, _ := l.Allow("a", rule); ok {
+		t.Fatalf("should deny")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _, _ := l.Allow("a", rule); !ok {
+		t.Fatalf("new window should allow")
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	lock := Lockout{Free: 5, Base: time.Minute, Max: time.Hour}
+	cases := map[int64]time.Duration{
+		1:   0,
+		5:   0,
+		6:   time.Minute,
+		7:   2 * time.Minute,
+		9:   8 * time.Minute,
+		12:  time.Hour,
+		100: time.Hour,
+	}
+
+	for num, want := range cases {
+		if got := lock.Duration(num); got != want {
+			t.Fatalf("fail %d want %v got %v", num, want, got)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	l := New(NewMemoryStore(), "test:")
+	lock := Lockout{Free: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		d, err := l.Fail("hunterhug", lock)
+		if err != nil || d != 0 {
+			t.Fatalf("fail %d should not lock", i+1)
+		}
+	}
+
+	d, err := l.Fail("hunterhug", lock)
+	if err != nil || d != time.Minute {
+		t.Fatalf("should lock a minute, got %v", d)
+	}
+
+	left, _ := l.Locked("hunterhug")
+	if left <= 0 || left > time.Minute {
+		t.Fatalf("should locked, left %v", left)
+	}
+
+	l.Reset("hunterhug")
+	left, _ = l.Locked("hunterhug")
+	if left != 0 {
+		t.Fatalf("should unlock after reset")
+	}
+
+	// 重置后重新计数
+	d, _ = l.Fail("hunterhug", lock)
+	if d != 0 {
+		t.Fatalf("should count again after reset")
+	}
+}
+
+func TestMemoryStoreIncrExpired(t *testing.T) {
+	s := NewMemoryStore()
+
+	// 剩余时间不大于0的不能变成永不过期
+	s.c.Set("k", int64(5), cache.NoExpiration)
+	num, ttl, err := s.Incr("k", time.Minute)
+	if err != nil || num != 1 || ttl != time.Minute {
+		t.Fatalf("got %d %v %v", num, ttl, err)
+	}
+
+	if _, expire, _ := s.c.GetWithExpiration("k"); expire.IsZero() {
+		t.Fatalf("counter should expire")
+	}
+
+	if err := s.Set("lock", 0); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := s.TTL("lock"); ttl != 0 {
+		t.Fatalf("zero ttl should not lock: %v", ttl)
+	}
+}
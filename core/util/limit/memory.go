@@ -0,0 +1,62 @@
+package limit
+
+import (
+	"github.com/patrickmn/go-cache"
+	"sync"
+	"time"
+)
+
+// 内存存储，单机时使用
+type MemoryStore struct {
+	c  *cache.Cache
+	mu sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{c: cache.New(time.Hour, 10*time.Minute)}
+}
+
+func (s *MemoryStore) Incr(key string, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 刚好过期时剩余时间不大于0，go-cache 会当成默认或永不过期，要当作不存在
+	v, expire, ok := s.c.GetWithExpiration(key)
+	ttl := time.Until(expire)
+	if !ok || ttl <= 0 {
+		s.c.Set(key, int64(1), window)
+		return 1, window, nil
+	}
+
+	num := v.(int64) + 1
+	s.c.Set(key, num, ttl)
+	return num, ttl, nil
+}
+
+func (s *MemoryStore) Set(key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		s.c.Delete(key)
+		return nil
+	}
+
+	s.c.Set(key, int64(1), ttl)
+	return nil
+}
+
+func (s *MemoryStore) TTL(key string) (time.Duration, error) {
+	_, expire, ok := s.c.GetWithExpiration(key)
+	if !ok {
+		return 0, nil
+	}
+
+	ttl := time.Until(expire)
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.c.Delete(key)
+	return nil
+}
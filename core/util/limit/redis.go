@@ -0,0 +1,68 @@
+package limit
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+// 计数加一，第一次时设置过期，返回计数和剩余毫秒
+var incrScript = redis.NewScript(1, `
+local num = redis.call("INCR", KEYS[1])
+if num == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {num, redis.call("PTTL", KEYS[1])}
+`)
+
+// Redis存储，多实例部署时共享计数
+type RedisStore struct {
+	pool *redis.Pool
+}
+
+func NewRedisStore(pool *redis.Pool) *RedisStore {
+	return &RedisStore{pool: pool}
+}
+
+func (s *RedisStore) Incr(key string, window time.Duration) (int64, time.Duration, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Int64s(incrScript.Do(conn, key, int64(window/time.Millisecond)))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return values[0], time.Duration(values[1]) * time.Millisecond, nil
+}
+
+func (s *RedisStore) Set(key string, ttl time.Duration) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", key, 1, "PX", int64(ttl/time.Millisecond))
+	return err
+}
+
+func (s *RedisStore) TTL(key string) (time.Duration, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	ms, err := redis.Int64(conn.Do("PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+
+	// -2 不存在，-1 没有过期时间
+	if ms < 0 {
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (s *RedisStore) Delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", key)
+	return err
+}
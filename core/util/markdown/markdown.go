@@ -0,0 +1,128 @@
+// markdown 转 HTML，生成目录和标题锚点，输出都经过白名单过滤
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/russross/blackfriday.v2"
+	"html"
+	"io"
+)
+
+const (
+	htmlFlags  = blackfriday.CommonHTMLFlags | blackfriday.Safelink | blackfriday.NofollowLinks | blackfriday.NoreferrerLinks
+	extensions = blackfriday.CommonExtensions | blackfriday.AutoHeadingIDs | blackfriday.Footnotes
+)
+
+// 渲染结果，都可以直接输出
+type Result struct {
+	Html string `json:"html"`
+	Toc  string `json:"toc"` // 目录，嵌套的<ul>，没有标题时为空
+}
+
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+// 接管标题的渲染，加上不重复的ID和锚点，并记下来生成目录
+type renderer struct {
+	*blackfriday.HTMLRenderer
+	ids      map[string]int
+	headings []heading
+}
+
+func headingText(node *blackfriday.Node) string {
+	var buf bytes.Buffer
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (n.Type == blackfriday.Text || n.Type == blackfriday.Code) {
+			buf.Write(n.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return buf.String()
+}
+
+func (r *renderer) uniqueId(id string) string {
+	if id == "" {
+		id = "section"
+	}
+
+	n, ok := r.ids[id]
+	r.ids[id] = n + 1
+	if !ok {
+		return id
+	}
+	return r.uniqueId(fmt.Sprintf("%s-%d", id, n))
+}
+
+func (r *renderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.Heading || node.IsTitleblock {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+
+	if !entering {
+		fmt.Fprintf(w, "</h%d>\n", node.Level)
+		return blackfriday.GoToNext
+	}
+
+	text := headingText(node)
+	id := node.HeadingID
+	if id == "" {
+		id = blackfriday.SanitizedAnchorName(text)
+	}
+	id = r.uniqueId(id)
+	r.headings = append(r.headings, heading{level: node.Level, id: id, text: text})
+
+	escaped := html.EscapeString(id)
+	fmt.Fprintf(w, "\n<h%d id=\"%s\"><a class=\"anchor\" href=\"#%s\"></a>", node.Level, escaped, escaped)
+	return blackfriday.GoToNext
+}
+
+// 按标题层级生成嵌套的目录
+func (r *renderer) toc() string {
+	if len(r.headings) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	levels := make([]int, 0)
+	for _, h := range r.headings {
+		switch {
+		case len(levels) == 0 || h.level > levels[len(levels)-1]:
+			buf.WriteString("<ul>")
+			levels = append(levels, h.level)
+		default:
+			for len(levels) > 1 && h.level < levels[len(levels)-1] {
+				buf.WriteString("</li></ul>")
+				levels = levels[:len(levels)-1]
+			}
+			buf.WriteString("</li>")
+		}
+		fmt.Fprintf(&buf, "<li><a href=\"#%s\">%s</a>", html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+	for range levels {
+		buf.WriteString("</li></ul>")
+	}
+	return buf.String()
+}
+
+// 渲染，带目录
+func Render(src string) Result {
+	r := &renderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{Flags: htmlFlags}),
+		ids:          make(map[string]int),
+	}
+
+	out := blackfriday.Run([]byte(src), blackfriday.WithRenderer(r), blackfriday.WithExtensions(extensions))
+	return Result{
+		Html: Sanitize(string(out)),
+		Toc:  r.toc(),
+	}
+}
+
+// 只转为 HTML，不需要目录
+func ToHTML(src string) string {
+	return Render(src).Html
+}
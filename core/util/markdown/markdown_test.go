@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	out := ToHTML("# Hello\n\n**fafa** <script>alert(1)</script>\n\n[x](javascript:alert(1)) [y](https://github.com)")
+
+	if !strings.Contains(out, `<h1 id="hello"><a class="anchor" href="#hello"></a>Hello</h1>`) || !strings.Contains(out, "<strong>fafa</strong>") {
+		t.Fatalf("markdown not render: %s", out)
+	}
+
+	if strings.Contains(out, "<script>") || strings.Contains(out, "javascript:") {
+		t.Fatalf("unsafe html: %s", out)
+	}
+
+	if !strings.Contains(out, `href="https://github.com"`) {
+		t.Fatalf("safe link lost: %s", out)
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := Render("# A\n\n## B\n\n### C\n\n## B\n\n# D\n\n```go\nfmt.Println(1)\n```\n")
+
+	for _, id := range []string{`id="a"`, `id="b"`, `id="c"`, `id="b-1"`, `id="d"`} {
+		if !strings.Contains(r.Html, id) {
+			t.Fatalf("heading id %s lost: %s", id, r.Html)
+		}
+	}
+
+	if !strings.Contains(r.Html, `<code class="language-go">`) {
+		t.Fatalf("code class lost: %s", r.Html)
+	}
+
+	want := `<ul><li><a href="#a">A</a><ul><li><a href="#b">B</a><ul><li><a href="#c">C</a></li></ul></li><li><a href="#b-1">B</a></li></ul></li><li><a href="#d">D</a></li></ul>`
+	if r.Toc != want {
+		t.Fatalf("got toc %s, want %s", r.Toc, want)
+	}
+
+	if Render("no heading").Toc != "" {
+		t.Fatalf("toc should be empty")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]string{
+		`<p onclick="x()">a</p>`:     `<p>a</p>`,
+		`<script>alert(1)</script>b`: `b`,
+		`<div><style>p{}</style><iframe src="x"><p>no</p></iframe>c</div>`: `<div>c</div>`,
+		`<a href="javascript:alert(1)">x</a>`:                              `<a>x</a>`,
+		`<a href=" JaVaScRiPt:alert(1)">x</a>`:                             `<a>x</a>`,
+		`<a href="//evil.com">x</a>`:                                       `<a>x</a>`,
+		`<a href="/u/a">x</a>`:                                             `<a href="/u/a">x</a>`,
+		`<a href="https://a.com?a=1&b=2">x</a>`:                            `<a href="https://a.com?a=1&amp;b=2" rel="nofollow noreferrer">x</a>`,
+		`<img src="data:image/png;base64,xx" alt="y">`:                     `<img alt="y">`,
+		`<span class="a&quot;b">x</span>`:                                  `<span>x</span>`,
+		`<blink>x</blink><!-- y -->`:                                       `x`,
+		`<svg><script>alert(1)</script></svg>&lt;z&gt;`:                    `&lt;z&gt;`,
+		`<p title='"><script>'>x</p>`:                                      `<p>x</p>`,
+	}
+
+	for in, want := range cases {
+		if got := Sanitize(in); got != want {
+			t.Errorf("Sanitize(%s) got %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package markdown
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// 允许的标签和属性，其他的标签只保留文字
+var allowTags = map[string][]string{
+	"a":          {"href", "title", "rel"},
+	"abbr":       {"title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"del":        nil,
+	"div":        nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title", "width", "height"},
+	"input":      {"type", "checked", "disabled"},
+	"kbd":        nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"span":       nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"align"},
+	"tfoot":      nil,
+	"th":         {"align"},
+	"thead":      nil,
+	"tr":         nil,
+	"ul":         nil,
+}
+
+// 所有允许的标签都可以带的属性
+var allowGlobalAttrs = []string{"id", "class"}
+
+// 连同里面的内容一起丢掉的标签
+var dropTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"frame":    true,
+	"frameset": true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+	"select":   true,
+	"svg":      true,
+	"math":     true,
+	"title":    true,
+	"head":     true,
+}
+
+func inList(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// id 和 class 只允许简单的字符
+func safeName(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == ' ' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// 链接只允许相对地址和 http(s)，href 还允许 mailto
+func safeUrl(s string, isHref bool) bool {
+	s = strings.TrimSpace(s)
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "":
+		// 防止 //evil.com 这种以及被浏览器忽略的控制字符
+		return !strings.ContainsAny(s, "\\\t\n\r") && !strings.HasPrefix(s, "//")
+	case "http", "https":
+		return true
+	case "mailto":
+		return isHref
+	}
+	return false
+}
+
+func cleanAttrs(tag string, attrs []html.Attribute) []html.Attribute {
+	back := make([]html.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" || !(inList(key, allowTags[tag]) || inList(key, allowGlobalAttrs)) {
+			continue
+		}
+
+		switch key {
+		case "id", "class":
+			if !safeName(a.Val) {
+				continue
+			}
+		case "href", "src":
+			if !safeUrl(a.Val, key == "href") {
+				continue
+			}
+		case "type":
+			if a.Val != "checkbox" {
+				continue
+			}
+		}
+		back = append(back, html.Attribute{Key: key, Val: a.Val})
+	}
+
+	// 外链不传递来源，也不给权重
+	if tag == "a" && !inList("rel", attrsKey(back)) {
+		for _, a := range back {
+			if a.Key == "href" && strings.Contains(a.Val, "://") {
+				back = append(back, html.Attribute{Key: "rel", Val: "nofollow noreferrer"})
+				break
+			}
+		}
+	}
+	return back
+}
+
+func attrsKey(attrs []html.Attribute) []string {
+	keys := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		keys = append(keys, a.Key)
+	}
+	return keys
+}
+
+func writeTag(buf *bytes.Buffer, t html.Token) {
+	buf.WriteByte('<')
+	if t.Type == html.EndTagToken {
+		buf.WriteByte('/')
+	}
+	buf.WriteString(t.Data)
+	for _, a := range t.Attr {
+		buf.WriteByte(' ')
+		buf.WriteString(a.Key)
+		buf.WriteString(`="`)
+		buf.WriteString(html.EscapeString(a.Val))
+		buf.WriteByte('"')
+	}
+	if t.Type == html.SelfClosingTagToken {
+		buf.WriteString(" /")
+	}
+	buf.WriteByte('>')
+}
+
+// 按白名单过滤 HTML，防止 XSS
+// 不认识的标签去掉只留文字，危险的标签连内容一起去掉，注释全部去掉
+func Sanitize(s string) string {
+	var buf bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(s))
+
+	// 正在丢弃的标签以及嵌套层数
+	dropping := ""
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return ""
+			}
+			break
+		}
+
+		t := z.Token()
+		if dropping != "" {
+			switch {
+			case tt == html.StartTagToken && t.Data == dropping:
+				depth++
+			case tt == html.EndTagToken && t.Data == dropping:
+				depth--
+				if depth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			buf.WriteString(html.EscapeString(t.Data))
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			if dropTags[t.Data] {
+				if tt == html.StartTagToken {
+					dropping = t.Data
+					depth = 1
+				}
+				continue
+			}
+
+			if _, ok := allowTags[t.Data]; !ok {
+				continue
+			}
+
+			if tt == html.EndTagToken {
+				t.Attr = nil
+			} else {
+				t.Attr = cleanAttrs(t.Data, t.Attr)
+			}
+			writeTag(&buf, t)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,287 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	TypeOAuth2 = ""       // 通用的 OAuth2，地址都要配置
+	TypeGithub = "github" // 地址有默认值
+	TypeOidc   = "oidc"   // 配置 Issuer 后自动发现地址
+)
+
+var (
+	githubAuthUrl     = "https://github.com/login/oauth/authorize"
+	githubTokenUrl    = "https://github.com/login/oauth/access_token"
+	githubUserInfoUrl = "https://api.github.com/user"
+	githubEmailUrl    = "https://api.github.com/user/emails"
+)
+
+// 第三方登录的配置
+type Provider struct {
+	Name         string   `json:"Name"` // 唯一标识，如 github，接口中使用
+	Type         string   `json:"Type"`
+	ClientId     string   `json:"ClientId"`
+	ClientSecret string   `json:"ClientSecret"`
+	RedirectUrl  string   `json:"RedirectUrl"` // 前端的回调页面，拿到 code 和 state 后调用 /oauth/callback
+	Issuer       string   `json:"Issuer"`
+	AuthUrl      string   `json:"AuthUrl"`
+	TokenUrl     string   `json:"TokenUrl"`
+	UserInfoUrl  string   `json:"UserInfoUrl"`
+	EmailUrl     string   `json:"EmailUrl"` // github 获取已验证邮箱的地址
+	Scopes       []string `json:"Scopes"`
+	TrustEmail   bool     `json:"TrustEmail"` // 通用 OAuth2 不返回 email_verified 时，是否认为邮箱已验证
+
+	lock       sync.Mutex
+	discovered bool
+}
+
+// 第三方返回的用户信息
+type UserInfo struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	NickName      string `json:"nick_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Avatar        string `json:"avatar"`
+}
+
+// 检查配置并补上默认值
+func (p *Provider) Init() error {
+	if p.Name == "" || p.ClientId == "" {
+		return errors.New("oauth provider name or client id empty")
+	}
+
+	switch p.Type {
+	case TypeGithub:
+		if p.AuthUrl == "" {
+			p.AuthUrl = githubAuthUrl
+		}
+		if p.TokenUrl == "" {
+			p.TokenUrl = githubTokenUrl
+		}
+		if p.UserInfoUrl == "" {
+			p.UserInfoUrl = githubUserInfoUrl
+		}
+		if p.EmailUrl == "" {
+			p.EmailUrl = githubEmailUrl
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"read:user", "user:email"}
+		}
+	case TypeOidc:
+		if p.Issuer == "" && (p.AuthUrl == "" || p.TokenUrl == "" || p.UserInfoUrl == "") {
+			return fmt.Errorf("oauth provider %s need issuer", p.Name)
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+	case TypeOAuth2:
+		if p.AuthUrl == "" || p.TokenUrl == "" || p.UserInfoUrl == "" {
+			return fmt.Errorf("oauth provider %s url empty", p.Name)
+		}
+	default:
+		return fmt.Errorf("oauth provider %s type %s not support", p.Name, p.Type)
+	}
+
+	return nil
+}
+
+// oidc 从 Issuer 发现地址，只成功一次
+func (p *Provider) discover(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.Type != TypeOidc || p.Issuer == "" || p.discovered {
+		return nil
+	}
+
+	doc := struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}{}
+
+	err := getJSON(ctx, http.DefaultClient, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &doc)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return fmt.Errorf("oidc issuer not match: %s", doc.Issuer)
+	}
+
+	if p.AuthUrl == "" {
+		p.AuthUrl = doc.AuthorizationEndpoint
+	}
+	if p.TokenUrl == "" {
+		p.TokenUrl = doc.TokenEndpoint
+	}
+	if p.UserInfoUrl == "" {
+		p.UserInfoUrl = doc.UserinfoEndpoint
+	}
+
+	if p.AuthUrl == "" || p.TokenUrl == "" || p.UserInfoUrl == "" {
+		return fmt.Errorf("oidc discovery of %s miss endpoint", p.Issuer)
+	}
+
+	p.discovered = true
+	return nil
+}
+
+func (p *Provider) config(ctx context.Context) (*oauth2.Config, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.ClientId,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectUrl,
+		Scopes:       p.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.AuthUrl,
+			TokenURL: p.TokenUrl,
+		},
+	}, nil
+}
+
+// 跳转到第三方授权的地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state string) (string, error) {
+	conf, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state), nil
+}
+
+// 用授权码换令牌，再获取用户信息
+func (p *Provider) Exchange(ctx context.Context, code string) (*UserInfo, error) {
+	conf, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	client := conf.Client(ctx, token)
+	claims := make(map[string]interface{})
+	err = getJSON(ctx, client, p.UserInfoUrl, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	info := parseClaims(claims)
+	if info.Id == "" {
+		return nil, errors.New("oauth user id empty")
+	}
+
+	switch p.Type {
+	case TypeGithub:
+		// github 返回的邮箱不一定验证过，要另外获取
+		info.Email, info.EmailVerified, err = githubEmail(ctx, client, p.EmailUrl)
+		if err != nil {
+			return nil, err
+		}
+	case TypeOAuth2:
+		if _, ok := claims["email_verified"]; !ok {
+			info.EmailVerified = p.TrustEmail && info.Email != ""
+		}
+	}
+
+	return info, nil
+}
+
+// 兼容 oidc 标准和常见的 OAuth2 字段
+func parseClaims(claims map[string]interface{}) *UserInfo {
+	info := new(UserInfo)
+	info.Id = claimString(claims, "sub", "id")
+	info.Name = claimString(claims, "preferred_username", "login", "username")
+	info.NickName = claimString(claims, "name", "nickname")
+	info.Email = claimString(claims, "email")
+	info.Avatar = claimString(claims, "picture", "avatar_url")
+
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		info.EmailVerified = v
+	case string:
+		info.EmailVerified = v == "true"
+	}
+	return info
+}
+
+func claimString(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := claims[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case json.Number:
+			return v.String()
+		}
+	}
+	return ""
+}
+
+// github 的主邮箱，没有验证过的也返回，由调用方决定
+func githubEmail(ctx context.Context, client *http.Client, url string) (string, bool, error) {
+	emails := make([]struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}, 0)
+
+	err := getJSON(ctx, client, url, &emails)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, v := range emails {
+		if v.Primary {
+			return v.Email, v.Verified, nil
+		}
+	}
+	return "", false, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("get %s status %d: %s", url, resp.StatusCode, string(raw))
+	}
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	return d.Decode(v)
+}
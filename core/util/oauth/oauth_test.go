@@ -0,0 +1,145 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 本地模拟的第三方，code 为 good 时才发令牌
+func mockProvider(t *testing.T, userInfo string) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer":"%s","authorization_endpoint":"%s/auth","token_endpoint":"%s/token","userinfo_endpoint":"%s/userinfo"}`,
+			server.URL, server.URL, server.URL, server.URL)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good" {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"mock_token","token_type":"bearer"}`)
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mock_token" {
+			w.WriteHeader(401)
+			return
+		}
+		fmt.Fprint(w, userInfo)
+	})
+
+	mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"email":"other@example.com","primary":false,"verified":true},{"email":"hunter@example.com","primary":true,"verified":true}]`)
+	})
+
+	return server
+}
+
+func TestOidc(t *testing.T) {
+	server := mockProvider(t, `{"sub":"abc123","preferred_username":"hunter","name":"Hunter","email":"hunter@example.com","email_verified":true}`)
+	defer server.Close()
+
+	p := &Provider{Name: "mock", Type: TypeOidc, ClientId: "id", ClientSecret: "secret", Issuer: server.URL, RedirectUrl: "http://127.0.0.1/callback"}
+	if err := p.Init(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	raw, err := p.AuthCodeURL(context.Background(), "state1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	u, _ := url.Parse(raw)
+	if !strings.HasPrefix(raw, server.URL+"/auth") || u.Query().Get("state") != "state1" || u.Query().Get("scope") != "openid email profile" {
+		t.Fatalf("auth url wrong: %s", raw)
+	}
+
+	info, err := p.Exchange(context.Background(), "good")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Id != "abc123" || info.Name != "hunter" || info.NickName != "Hunter" || info.Email != "hunter@example.com" || !info.EmailVerified {
+		t.Fatalf("user info wrong: %#v", info)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad"); err == nil {
+		t.Fatalf("bad code should fail")
+	}
+}
+
+func TestGithub(t *testing.T) {
+	server := mockProvider(t, `{"id":12345678901,"login":"hunterhug","name":"Hunter","email":"","avatar_url":"http://a/b.png"}`)
+	defer server.Close()
+
+	p := &Provider{Name: "github", Type: TypeGithub, ClientId: "id", ClientSecret: "secret",
+		AuthUrl: server.URL + "/auth", TokenUrl: server.URL + "/token", UserInfoUrl: server.URL + "/userinfo", EmailUrl: server.URL + "/emails"}
+	if err := p.Init(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	info, err := p.Exchange(context.Background(), "good")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 大的数字id不能丢精度
+	if info.Id != "12345678901" || info.Name != "hunterhug" || info.Email != "hunter@example.com" || !info.EmailVerified || info.Avatar != "http://a/b.png" {
+		t.Fatalf("user info wrong: %#v", info)
+	}
+}
+
+func TestOAuth2TrustEmail(t *testing.T) {
+	server := mockProvider(t, `{"id":"7","username":"hug","email":"hug@example.com"}`)
+	defer server.Close()
+
+	p := &Provider{Name: "mock", ClientId: "id", AuthUrl: server.URL + "/auth", TokenUrl: server.URL + "/token", UserInfoUrl: server.URL + "/userinfo"}
+	if err := p.Init(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	info, err := p.Exchange(context.Background(), "good")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Id != "7" || info.Name != "hug" || info.EmailVerified {
+		t.Fatalf("user info wrong: %#v", info)
+	}
+
+	p.TrustEmail = true
+	info, _ = p.Exchange(context.Background(), "good")
+	if !info.EmailVerified {
+		t.Fatalf("email should be trusted")
+	}
+}
+
+func TestInit(t *testing.T) {
+	if err := (&Provider{Name: "a", ClientId: "b"}).Init(); err == nil {
+		t.Fatalf("oauth2 without url should fail")
+	}
+
+	if err := (&Provider{Name: "a", ClientId: "b", Type: TypeOidc}).Init(); err == nil {
+		t.Fatalf("oidc without issuer should fail")
+	}
+
+	if err := (&Provider{Name: "a", ClientId: "b", Type: "x"}).Init(); err == nil {
+		t.Fatalf("unknown type should fail")
+	}
+
+	p := &Provider{Name: "github", ClientId: "b", Type: TypeGithub}
+	if err := p.Init(); err != nil || p.AuthUrl != githubAuthUrl || len(p.Scopes) != 2 {
+		t.Fatalf("github default wrong")
+	}
+}
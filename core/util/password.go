@@ -0,0 +1,61 @@
+package util
+
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+// 密码哈希的强度，越大越慢
+var PasswordCost = bcrypt.DefaultCost
+
+// 生成密码的哈希，不可逆，每次结果都不一样
+func HashPassword(raw string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(raw), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// 是否已经是哈希过的密码，以前的用户密码是明文保存的
+func IsPasswordHashed(password string) bool {
+	return len(password) == 60 && (strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$"))
+}
+
+// 校验密码，兼容明文保存的旧密码
+func CheckPassword(password string, raw string) bool {
+	if password == "" {
+		return false
+	}
+
+	if IsPasswordHashed(password) {
+		return bcrypt.CompareHashAndPassword([]byte(password), []byte(raw)) == nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(password), []byte(raw)) == 1
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash []byte
+)
+
+// 用户不存在时也比较一次，响应时间不会暴露用户名是否存在
+func CheckDummyPassword(raw string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("fafacms dummy password"), PasswordCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(raw))
+}
+
+// 密码需要重新哈希：明文或者强度不够
+func PasswordNeedRehash(password string) bool {
+	if !IsPasswordHashed(password) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(password))
+	return err != nil || cost < PasswordCost
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	PasswordCost = bcrypt.MinCost
+	defer func() {
+		PasswordCost = bcrypt.DefaultCost
+	}()
+
+	hashed, err := HashPassword("123456")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !IsPasswordHashed(hashed) || PasswordNeedRehash(hashed) {
+		t.Fatalf("hash wrong: %s", hashed)
+	}
+
+	if !CheckPassword(hashed, "123456") || CheckPassword(hashed, "1234567") {
+		t.Fatalf("check hash wrong")
+	}
+
+	// 旧的明文密码
+	if !CheckPassword("123456", "123456") || CheckPassword("123456", "1234567") || !PasswordNeedRehash("123456") {
+		t.Fatalf("check plain wrong")
+	}
+
+	if CheckPassword("", "") {
+		t.Fatalf("empty password should not pass")
+	}
+
+	PasswordCost = bcrypt.MinCost + 1
+	if !PasswordNeedRehash(hashed) {
+		t.Fatalf("weak hash should rehash")
+	}
+}
@@ -0,0 +1,305 @@
+// 上传图片的处理：校验解码，去掉 EXIF 等元数据，按拍摄方向摆正，生成缩略图
+package picture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/hunterhug/go_image/graphics"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// 缩略图的质量
+const JpegQuality = 85
+
+var (
+	ErrTooLarge  = errors.New("image too large")
+	ErrSize      = errors.New("image size wrong")
+	ErrTruncated = errors.New("image truncated")
+)
+
+// 先只读头部拿到尺寸，防止很小的文件解压出超大的图片，再完整解码一遍确认图片没坏
+func Decode(raw []byte, maxPixels int64) (image.Image, string, error) {
+	conf, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if conf.Width <= 0 || conf.Height <= 0 {
+		return nil, format, ErrSize
+	}
+
+	if maxPixels > 0 && int64(conf.Width)*int64(conf.Height) > maxPixels {
+		return nil, format, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, format, err
+	}
+	return img, format, nil
+}
+
+// 去掉元数据，不重新编码，图像数据原样保留
+func StripMeta(raw []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJpeg(raw)
+	case "png":
+		return stripPng(raw)
+	}
+	return raw, nil
+}
+
+// APP1 是 EXIF 和 XMP，APP13 是 IPTC，COM 是注释，其他的如色彩配置要留着
+var jpegDrop = map[byte]bool{0xE1: true, 0xED: true, 0xFE: true}
+
+func stripJpeg(raw []byte) ([]byte, error) {
+	if len(raw) < 2 || raw[0] != 0xFF || raw[1] != 0xD8 {
+		return nil, fmt.Errorf("not jpeg")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(raw)))
+	out.Write(raw[:2])
+	i := 2
+	for {
+		if i+2 > len(raw) || raw[i] != 0xFF {
+			return nil, ErrTruncated
+		}
+
+		marker := raw[i+1]
+		switch {
+		case marker == 0xFF:
+			// 填充字节
+			i++
+			continue
+		case marker == 0xDA:
+			// 到了图像数据，后面的原样保留
+			out.Write(raw[i:])
+			return out.Bytes(), nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// 没有长度的标记
+			out.Write(raw[i : i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(raw) {
+			return nil, ErrTruncated
+		}
+
+		n := int(binary.BigEndian.Uint16(raw[i+2:]))
+		if n < 2 || i+2+n > len(raw) {
+			return nil, ErrTruncated
+		}
+
+		if !jpegDrop[marker] {
+			out.Write(raw[i : i+2+n])
+		}
+		i += 2 + n
+	}
+}
+
+var pngDrop = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPng(raw []byte) ([]byte, error) {
+	if len(raw) < 8 || string(raw[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil, fmt.Errorf("not png")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(raw)))
+	out.Write(raw[:8])
+	i := 8
+	for {
+		// 长度，类型，数据，校验
+		if i+12 > len(raw) {
+			return nil, ErrTruncated
+		}
+
+		n := int(binary.BigEndian.Uint32(raw[i:]))
+		end := i + 12 + n
+		if end > len(raw) || end < i {
+			return nil, ErrTruncated
+		}
+
+		kind := string(raw[i+4 : i+8])
+		if !pngDrop[kind] {
+			out.Write(raw[i:end])
+		}
+
+		i = end
+		if kind == "IEND" {
+			return out.Bytes(), nil
+		}
+	}
+}
+
+// JPEG 中 EXIF 记录的拍摄方向，1到8，没有记录为1
+func Orientation(raw []byte) int {
+	if len(raw) < 2 || raw[0] != 0xFF || raw[1] != 0xD8 {
+		return 1
+	}
+
+	i := 2
+	for i+4 <= len(raw) && raw[i] == 0xFF {
+		marker := raw[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		n := int(binary.BigEndian.Uint16(raw[i+2:]))
+		if n < 2 || i+2+n > len(raw) {
+			break
+		}
+
+		seg := raw[i+4 : i+2+n]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + n
+	}
+	return 1
+}
+
+// 只看第一个 IFD 里的 0x0112
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	num := int(order.Uint16(tiff[offset:]))
+	for k := 0; k < num; k++ {
+		entry := offset + 2 + k*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// 转成从0开始的 RGBA，并按拍摄方向摆正，后面缩放都用这个
+func Upright(img image.Image, orientation int) *image.RGBA {
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 转180度
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿左上到右下的对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针转90度
+				dx, dy = h-1-y, x
+			case 7: // 沿右上到左下的对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针转90度
+				dx, dy = y, w-1-x
+			}
+			s := src.PixOffset(x, y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):], src.Pix[s:s+4])
+		}
+	}
+	return dst
+}
+
+// 生成缩略图，高为0时按宽等比例缩放，否则居中裁剪成固定尺寸，比原图小的不放大
+func Resize(img image.Image, width, height int) (image.Image, error) {
+	b := img.Bounds()
+	if width <= 0 {
+		return nil, ErrSize
+	}
+
+	if height <= 0 {
+		if width >= b.Dx() {
+			return img, nil
+		}
+
+		height = b.Dy() * width / b.Dx()
+		if height < 1 {
+			height = 1
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		return dst, graphics.Scale(dst, img)
+	}
+
+	if width >= b.Dx() && height >= b.Dy() {
+		return img, nil
+	}
+
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+	if height > b.Dy() {
+		height = b.Dy()
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	return dst, graphics.Thumbnail(dst, img)
+}
+
+// 按格式编码，webp 为无损压缩
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: JpegQuality})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	case "webp":
+		return nativewebp.Encode(w, img, nil)
+	}
+	return fmt.Errorf("format %s not support", format)
+}
@@ -0,0 +1,95 @@
+package picture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// 在 SOI 后面插入一个只有方向的 EXIF 段
+func withExif(raw []byte, orientation byte) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, 0, 0, 0, 0, 0, 0}
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	n := len(seg) + 2
+
+	out := append([]byte{}, raw[:2]...)
+	out = append(out, 0xFF, 0xE1, byte(n>>8), byte(n))
+	out = append(out, seg...)
+	return append(out, raw[2:]...)
+}
+
+func TestPipeline(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := withExif(buf.Bytes(), 6)
+
+	if Orientation(raw) != 6 {
+		t.Fatalf("orientation wrong: %d", Orientation(raw))
+	}
+
+	_, _, err = Decode(raw, 100)
+	if err != ErrTooLarge {
+		t.Fatalf("should too large: %v", err)
+	}
+
+	img, format, err := Decode(raw, 0)
+	if err != nil || format != "jpeg" {
+		t.Fatalf("decode err: %v %s", err, format)
+	}
+
+	clean, err := StripMeta(raw, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(clean, buf.Bytes()) || Orientation(clean) != 1 {
+		t.Fatalf("exif not strip")
+	}
+
+	_, err = StripMeta(raw[:30], format)
+	if err != ErrTruncated {
+		t.Fatalf("should truncated: %v", err)
+	}
+
+	up := Upright(img, 6)
+	if up.Bounds().Dx() != 20 || up.Bounds().Dy() != 40 {
+		t.Fatalf("upright size wrong: %v", up.Bounds())
+	}
+
+	// 左上角转到了右上角
+	if r, _, _, _ := up.At(18, 2).RGBA(); r>>8 < 200 {
+		t.Fatalf("upright pixel wrong")
+	}
+
+	small, err := Resize(up, 10, 0)
+	if err != nil || small.Bounds().Dx() != 10 || small.Bounds().Dy() != 20 {
+		t.Fatalf("resize wrong: %v %v", err, small.Bounds())
+	}
+
+	crop, err := Resize(up, 10, 10)
+	if err != nil || crop.Bounds().Dx() != 10 || crop.Bounds().Dy() != 10 {
+		t.Fatalf("crop wrong: %v %v", err, crop.Bounds())
+	}
+
+	same, _ := Resize(up, 100, 0)
+	if same != image.Image(up) {
+		t.Fatalf("should not enlarge")
+	}
+
+	out := new(bytes.Buffer)
+	err = Encode(out, small, "webp")
+	if err != nil || !bytes.HasPrefix(out.Bytes(), []byte("RIFF")) || string(out.Bytes()[8:12]) != "WEBP" {
+		t.Fatalf("webp wrong: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+const RedactMask = "***"
+
+// 把JSON中敏感字段的值替换掉，字段名不区分大小写，任意层级都会处理
+// 不是JSON的原样返回
+func RedactJSON(raw []byte, keys map[string]bool) []byte {
+	if len(raw) == 0 || len(keys) == 0 {
+		return raw
+	}
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return raw
+	}
+
+	if !redact(v, keys) {
+		return raw
+	}
+
+	back, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return back
+}
+
+// 返回是否有字段被替换
+func redact(v interface{}, keys map[string]bool) bool {
+	changed := false
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, value := range vv {
+			if keys[strings.ToLower(k)] {
+				// 空值不替换，方便看出有没有传
+				if value != nil && value != "" {
+					vv[k] = RedactMask
+					changed = true
+				}
+				continue
+			}
+			if redact(value, keys) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range vv {
+			if redact(value, keys) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,23 @@
+package util
+
+import "testing"
+
+func TestRedactJSON(t *testing.T) {
+	keys := map[string]bool{"password": true, "code": true}
+
+	raw := []byte(`{"name":"fafa","Password":"123456","code":"","data":[{"code":"778899","id":12345678901234567890}]}`)
+	back := string(RedactJSON(raw, keys))
+	if back != `{"Password":"***","code":"","data":[{"code":"***","id":12345678901234567890}],"name":"fafa"}` {
+		t.Fatalf("redact wrong: %s", back)
+	}
+
+	raw = []byte(`{"name":"fafa"}`)
+	if string(RedactJSON(raw, keys)) != string(raw) {
+		t.Fatalf("nothing to redact should keep raw")
+	}
+
+	raw = []byte(`not json`)
+	if string(RedactJSON(raw, keys)) != string(raw) {
+		t.Fatalf("not json should keep raw")
+	}
+}
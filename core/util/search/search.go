@@ -0,0 +1,409 @@
+// 进程内的全文搜索，倒排索引 + BM25 排序
+// 中文按二元切分，文档另外按单字索引，英文数字按单词切分，不依赖外部搜索服务
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// BM25 参数
+	k1 = 1.2
+	b  = 0.75
+
+	// 标题里的词权重更高
+	titleWeight = 3
+
+	// 摘要前后各取多少个字
+	snippetRadius = 60
+)
+
+// 被索引的文档
+type Doc struct {
+	Id          int
+	UserId      int
+	NodeId      int
+	Status      int  // 内容状态，0正常
+	Locked      bool // 有密码的内容不出现在公开搜索中
+	Title       string
+	Describe    string
+	CreateTime  int64
+	PublishTime int64
+}
+
+// 查询条件
+type Query struct {
+	Keyword         string
+	Public          bool // 只搜索公开的内容
+	UserId          int
+	NodeId          int
+	Status          int // -1表示不限制
+	CreateTimeBegin int64
+	CreateTimeEnd   int64
+	Offset          int
+	Limit           int
+}
+
+// 搜索结果，标题和摘要已经转义并用<em>高亮
+type Hit struct {
+	Id      int
+	Score   float64
+	Title   string
+	Snippet string
+}
+
+type entry struct {
+	doc    Doc
+	length float64
+	terms  map[string]int
+}
+
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[int]*entry
+	postings map[string]map[int]int
+	totalLen float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[int]*entry),
+		postings: make(map[string]map[int]int),
+	}
+}
+
+// 文档数量
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// 加入或替换文档
+func (idx *Index) Put(doc Doc) {
+	terms := make(map[string]int)
+	length := 0
+	for _, t := range IndexTokens(doc.Title) {
+		terms[t] += titleWeight
+		length += titleWeight
+	}
+	for _, t := range IndexTokens(doc.Describe) {
+		terms[t]++
+		length++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.Id)
+
+	e := &entry{doc: doc, length: float64(length), terms: terms}
+	idx.docs[doc.Id] = e
+	idx.totalLen += e.length
+	for t, tf := range terms {
+		p, ok := idx.postings[t]
+		if !ok {
+			p = make(map[int]int)
+			idx.postings[t] = p
+		}
+		p[doc.Id] = tf
+	}
+}
+
+// 移除文档
+func (idx *Index) Remove(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id int) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for t := range e.terms {
+		p := idx.postings[t]
+		delete(p, id)
+		if len(p) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+	idx.totalLen -= e.length
+	delete(idx.docs, id)
+}
+
+func (q *Query) match(doc *Doc) bool {
+	if q.Public && (doc.Status != 0 || doc.Locked) {
+		return false
+	}
+	if q.UserId != 0 && doc.UserId != q.UserId {
+		return false
+	}
+	if q.NodeId != 0 && doc.NodeId != q.NodeId {
+		return false
+	}
+	if q.Status != -1 && doc.Status != q.Status {
+		return false
+	}
+	if q.CreateTimeBegin > 0 && doc.CreateTime < q.CreateTimeBegin {
+		return false
+	}
+	if q.CreateTimeEnd > 0 && doc.CreateTime >= q.CreateTimeEnd {
+		return false
+	}
+	return true
+}
+
+// 搜索，所有关键词都要命中，返回当页结果和命中总数
+func (idx *Index) Search(q Query) ([]Hit, int) {
+	terms := unique(Tokenize(q.Keyword))
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// 从最短的倒排表开始找
+	lists := make([]map[int]int, 0, len(terms))
+	for _, t := range terms {
+		p, ok := idx.postings[t]
+		if !ok {
+			return []Hit{}, 0
+		}
+		lists = append(lists, p)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	n := float64(len(idx.docs))
+	avg := idx.totalLen / n
+	scored := make([]Hit, 0)
+	for id := range lists[0] {
+		e := idx.docs[id]
+		if !q.match(&e.doc) {
+			continue
+		}
+
+		score := 0.0
+		hitAll := true
+		for _, p := range lists {
+			tf, ok := p[id]
+			if !ok {
+				hitAll = false
+				break
+			}
+			df := float64(len(p))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			ftf := float64(tf)
+			score += idf * ftf * (k1 + 1) / (ftf + k1*(1-b+b*e.length/avg))
+		}
+
+		if hitAll {
+			scored = append(scored, Hit{Id: id, Score: score})
+		}
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score == scored[j].Score {
+			return scored[i].Id > scored[j].Id
+		}
+		return scored[i].Score > scored[j].Score
+	})
+
+	total := len(scored)
+	if q.Offset >= total {
+		return []Hit{}, total
+	}
+	end := total
+	if q.Limit > 0 && q.Offset+q.Limit < total {
+		end = q.Offset + q.Limit
+	}
+
+	words := Words(q.Keyword)
+	back := scored[q.Offset:end]
+	for k := range back {
+		doc := idx.docs[back[k].Id].doc
+		back[k].Title = Highlight(doc.Title, words)
+		back[k].Snippet = Snippet(doc.Describe, words, snippetRadius)
+	}
+	return back, total
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// 切出词段，中文连续的字为一段，英文数字连续的为一段，都转为小写
+func Words(s string) []string {
+	words := make([]string, 0)
+	current := make([]rune, 0)
+	currentCJK := false
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = current[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case isCJK(r):
+			if !currentCJK {
+				flush()
+			}
+			currentCJK = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if currentCJK {
+				flush()
+			}
+			currentCJK = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// 分词，中文段按二元切分，单个字保留
+func Tokenize(s string) []string {
+	tokens := make([]string, 0)
+	for _, w := range Words(s) {
+		rs := []rune(w)
+		if !isCJK(rs[0]) || len(rs) == 1 {
+			tokens = append(tokens, w)
+			continue
+		}
+
+		for i := 0; i+1 < len(rs); i++ {
+			tokens = append(tokens, string(rs[i:i+2]))
+		}
+	}
+	return tokens
+}
+
+// 文档的分词，中文除了二元再加上单字，只搜一个字时才能命中
+func IndexTokens(s string) []string {
+	tokens := Tokenize(s)
+	for _, w := range Words(s) {
+		rs := []rune(w)
+		if !isCJK(rs[0]) || len(rs) == 1 {
+			continue
+		}
+
+		for _, r := range rs {
+			tokens = append(tokens, string(r))
+		}
+	}
+	return tokens
+}
+
+func unique(ss []string) []string {
+	back := make([]string, 0, len(ss))
+	exist := make(map[string]bool)
+	for _, s := range ss {
+		if !exist[s] {
+			exist[s] = true
+			back = append(back, s)
+		}
+	}
+	return back
+}
+
+// 找出所有命中的区间，区间按rune下标，已经合并
+func matchRanges(lower []rune, words []string) [][2]int {
+	marks := make([]bool, len(lower)+1)
+	for _, w := range words {
+		wr := []rune(w)
+		if len(wr) == 0 {
+			continue
+		}
+		for i := 0; i+len(wr) <= len(lower); i++ {
+			if string(lower[i:i+len(wr)]) == w {
+				for j := i; j < i+len(wr); j++ {
+					marks[j] = true
+				}
+			}
+		}
+	}
+
+	ranges := make([][2]int, 0)
+	for i := 0; i < len(lower); i++ {
+		if marks[i] {
+			j := i
+			for j < len(lower) && marks[j] {
+				j++
+			}
+			ranges = append(ranges, [2]int{i, j})
+			i = j
+		}
+	}
+	return ranges
+}
+
+// 转义文本，并用<em>标出命中的词
+func highlightRunes(rs []rune, lower []rune, words []string) string {
+	ranges := matchRanges(lower, words)
+	var sb strings.Builder
+	last := 0
+	for _, r := range ranges {
+		sb.WriteString(html.EscapeString(string(rs[last:r[0]])))
+		sb.WriteString("<em>")
+		sb.WriteString(html.EscapeString(string(rs[r[0]:r[1]])))
+		sb.WriteString("</em>")
+		last = r[1]
+	}
+	sb.WriteString(html.EscapeString(string(rs[last:])))
+	return sb.String()
+}
+
+// 高亮整段文本
+func Highlight(s string, words []string) string {
+	rs := []rune(s)
+	return highlightRunes(rs, lowerRunes(rs), words)
+}
+
+// 取第一个命中位置附近的文字作为摘要
+func Snippet(s string, words []string, radius int) string {
+	rs := []rune(s)
+	lower := lowerRunes(rs)
+	ranges := matchRanges(lower, words)
+
+	start := 0
+	if len(ranges) > 0 {
+		start = ranges[0][0] - radius
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + 2*radius
+	if end > len(rs) {
+		end = len(rs)
+	}
+
+	snippet := highlightRunes(rs[start:end], lower[start:end], words)
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(rs) {
+		snippet = snippet + "..."
+	}
+	return snippet
+}
+
+// 逐个字转小写，保证和原文下标一一对应
+func lowerRunes(rs []rune) []rune {
+	lower := make([]rune, len(rs))
+	for i, r := range rs {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
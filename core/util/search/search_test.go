@@ -0,0 +1,163 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Go语言搜索引擎, Hello World!")
+	want := []string{"go", "语言", "言搜", "搜索", "索引", "引擎", "hello", "world"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got = Tokenize("中 a1")
+	want = []string{"中", "a1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestIndexTokens(t *testing.T) {
+	got := IndexTokens("北京 go 猫")
+	want := []string{"北京", "go", "猫", "北", "京"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestSearchOneChar(t *testing.T) {
+	idx := NewIndex()
+	idx.Put(Doc{Id: 1, Title: "我爱北京天安门", Describe: "猫和狗都是动物"})
+
+	// 只搜一个字
+	for _, k := range []string{"猫", "北", "北京", "天安门"} {
+		hits, total := idx.Search(Query{Keyword: k, Status: -1})
+		if total != 1 || !reflect.DeepEqual(ids(hits), []int{1}) {
+			t.Fatalf("%s got %v total %d", k, ids(hits), total)
+		}
+	}
+
+	if hits, _ := idx.Search(Query{Keyword: "猫", Status: -1}); len(hits) != 1 || hits[0].Snippet != "<em>猫</em>和狗都是动物" {
+		t.Fatalf("snippet wrong: %v", hits)
+	}
+
+	if _, total := idx.Search(Query{Keyword: "鱼", Status: -1}); total != 0 {
+		t.Fatalf("got total %d", total)
+	}
+}
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	idx.Put(Doc{Id: 1, UserId: 1, NodeId: 1, Title: "搜索引擎入门", Describe: "倒排索引是搜索引擎的核心。", CreateTime: 100})
+	idx.Put(Doc{Id: 2, UserId: 1, NodeId: 2, Title: "数据库", Describe: "MySQL 也可以做简单的搜索引擎。", CreateTime: 200})
+	idx.Put(Doc{Id: 3, UserId: 2, NodeId: 3, Title: "Golang", Describe: "Go is fun, go go go.", CreateTime: 300})
+	idx.Put(Doc{Id: 4, UserId: 2, NodeId: 3, Status: 1, Title: "隐藏的搜索引擎", Describe: "hide", CreateTime: 400})
+	idx.Put(Doc{Id: 5, UserId: 2, NodeId: 3, Locked: true, Title: "加密的搜索引擎", Describe: "lock", CreateTime: 500})
+	return idx
+}
+
+func ids(hits []Hit) []int {
+	back := make([]int, 0, len(hits))
+	for _, v := range hits {
+		back = append(back, v.Id)
+	}
+	return back
+}
+
+func TestSearchRank(t *testing.T) {
+	idx := newTestIndex()
+
+	// 标题命中的排在前面，隐藏和加密的不公开
+	hits, total := idx.Search(Query{Keyword: "搜索引擎", Public: true, Status: -1})
+	if total != 2 || !reflect.DeepEqual(ids(hits), []int{1, 2}) {
+		t.Fatalf("got %v total %d", ids(hits), total)
+	}
+
+	hits, total = idx.Search(Query{Keyword: "搜索引擎", UserId: 2, Status: -1})
+	if total != 2 || !reflect.DeepEqual(ids(hits), []int{5, 4}) {
+		t.Fatalf("got %v total %d", ids(hits), total)
+	}
+
+	// 所有词都要命中
+	_, total = idx.Search(Query{Keyword: "搜索引擎 golang", Status: -1})
+	if total != 0 {
+		t.Fatalf("got total %d", total)
+	}
+
+	_, total = idx.Search(Query{Keyword: "   ", Status: -1})
+	if total != 0 {
+		t.Fatalf("got total %d", total)
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	idx := newTestIndex()
+
+	hits, _ := idx.Search(Query{Keyword: "搜索", NodeId: 2, Status: -1})
+	if !reflect.DeepEqual(ids(hits), []int{2}) {
+		t.Fatalf("got %v", ids(hits))
+	}
+
+	hits, _ = idx.Search(Query{Keyword: "搜索", Status: 1})
+	if !reflect.DeepEqual(ids(hits), []int{4}) {
+		t.Fatalf("got %v", ids(hits))
+	}
+
+	hits, _ = idx.Search(Query{Keyword: "搜索", CreateTimeBegin: 150, CreateTimeEnd: 450, Status: -1})
+	if !reflect.DeepEqual(ids(hits), []int{4, 2}) {
+		t.Fatalf("got %v", ids(hits))
+	}
+
+	// 分页
+	hits, total := idx.Search(Query{Keyword: "搜索", Status: -1, Offset: 1, Limit: 2})
+	if total != 4 || len(hits) != 2 {
+		t.Fatalf("got %v total %d", ids(hits), total)
+	}
+
+	hits, total = idx.Search(Query{Keyword: "搜索", Status: -1, Offset: 10, Limit: 2})
+	if total != 4 || len(hits) != 0 {
+		t.Fatalf("got %v total %d", ids(hits), total)
+	}
+}
+
+func TestPutRemove(t *testing.T) {
+	idx := newTestIndex()
+
+	// 替换后旧的词不再命中
+	idx.Put(Doc{Id: 3, UserId: 2, Title: "Rust", Describe: "rust"})
+	if _, total := idx.Search(Query{Keyword: "go", Status: -1}); total != 0 {
+		t.Fatalf("got total %d", total)
+	}
+
+	idx.Remove(1)
+	idx.Remove(100)
+	hits, _ := idx.Search(Query{Keyword: "搜索引擎", Public: true, Status: -1})
+	if !reflect.DeepEqual(ids(hits), []int{2}) {
+		t.Fatalf("got %v", ids(hits))
+	}
+
+	if idx.Len() != 4 {
+		t.Fatalf("got len %d", idx.Len())
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	got := Highlight("Go <b>语言</b> GO", Words("go"))
+	want := "<em>Go</em> &lt;b&gt;语言&lt;/b&gt; <em>GO</em>"
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	got = Snippet("0123456789搜索引擎0123456789", Words("搜索"), 4)
+	want = "...6789<em>搜索</em>引擎..."
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	got = Snippet("abc", Words("x"), 4)
+	if got != "abc" {
+		t.Fatalf("got %s", got)
+	}
+}
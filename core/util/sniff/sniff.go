@@ -0,0 +1,132 @@
+// 根据文件开头的魔数判断真实的类型，不相信文件后缀
+// 标准库 http.DetectContentType 不认识的格式在这里补上
+package sniff
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// 判断类型只需要开头这么多字节
+const HeadSize = 512
+
+const unknown = "application/octet-stream"
+
+var (
+	ErrActive   = errors.New("active content not permit")
+	ErrMismatch = errors.New("content not match suffix")
+	ErrSuffix   = errors.New("suffix not support")
+)
+
+var signatures = []struct {
+	magic []byte
+	mime  string
+}{
+	{[]byte("FWS"), "application/x-shockwave-flash"},
+	{[]byte("CWS"), "application/x-shockwave-flash"},
+	{[]byte("ZWS"), "application/x-shockwave-flash"},
+	{[]byte("FLV\x01"), "video/x-flv"},
+	{[]byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "application/x-ole-storage"}, // doc xls ppt
+	{[]byte("\x30\x26\xB2\x75\x8E\x66\xCF\x11"), "video/x-ms-asf"},            // wma wmv asf
+	{[]byte(".RMF"), "application/vnd.rn-realmedia"},
+	{[]byte("MThd"), "audio/midi"},
+	{[]byte("BZh"), "application/x-bzip2"},
+	{[]byte("\x00\x00\x01\xBA"), "video/mpeg"},
+	{[]byte("\x00\x00\x01\xB3"), "video/mpeg"},
+	{[]byte("\xFF\xFB"), "audio/mpeg"}, // 没有 ID3 头的 mp3
+	{[]byte("\xFF\xF3"), "audio/mpeg"},
+	{[]byte("\xFF\xF2"), "audio/mpeg"},
+}
+
+// 浏览器会执行的内容，不管后缀是什么都不接受
+var activeTypes = map[string]bool{
+	"text/html":                     true,
+	"text/xml":                      true,
+	"image/svg+xml":                 true,
+	"application/x-shockwave-flash": true,
+}
+
+// 后缀允许的真实类型
+var suffixTypes = map[string][]string{
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"bmp":  {"image/bmp"},
+	"webp": {"image/webp"},
+	"flv":  {"video/x-flv"},
+	"mp3":  {"audio/mpeg"},
+	"wav":  {"audio/wave"},
+	"wma":  {"video/x-ms-asf"},
+	"wmv":  {"video/x-ms-asf"},
+	"asf":  {"video/x-ms-asf"},
+	"mid":  {"audio/midi"},
+	"avi":  {"video/avi"},
+	"mpg":  {"video/mpeg"},
+	"rm":   {"application/vnd.rn-realmedia"},
+	"rmvb": {"application/vnd.rn-realmedia"},
+	"doc":  {"application/x-ole-storage"},
+	"xls":  {"application/x-ole-storage"},
+	"ppt":  {"application/x-ole-storage"},
+	"docx": {"application/zip"},
+	"xlsx": {"application/zip"},
+	"zip":  {"application/zip"},
+	"rar":  {"application/x-rar-compressed"},
+	"gz":   {"application/x-gzip"},
+	"bz2":  {"application/x-bzip2"},
+	"pdf":  {"application/pdf"},
+	"txt":  {"text/plain"},
+}
+
+// 根据内容判断类型，去掉了 charset 之类的参数
+func Detect(head []byte) string {
+	if len(head) > HeadSize {
+		head = head[:HeadSize]
+	}
+
+	for _, s := range signatures {
+		if bytes.HasPrefix(head, s.magic) {
+			return s.mime
+		}
+	}
+
+	t := http.DetectContentType(head)
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+
+	// svg 会被认成 xml 或者纯文本
+	if t == "text/xml" || t == "text/plain" {
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+	return t
+}
+
+// 检查内容和后缀是否一致，返回真实类型
+// 图片必须完全一致，其他格式识别不出来时相信后缀
+func Check(suffix string, head []byte) (string, error) {
+	t := Detect(head)
+	if activeTypes[t] {
+		return t, ErrActive
+	}
+
+	want, ok := suffixTypes[strings.ToLower(suffix)]
+	if !ok {
+		return t, ErrSuffix
+	}
+
+	for _, v := range want {
+		if v == t {
+			return t, nil
+		}
+	}
+
+	if t == unknown && !strings.HasPrefix(want[0], "image/") {
+		return want[0], nil
+	}
+	return t, ErrMismatch
+}
@@ -0,0 +1,35 @@
+package sniff
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpg := []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00")
+
+	cases := []struct {
+		suffix string
+		head   []byte
+		mime   string
+		err    error
+	}{
+		{"png", png, "image/png", nil},
+		{"JPG", jpg, "image/jpeg", nil},
+		{"jpg", png, "image/png", ErrMismatch},
+		{"jpg", []byte("<html><script>alert(1)</script>"), "text/html", ErrActive},
+		{"jpg", []byte("CWS\x0a\x00\x00"), "application/x-shockwave-flash", ErrActive},
+		{"txt", []byte("<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\">"), "image/svg+xml", ErrActive},
+		{"txt", []byte("hello fafacms"), "text/plain", nil},
+		{"doc", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00"), "application/x-ole-storage", nil},
+		{"docx", []byte("PK\x03\x04\x14\x00"), "application/zip", nil},
+		{"rmvb", []byte("\x00\x01\x02\x03\x04"), "application/vnd.rn-realmedia", nil},
+		{"png", []byte("\x00\x01\x02\x03\x04"), "application/octet-stream", ErrMismatch},
+		{"exe", []byte("MZ\x90\x00"), "application/octet-stream", ErrSuffix},
+	}
+
+	for _, v := range cases {
+		mime, err := Check(v.suffix, v.head)
+		if mime != v.mime || err != v.err {
+			t.Fatalf("%s %q: got %s %v, want %s %v", v.suffix, v.head, mime, err, v.mime, v.err)
+		}
+	}
+}
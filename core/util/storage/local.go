@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 本地磁盘，key 的第一段决定放到哪个目录，如 storage 和 storage_x，和静态路由对应
+type Local struct {
+	Dirs map[string]string
+}
+
+func NewLocal(dirs map[string]string) *Local {
+	return &Local{Dirs: dirs}
+}
+
+// key 转为磁盘路径，不允许跳出目录
+func (l *Local) path(key string) (string, error) {
+	key = path.Clean("/" + key)[1:]
+	i := strings.Index(key, "/")
+	if i <= 0 {
+		return "", ErrNotExist
+	}
+
+	dir, ok := l.Dirs[key[:i]]
+	if !ok {
+		return "", ErrNotExist
+	}
+	return filepath.Join(dir, filepath.FromSlash(key[i+1:])), nil
+}
+
+func (l *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0777)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再改名，避免写一半被读到
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+func (l *Local) Delete(key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) Stat(key string) (*ObjectInfo, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(p)),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+// 本地文件通过静态路由访问
+func (l *Local) URL(key string) string {
+	return "/" + strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	aliyun "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/hunterhug/fafacms/core/util/oss"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 阿里云对象存储，客户端只创建一次
+type Oss struct {
+	key    oss.Key
+	bucket *aliyun.Bucket
+}
+
+func NewOss(k oss.Key) (*Oss, error) {
+	client, err := aliyun.New(k.Endpoint, k.AccessKeyId, k.AccessKeySecret)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := client.Bucket(k.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return &Oss{key: k, bucket: bucket}, nil
+}
+
+func (o *Oss) Put(key string, r io.Reader, size int64, contentType string) error {
+	options := make([]aliyun.Option, 0, 2)
+	if size >= 0 {
+		options = append(options, aliyun.ContentLength(size))
+	}
+	if contentType != "" {
+		options = append(options, aliyun.ContentType(contentType))
+	}
+	return o.bucket.PutObject(key, r, options...)
+}
+
+func (o *Oss) Get(key string) (io.ReadCloser, error) {
+	body, err := o.bucket.GetObject(key)
+	if ossNotFound(err) {
+		return nil, ErrNotExist
+	}
+	return body, err
+}
+
+func (o *Oss) Delete(key string) error {
+	return o.bucket.DeleteObject(key)
+}
+
+func (o *Oss) Stat(key string) (*ObjectInfo, error) {
+	h, err := o.bucket.GetObjectDetailedMeta(key)
+	if ossNotFound(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return headerInfo(key, h), nil
+}
+
+// 和以前保存的地址保持一样的格式
+func (o *Oss) URL(key string) string {
+	return o.key.BucketName + "." + o.key.Endpoint + "/" + key
+}
+
+func ossNotFound(err error) bool {
+	e, ok := err.(aliyun.ServiceError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// 从响应头中取对象信息，OSS和S3都一样
+func headerInfo(key string, h http.Header) *ObjectInfo {
+	info := &ObjectInfo{Key: key, ContentType: h.Get("Content-Type")}
+	info.Size, _ = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	info.ModTime, _ = time.Parse(http.TimeFormat, h.Get("Last-Modified"))
+	return info
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3兼容的对象存储，如 AWS S3，MinIO，七牛和腾讯云等
+type S3Config struct {
+	Endpoint        string // 如 https://s3.amazonaws.com，http://127.0.0.1:9000
+	Region          string // 为空时为 us-east-1
+	Bucket          string
+	AccessKeyId     string
+	AccessKeySecret string
+	PathStyle       bool   // 用 Endpoint/Bucket/key 访问，MinIO 一般要开启
+	Domain          string // 对外访问的地址，如CDN，为空时用 Endpoint 拼
+	TimeoutSecond   int    // 一个请求最长多少秒，包括传输内容，默认600
+}
+
+// 只实现了用到的几个接口，请求用 AWS Signature V4 签名
+type S3 struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// 上传时不计算内容的哈希，不用把文件读两遍
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func NewS3(conf S3Config) (*S3, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("s3: endpoint or bucket empty")
+	}
+
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(conf.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3: endpoint %s wrong", conf.Endpoint)
+	}
+
+	if conf.TimeoutSecond <= 0 {
+		conf.TimeoutSecond = 600
+	}
+
+	// 服务端卡住时不能一直等，连接和等响应头都要有超时
+	client := &http.Client{
+		Timeout: time.Duration(conf.TimeoutSecond) * time.Second,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   10,
+		},
+	}
+	return &S3{conf: conf, endpoint: u, client: client}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + awsEscapePath(strings.TrimPrefix(key, "/"))
+	if s.conf.PathStyle {
+		path = "/" + awsEscapePath(s.conf.Bucket) + path
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+
+	u.Path, _ = url.PathUnescape(path)
+	u.RawPath = path
+	return &u
+}
+
+func (s *S3) do(method string, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payload := emptyPayload
+	if body != nil {
+		payload = unsignedPayload
+		req.ContentLength = size
+	}
+
+	signV4(req, s.conf.Region, s.conf.AccessKeyId, s.conf.AccessKeySecret, payload, time.Now())
+	return s.client.Do(req)
+}
+
+// 非2xx的响应转为错误，404为 ErrNotExist
+func s3Error(resp *http.Response, method string, key string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+
+	raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3: %s %s status %d: %s", method, key, resp.StatusCode, string(raw))
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	// S3不支持不带长度的上传，只能先读到内存
+	if size < 0 {
+		raw, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+		size = int64(len(raw))
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(http.MethodPut, key, r, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp, http.MethodPut, key)
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s3Error(resp, http.MethodGet, key); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = s3Error(resp, http.MethodDelete, key)
+	if err == ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+func (s *S3) Stat(key string) (*ObjectInfo, error) {
+	resp, err := s.do(http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := s3Error(resp, http.MethodHead, key); err != nil {
+		return nil, err
+	}
+	return headerInfo(key, resp.Header), nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.conf.Domain != "" {
+		return strings.TrimSuffix(s.conf.Domain, "/") + "/" + awsEscapePath(strings.TrimPrefix(key, "/"))
+	}
+	return s.objectURL(key).String()
+}
+
+// 按 AWS 的规则编码路径，只保留 A-Z a-z 0-9 - _ . ~ 和 /
+func awsEscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// AWS Signature V4 签名，签 host，range，content-type 和所有 x-amz- 开头的头
+func signV4(req *http.Request, region, accessKeyId, accessKeySecret, payload string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+	names := []string{"host"}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			names = append(names, name)
+			values[name] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSha256([]byte("AWS4"+accessKeySecret), day)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyId, scope, signed, signature))
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// 存储后端的编号，保存在 File.StoreType 中，已经用了的不能改
+const (
+	TypeLocal = 0
+	TypeOss   = 1
+	TypeS3    = 2
+)
+
+// 配置中使用的后端名称
+var TypeNames = map[string]int{
+	"local": TypeLocal,
+	"oss":   TypeOss,
+	"s3":    TypeS3,
+}
+
+var ErrNotExist = errors.New("storage: object not exist")
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// 存储后端，key 为 storage/用户/类型/文件名 这样的相对路径
+type Storage interface {
+	// size 未知时传 -1
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	Stat(key string) (*ObjectInfo, error)
+	URL(key string) string
+}
+
+// 已登记的后端，旧文件按自己的 StoreType 找后端，新文件存到默认后端
+type Registry struct {
+	lock     sync.RWMutex
+	backends map[int]Storage
+	current  int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{backends: make(map[int]Storage), current: -1}
+}
+
+func (r *Registry) Register(id int, s Storage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.backends[id] = s
+}
+
+func (r *Registry) Get(id int) (Storage, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s, ok := r.backends[id]
+	if !ok {
+		return nil, fmt.Errorf("storage: type %d not register", id)
+	}
+	return s, nil
+}
+
+func (r *Registry) SetDefault(id int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.backends[id]; !ok {
+		return fmt.Errorf("storage: type %d not register", id)
+	}
+	r.current = id
+	return nil
+}
+
+// 默认的后端，新上传的文件存在这里
+func (r *Registry) Default() (int, Storage) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.current, r.backends[r.current]
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fafa_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLocal(map[string]string{"storage": filepath.Join(dir, "storage"), "storage_x": filepath.Join(dir, "storage_x")})
+
+	key := "storage_x/hunterhug/image/a.png"
+	err = l.Put(key, bytes.NewReader([]byte("hello")), 5, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "storage_x", "hunterhug", "image", "a.png")); err != nil {
+		t.Fatalf("file not in dir: %s", err.Error())
+	}
+
+	info, err := l.Stat(key)
+	if err != nil || info.Size != 5 || info.ContentType != "image/png" {
+		t.Fatalf("stat wrong: %#v, %v", info, err)
+	}
+
+	if l.URL(key) != "/"+key {
+		t.Fatalf("url wrong: %s", l.URL(key))
+	}
+
+	// 不能跳出目录
+	if _, err := l.Stat("storage/../../etc/passwd"); err != ErrNotExist {
+		t.Fatalf("escape dir: %v", err)
+	}
+
+	if _, err := l.Stat("other/a.png"); err != ErrNotExist {
+		t.Fatalf("unknown dir: %v", err)
+	}
+
+	err = l.Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Get(key); err != ErrNotExist {
+		t.Fatalf("should not exist: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if err := r.SetDefault(TypeS3); err == nil {
+		t.Fatalf("set default not register should fail")
+	}
+
+	l := NewLocal(nil)
+	r.Register(TypeLocal, l)
+	if err := r.SetDefault(TypeLocal); err != nil {
+		t.Fatal(err)
+	}
+
+	id, s := r.Default()
+	if id != TypeLocal || s != l {
+		t.Fatalf("default wrong")
+	}
+
+	if _, err := r.Get(TypeOss); err == nil {
+		t.Fatalf("get not register should fail")
+	}
+}
@@ -0,0 +1,112 @@
+// RFC 6238 基于时间的一次性密码，用于两步验证
+// 使用 SHA1，6位数字，30秒一个周期，和常见的验证器应用一致
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30
+
+	// 允许前后各差一个周期，防止手机时间不准
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// 生成随机的密钥，base32编码
+func GenerateSecret() (string, error) {
+	raw := make([]byte, 20)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// RFC 4226 HOTP
+func hotp(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod = mod * 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// 某个时间所在的周期
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// 生成某个时间的验证码
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(Counter(t)), Digits), nil
+}
+
+// 校验验证码，成功时返回命中的周期，调用方应记住它，同一个周期的验证码不能再用
+// lastCounter 为上次使用过的周期，不大于它的都不再接受
+func Validate(secret string, code string, t time.Time, lastCounter int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) == 0 {
+		return 0, false
+	}
+
+	now := Counter(t)
+	for i := int64(-skew); i <= skew; i++ {
+		counter := now + i
+		if counter <= lastCounter {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, uint64(counter), Digits)), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// 验证器应用扫码用的地址
+func ProvisioningURI(secret string, issuer string, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", Digits))
+	v.Set("period", fmt.Sprintf("%d", Period))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的测试数据，SHA1，8位
+func TestRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for ts, want := range cases {
+		got := hotp(key, uint64(Counter(time.Unix(ts, 0))), 8)
+		if got != want {
+			t.Errorf("time %d got %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	now := time.Unix(1558000000, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	counter, ok := Validate(secret, code, now, 0)
+	if !ok || counter != Counter(now) {
+		t.Fatalf("code %s should pass", code)
+	}
+
+	// 同一个周期不能重复使用
+	if _, ok := Validate(secret, code, now, counter); ok {
+		t.Fatalf("code %s should not be reused", code)
+	}
+
+	// 允许差一个周期
+	if _, ok := Validate(secret, code, now.Add(Period*time.Second), 0); !ok {
+		t.Fatalf("code %s should pass in next period", code)
+	}
+
+	if _, ok := Validate(secret, code, now.Add(3*Period*time.Second), 0); ok {
+		t.Fatalf("code %s should expire", code)
+	}
+
+	if _, ok := Validate(secret, "12345", now, 0); ok {
+		t.Fatalf("short code should not pass")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "FaFa CMS", "hunter@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/FaFa%20CMS:hunter@example.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Fatalf("got %s", uri)
+	}
+}
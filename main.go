@@ -84,6 +84,12 @@ func main() {
 		panic(err)
 	}
 
+	// 初始化文件存储
+	err = server.InitStorage(config.FafaConfig)
+	if err != nil {
+		panic(err)
+	}
+
 	// 初始化网站Session存储
 	if sessionUseRedis {
 		err = server.InitSession(config.FafaConfig.SessionConfig)
@@ -98,24 +104,103 @@ func main() {
 	if createTable {
 		server.CreateTable([]interface{}{
 			model.User{},           // 用户表
-			model.Group{},          // 用户组表，用户可以拥有一个组
+			model.Group{},          // 用户组表，组可以继承父组的权限
+			model.UserGroup{},      // 用户组关联表，用户可以属于多个组
 			model.Resource{},       // 资源表，主要为需要管理员权限的路由服务
 			model.GroupResource{},  // 组可以被分配资源
 			model.Content{},        // 内容表
 			model.ContentHistory{}, // 内容历史表
 			model.ContentNode{},    // 内容节点表，内容必须拥有一个节点
 			model.File{},           // 文件表
-			//model.Comment{},        // 评论表
-			//model.Log{},            // 日志表
+			model.FileUpload{},     // 分片上传表
+			model.FileRef{},        // 文件引用表，被引用的文件不能删除
+			model.Comment{},        // 评论表
+			model.Vote{},           // 点赞表
+			model.Follow{},         // 关注表
+			model.Message{},        // 站内信表
+			model.Tag{},            // 标签表
+			model.ContentTag{},     // 内容标签关联表
+			model.LoginToken{},     // 登录设备表，记住登录的令牌和Session
+			model.UserIdentity{},   // 第三方登录绑定表
+			model.AccessToken{},    // 个人访问令牌表
+			model.Log{},            // 审计日志表
 		})
 	}
 
+	// 路由同步到资源表
+	added, stale, err := server.InitResource()
+	if err != nil {
+		panic(err)
+	}
+	flog.Log.Noticef("Resource sync, %d added, %d stale", added, stale)
+
+	// 旧版本用户只有一个组，迁移到用户组关联表
+	migrated, err := model.MigrateUserGroup()
+	if err != nil {
+		panic(err)
+	}
+	if migrated > 0 {
+		flog.Log.Noticef("Migrate %d users into user group", migrated)
+	}
+
+	// 还没有超级管理员时，打印一次性的初始化令牌
+	token, err := controllers.InitSetup()
+	if err != nil {
+		panic(err)
+	}
+	if token != "" {
+		flog.Log.Noticef("No super admin yet, POST /setup with token %s to create one", token)
+	}
+
+	// 文件上传的临时目录和大小限制
+	err = controllers.InitUpload(config.FafaConfig.UploadConfig, config.FafaConfig.DefaultConfig.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+
+	// 上传图片的缩略图尺寸
+	err = controllers.InitImage(config.FafaConfig.ImageConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	// 审计日志
+	controllers.InitAudit(config.FafaConfig.AuditConfig)
+
+	// 第三方登录
+	err = controllers.InitOAuth(config.FafaConfig.OAuthConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	// 重建全文搜索索引
+	num, err := model.RebuildContentSearch()
+	if err != nil {
+		panic(err)
+	}
+	flog.Log.Noticef("Search index %d contents", num)
+
+	// 重建文件引用，再开始清理没有引用的隐藏文件
+	num, err = model.RebuildFileRef()
+	if err != nil {
+		panic(err)
+	}
+	flog.Log.Noticef("File ref %d records", num)
+	controllers.InitFileGC(config.FafaConfig.FileGCConfig)
+
+	// 限流规则要和路由对应上
+	err = router.CheckLimitRouter()
+	if err != nil {
+		panic(err)
+	}
+
 	// Server Run
 	engine := server.Server()
 
 	// Storage static API
-	engine.Static("/storage", config.FafaConfig.DefaultConfig.StoragePath)
-	engine.Static("/storage_x", config.FafaConfig.DefaultConfig.StoragePath+"_x")
+	static := engine.Group("/", controllers.StorageHeader)
+	static.Static("/storage", config.FafaConfig.DefaultConfig.StoragePath)
+	static.Static("/storage_x", config.FafaConfig.DefaultConfig.StoragePath+"_x")
 
 	// Web welcome home!
 	router.SetRouter(engine)